@@ -0,0 +1,276 @@
+package ail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// ─── Stream accumulation ─────────────────────────────────────────────────────
+
+// Accumulator folds a sequence of stream programs (from ParseStreamChunk or
+// a StreamConverter pipeline) into the complete response program that
+// ParseResponse would have produced for the same call:
+//
+//	RESP_ID, RESP_MODEL, USAGE
+//	MSG_START ROLE_AST
+//	  THINK_START THINK_CHUNK THINK_REF THINK_END   (one block per reasoning run)
+//	  TXT_CHUNK                                     (one chunk per text run)
+//	  CALL_START CALL_NAME CALL_ARGS CALL_END
+//	  RESP_DONE
+//	MSG_END
+//
+// Content keeps its arrival order. Usage from several chunks is merged
+// field by field, later non-zero values winning (see Usage). The result
+// can be passed to any ResponseEmitter. An Accumulator is safe for
+// concurrent use.
+//
+//	acc := ail.NewAccumulator()
+//	for _, chunk := range chunks {
+//	    prog, _ := parser.ParseStreamChunk(chunk)
+//	    acc.Add(prog)
+//	}
+//	resp := acc.Program()
+type Accumulator struct {
+	mu       sync.Mutex
+	id       string
+	model    string
+	usage    *Usage
+	finish   Instruction // last RESP_DONE
+	parts    []*accPart
+	tools    map[int]*accPart // latest tool part per stream index
+	lastTool *accPart
+	done     bool
+	err      *StreamError
+}
+
+type accPartKind uint8
+
+const (
+	accText accPartKind = iota
+	accThink
+	accTool
+)
+
+type accPart struct {
+	kind accPartKind
+	text bytes.Buffer // text, thinking or tool arguments
+	sig  string       // thinking signature
+	id   string       // tool call ID
+	name string       // tool name
+}
+
+// NewAccumulator creates an empty accumulator.
+func NewAccumulator() *Accumulator {
+	return &Accumulator{tools: make(map[int]*accPart)}
+}
+
+// Add folds one stream program into the accumulated response.
+func (a *Accumulator) Add(p *Program) error {
+	if p == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, inst := range p.Code {
+		switch inst.Op {
+		case STREAM_END:
+			a.done = true
+		case RESP_ID:
+			a.id = inst.Str
+		case RESP_MODEL:
+			a.model = inst.Str
+		case RESP_DONE:
+			// Responses streams report a finish per output item; a
+			// later "stop" must not hide that tools were called.
+			if inst.Str != "" && !(a.finish.Str == "tool_calls" && inst.Str == "stop") {
+				a.finish = inst
+			}
+		case USAGE:
+			if err := a.mergeUsage(inst.JSON); err != nil {
+				return fmt.Errorf("ail: accumulate: instruction %d: %w", i, err)
+			}
+		case STREAM_DELTA:
+			a.textPart(accText).text.WriteString(inst.Str)
+		case STREAM_THINK_DELTA:
+			a.textPart(accThink).text.WriteString(inst.Str)
+		case STREAM_ERROR:
+			if a.err == nil {
+				a.err = decodeProviderError(inst.JSON)
+			}
+		case STREAM_THINK_SIG:
+			a.thinkPart().sig += inst.Str
+		case STREAM_TOOL_DELTA:
+			if err := a.addToolDelta(inst.JSON); err != nil {
+				return fmt.Errorf("ail: accumulate: instruction %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Done reports whether a STREAM_END has been seen.
+func (a *Accumulator) Done() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.done
+}
+
+// Err returns the first STREAM_ERROR seen, as a *StreamError, or nil. The
+// response accumulated before the error is still available from Program.
+func (a *Accumulator) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil {
+		return nil
+	}
+	return a.err
+}
+
+// textPart returns the current part of kind, starting a new one if the
+// previous part is of a different kind.
+func (a *Accumulator) textPart(kind accPartKind) *accPart {
+	if n := len(a.parts); n > 0 && a.parts[n-1].kind == kind {
+		return a.parts[n-1]
+	}
+	part := &accPart{kind: kind}
+	a.parts = append(a.parts, part)
+	return part
+}
+
+// thinkPart returns the latest thinking part, which a signature belongs
+// to even when other content has arrived since (Gemini sends it on the
+// following part), starting one if there is none.
+func (a *Accumulator) thinkPart() *accPart {
+	for i := len(a.parts) - 1; i >= 0; i-- {
+		if a.parts[i].kind == accThink {
+			return a.parts[i]
+		}
+	}
+	return a.textPart(accThink)
+}
+
+func (a *Accumulator) addToolDelta(j json.RawMessage) error {
+	var td struct {
+		Index     *int   `json:"index"`
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	}
+	if err := json.Unmarshal(j, &td); err != nil {
+		return fmt.Errorf("tool delta: %w", err)
+	}
+
+	var part *accPart
+	if td.Index != nil {
+		part = a.tools[*td.Index]
+	} else {
+		part = a.lastTool
+	}
+	switch {
+	case part != nil && td.Name != "" && part.name != "":
+		// A named delta on a named call starts a new call at the same index
+		// (Gemini sends each complete call at index 0).
+		part = nil
+	case part == nil && td.Name == "" && td.ID == "" && a.lastTool != nil:
+		// Argument deltas keyed differently from the call header
+		// (Responses output_index vs. item index) belong to the latest call.
+		part = a.lastTool
+	}
+	if part == nil {
+		part = &accPart{kind: accTool}
+		a.parts = append(a.parts, part)
+	}
+	if td.Index != nil {
+		a.tools[*td.Index] = part
+	}
+	a.lastTool = part
+
+	if part.id == "" {
+		part.id = td.ID
+	}
+	if part.name == "" {
+		part.name = td.Name
+	}
+	part.text.WriteString(td.Arguments)
+	return nil
+}
+
+func (a *Accumulator) mergeUsage(j json.RawMessage) error {
+	var u Usage
+	if err := json.Unmarshal(j, &u); err != nil {
+		return fmt.Errorf("usage: %w", err)
+	}
+	if a.usage == nil {
+		a.usage = &Usage{}
+	}
+	a.usage.merge(u)
+	return nil
+}
+
+// Program returns the response accumulated so far. It may be called at any
+// time; before the stream ends it describes a partial response.
+func (a *Accumulator) Program() *Program {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p := NewProgram()
+	if a.id != "" {
+		p.EmitString(RESP_ID, a.id)
+	}
+	if a.model != "" {
+		p.EmitString(RESP_MODEL, a.model)
+	}
+	if a.usage != nil {
+		a.usage.emit(p)
+	}
+
+	p.Emit(MSG_START)
+	p.Emit(ROLE_AST)
+	for _, part := range a.parts {
+		switch part.kind {
+		case accText:
+			p.EmitString(TXT_CHUNK, part.text.String())
+		case accThink:
+			p.Emit(THINK_START)
+			if part.text.Len() > 0 {
+				p.EmitString(THINK_CHUNK, part.text.String())
+			}
+			if part.sig != "" {
+				p.EmitRef(THINK_REF, p.AddBuffer([]byte(part.sig)))
+			}
+			p.Emit(THINK_END)
+		case accTool:
+			p.EmitString(CALL_START, part.id)
+			p.EmitString(CALL_NAME, part.name)
+			p.EmitJSON(CALL_ARGS, toolArgsJSON(part.text.Bytes()))
+			p.Emit(CALL_END)
+		}
+	}
+	if a.finish.Str != "" {
+		// Gemini reports STOP in a later chunk than the function call.
+		finish := a.finish
+		if finish.Str == string(FinishStop) && a.lastTool != nil {
+			finish.Str = string(FinishToolCalls)
+		}
+		p.Code = append(p.Code, finish)
+	}
+	p.Emit(MSG_END)
+	return p
+}
+
+// toolArgsJSON returns accumulated tool arguments as JSON: "{}" when empty,
+// the arguments themselves when valid, otherwise a JSON string holding the
+// raw text so that a truncated stream still yields a well-formed program.
+func toolArgsJSON(args []byte) json.RawMessage {
+	args = bytes.TrimSpace(args)
+	if len(args) == 0 {
+		return json.RawMessage(`{}`)
+	}
+	if json.Valid(args) {
+		return append(json.RawMessage(nil), args...)
+	}
+	j, _ := json.Marshal(string(args))
+	return j
+}
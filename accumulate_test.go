@@ -0,0 +1,147 @@
+package ail
+
+import (
+	"strings"
+	"testing"
+)
+
+// accumulate parses chunks with the stream parser for style and folds them.
+func accumulate(t *testing.T, style Style, chunks ...string) *Program {
+	t.Helper()
+	parser, err := GetStreamChunkParser(style)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := NewAccumulator()
+	for _, c := range chunks {
+		prog, err := parser.ParseStreamChunk([]byte(c))
+		if err != nil {
+			t.Fatalf("parse %s: %v", c, err)
+		}
+		if err := acc.Add(prog); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !acc.Done() {
+		t.Error("stream end not seen")
+	}
+	return acc.Program()
+}
+
+// withoutExts drops EXT_DATA so stream and non-stream programs compare.
+func withoutExts(p *Program) *Program {
+	out := &Program{Buffers: p.Buffers}
+	for _, inst := range p.Code {
+		if inst.Op != EXT_DATA {
+			out.Code = append(out.Code, inst)
+		}
+	}
+	return out
+}
+
+func TestAccumulateChatMatchesParseResponse(t *testing.T) {
+	got := accumulate(t, StyleChatCompletions,
+		`{"id":"c1","model":"gpt-4o","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Let me "}}]}`,
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"check."}}]}`,
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"get_time","arguments":"{}"}}]}}]}`,
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+		`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"id":"c1","model":"gpt-4o","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+	)
+
+	want, err := (&ChatCompletionsParser{}).ParseResponse([]byte(`{
+		"id":"c1","object":"chat.completion","model":"gpt-4o",
+		"choices":[{"index":0,"message":{"role":"assistant","content":"Let me check.","tool_calls":[
+			{"id":"call_a","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}},
+			{"id":"call_b","type":"function","function":{"name":"get_time","arguments":"{}"}}]},
+			"finish_reason":"tool_calls"}],
+		"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(withoutExts(want), got); !d.Equal() {
+		t.Errorf("accumulated response differs from parsed response:\n%s\n%s", d, got.Disasm())
+	}
+
+	// The accumulated program is emittable in any response format.
+	out, err := (&AnthropicEmitter{}).EmitResponse(got)
+	if err != nil || !strings.Contains(string(out), `"tool_use"`) {
+		t.Errorf("emit: %s (%v)", out, err)
+	}
+}
+
+func TestAccumulateAnthropicThinkingAndTools(t *testing.T) {
+	got := accumulate(t, StyleAnthropic,
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude"}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Need "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"a tool."}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"c2ln"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Checking"}}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"lookup","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"x\"}"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":7}}`,
+		`{"type":"message_stop"}`,
+	)
+	conv, err := got.Decompile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := conv.Messages[0]
+	if len(m.Parts) != 3 || m.Parts[0].Type != PartThinking || m.Parts[0].Text != "Need a tool." ||
+		string(m.Parts[0].Data) != "c2ln" || m.Parts[1].Text != "Checking" || m.Parts[2].Name != "lookup" || string(m.Parts[2].Args) != `{"q":"x"}` {
+		t.Errorf("parts = %+v", m.Parts)
+	}
+	if conv.ResponseID != "msg_1" || m.FinishReason != "tool_calls" || string(conv.Usage) != `{"completion_tokens":7}` {
+		t.Errorf("metadata:\n%s", got.Disasm())
+	}
+}
+
+func TestAccumulateGeminiCalls(t *testing.T) {
+	got := accumulate(t, StyleGoogleGenAI,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"a","args":{"x":1}}}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"b","args":{}}}]}}]}`,
+		`{"candidates":[{"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2,"totalTokenCount":5}}`,
+	)
+	calls := got.ToolCalls()
+	if len(calls) != 2 || calls[0].Name != "a" || calls[1].Name != "b" {
+		t.Errorf("calls:\n%s", got.Disasm())
+	}
+}
+
+func TestAccumulateGeminiSignatureOnCall(t *testing.T) {
+	got := accumulate(t, StyleGoogleGenAI,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Plan.","thought":true}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Calling."},{"functionCall":{"name":"a","args":{}},"thoughtSignature":"c2ln"}]}}]}`,
+		`{"candidates":[{"finishReason":"STOP"}]}`,
+	)
+	conv, err := got.Decompile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parts := conv.Messages[0].Parts; len(parts) != 3 || string(parts[0].Data) != "c2ln" || parts[1].Text != "Calling." {
+		t.Errorf("signature not on the thinking part:\n%s", got.Disasm())
+	}
+}
+
+func TestAccumulateTruncatedArgs(t *testing.T) {
+	acc := NewAccumulator()
+	p := NewProgram()
+	p.EmitJSON(STREAM_TOOL_DELTA, []byte(`{"index":0,"id":"c","name":"f","arguments":"{\"a\":"}`))
+	if err := acc.Add(p); err != nil {
+		t.Fatal(err)
+	}
+	out := acc.Program()
+	if args := out.Code[out.FindAll(CALL_ARGS)[0]].JSON; string(args) != `"{\"a\":"` {
+		t.Errorf("args = %s", args)
+	}
+	if acc.Done() {
+		t.Error("Done before STREAM_END")
+	}
+}
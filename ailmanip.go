@@ -1,6 +1,9 @@
 package ail
 
-import "strings"
+import (
+	"encoding/json"
+	"strings"
+)
 
 // ─── Span types ──────────────────────────────────────────────────────────────
 // Spans represent contiguous instruction ranges delimited by START/END opcodes.
@@ -13,11 +16,17 @@ type MessageSpan struct {
 	Role  Opcode // ROLE_SYS, ROLE_USR, ROLE_AST, or ROLE_TOOL
 }
 
-// ToolDefSpan locates a DEF_START..DEF_END block for a single tool definition.
+// ToolDefSpan locates a single tool definition. When the tool is alone in
+// its DEF_START..DEF_END block the span covers the whole block; when a block
+// holds several tools (as parsed from a provider request) the span runs from
+// the tool's DEF_NAME up to the instruction before the next DEF_NAME or
+// DEF_END.
 type ToolDefSpan struct {
-	Start int    // index of DEF_START
-	End   int    // index of DEF_END
-	Name  string // DEF_NAME value within the span
+	Start      int    // first instruction of the tool
+	End        int    // last instruction of the tool
+	Name       string // DEF_NAME value within the span
+	BlockStart int    // index of the enclosing DEF_START
+	BlockEnd   int    // index of the enclosing DEF_END
 }
 
 // ToolCallSpan locates a CALL_START..CALL_END block.
@@ -70,28 +79,32 @@ func (p *Program) Messages() []MessageSpan {
 	return spans
 }
 
-// ToolDefs returns all tool definition spans.
+// ToolDefs returns one span per tool definition, in instruction order.
 func (p *Program) ToolDefs() []ToolDefSpan {
 	var spans []ToolDefSpan
 	for i := 0; i < len(p.Code); i++ {
 		if p.Code[i].Op != DEF_START {
 			continue
 		}
-		span := ToolDefSpan{Start: i}
-		for j := i + 1; j < len(p.Code); j++ {
-			switch p.Code[j].Op {
-			case DEF_NAME:
-				if span.Name == "" {
-					span.Name = p.Code[j].Str
-				}
-			case DEF_END:
-				span.End = j
-				spans = append(spans, span)
-				i = j
-				goto nextDef
+		end := i + 1
+		for end < len(p.Code) && p.Code[end].Op != DEF_END {
+			end++
+		}
+		if end == len(p.Code) {
+			break // unterminated block
+		}
+		first := len(spans)
+		for j := i + 1; j < end; j++ {
+			if p.Code[j].Op == DEF_NAME {
+				spans = append(spans, ToolDefSpan{Start: j, End: j, Name: p.Code[j].Str, BlockStart: i, BlockEnd: end})
+			} else if len(spans) > first {
+				spans[len(spans)-1].End = j
 			}
 		}
-	nextDef:
+		if len(spans) == first+1 {
+			spans[first].Start, spans[first].End = i, end
+		}
+		i = end
 	}
 	return spans
 }
@@ -500,3 +513,286 @@ func (p *Program) Config() map[string]string {
 	}
 	return m
 }
+
+// ─── Tool definitions ────────────────────────────────────────────────────────
+
+// toolBody returns the instructions describing a tool (DEF_NAME onwards),
+// without the enclosing DEF_START/DEF_END.
+func (p *Program) toolBody(span ToolDefSpan) []Instruction {
+	start, end := span.Start, span.End
+	if start == span.BlockStart {
+		start, end = start+1, end-1
+	}
+	return p.Code[start : end+1]
+}
+
+// KeepTools returns a new program containing only the tool definitions for
+// which keep returns true. DEF blocks left without tools are removed.
+func (p *Program) KeepTools(keep func(name string) bool) *Program {
+	remove := make(map[int]bool)
+	kept := make(map[int]int) // BlockStart → tools kept in the block
+	defs := p.ToolDefs()
+	for _, d := range defs {
+		if keep(d.Name) {
+			kept[d.BlockStart]++
+			continue
+		}
+		for i := d.Start; i <= d.End; i++ {
+			remove[i] = true
+		}
+	}
+	for _, d := range defs {
+		if kept[d.BlockStart] == 0 {
+			for i := d.BlockStart; i <= d.BlockEnd; i++ {
+				remove[i] = true
+			}
+		}
+	}
+	result := NewProgram()
+	for i, inst := range p.Code {
+		if !remove[i] {
+			result.Code = append(result.Code, cloneInstruction(inst))
+		}
+	}
+	result.Buffers = cloneBuffers(p.Buffers)
+	return result
+}
+
+// RemoveTools returns a new program without the named tool definitions.
+func (p *Program) RemoveTools(names ...string) *Program {
+	drop := make(map[string]bool, len(names))
+	for _, n := range names {
+		drop[n] = true
+	}
+	return p.KeepTools(func(name string) bool { return !drop[name] })
+}
+
+// RenameTool returns a new program in which the tool definition named old is
+// renamed to new, along with every CALL_NAME in the history that refers to it.
+func (p *Program) RenameTool(old, new string) *Program {
+	result := p.Clone()
+	for i, inst := range result.Code {
+		if (inst.Op == DEF_NAME || inst.Op == CALL_NAME) && inst.Str == old {
+			result.Code[i].Str = new
+		}
+	}
+	return result
+}
+
+// AddTool returns a new program with a tool definition added in its own DEF
+// block after the existing definitions (or before the first message). An
+// existing definition with the same name is replaced. desc and schema are
+// omitted when empty.
+func (p *Program) AddTool(name, desc string, schema json.RawMessage) *Program {
+	base := p.RemoveTools(name)
+
+	def := []Instruction{{Op: DEF_START}, {Op: DEF_NAME, Str: name}}
+	if desc != "" {
+		def = append(def, Instruction{Op: DEF_DESC, Str: desc})
+	}
+	if len(schema) > 0 {
+		def = append(def, Instruction{Op: DEF_SCHEMA, JSON: append(json.RawMessage(nil), schema...)})
+	}
+	def = append(def, Instruction{Op: DEF_END})
+
+	if defs := base.ToolDefs(); len(defs) > 0 {
+		return base.InsertAfter(defs[len(defs)-1].BlockEnd, def...)
+	}
+	if msgs := base.Messages(); len(msgs) > 0 {
+		return base.InsertBefore(msgs[0].Start, def...)
+	}
+	base.Code = append(base.Code, def...)
+	return base
+}
+
+// MergeToolDefs returns a new program whose tool definitions are gathered
+// into a single DEF block at the position of the first one. When several
+// definitions share a name the last one wins, keeping the position of the
+// first.
+func (p *Program) MergeToolDefs() *Program {
+	defs := p.ToolDefs()
+	if len(defs) == 0 {
+		return p.Clone()
+	}
+
+	var order []string
+	bodies := make(map[string][]Instruction)
+	remove := make(map[int]bool)
+	var header []Instruction // block-level instructions before the first DEF_NAME
+	for i, d := range defs {
+		if _, seen := bodies[d.Name]; !seen {
+			order = append(order, d.Name)
+		}
+		bodies[d.Name] = p.toolBody(d)
+		if i == 0 || d.BlockStart != defs[i-1].BlockStart {
+			first := d.Start
+			if first == d.BlockStart {
+				first++
+			}
+			for j := d.BlockStart + 1; j < first && p.Code[j].Op != DEF_NAME; j++ {
+				header = append(header, p.Code[j])
+			}
+			for j := d.BlockStart; j <= d.BlockEnd; j++ {
+				remove[j] = true
+			}
+		}
+	}
+
+	block := []Instruction{{Op: DEF_START}}
+	block = append(block, header...)
+	for _, name := range order {
+		block = append(block, bodies[name]...)
+	}
+	block = append(block, Instruction{Op: DEF_END})
+
+	result := NewProgram()
+	for i, inst := range p.Code {
+		if i == defs[0].BlockStart {
+			for _, b := range block {
+				result.Code = append(result.Code, cloneInstruction(b))
+			}
+		}
+		if !remove[i] {
+			result.Code = append(result.Code, cloneInstruction(inst))
+		}
+	}
+	result.Buffers = cloneBuffers(p.Buffers)
+	return result
+}
+
+// ─── Conversation turns ──────────────────────────────────────────────────────
+
+// AppendResponse returns the next request program: req followed by the
+// messages of the parsed response resp as assistant turns. Response metadata
+// (RESP_ID, RESP_MODEL, RESP_DONE, USAGE) and response-level extensions —
+// top-level EXT_DATA and EXT_DATA directly inside a message, such as Gemini
+// safetyRatings or OpenAI logprobs — are dropped, since providers reject
+// them in a request. Message content, thinking blocks (their signatures live
+// in THINK_REF buffers), tool calls, message-level meta and the extensions
+// inside those blocks are kept. Top-level reasoning blocks (Responses
+// reasoning items, with fields such as encrypted_content) open the assistant
+// turn that follows them. The new messages go right after the last message
+// of req, ahead of any trailing top-level instructions. Neither input is
+// modified.
+func AppendResponse(req, resp *Program) *Program {
+	at := len(req.Code)
+	if msgs := req.Messages(); len(msgs) > 0 {
+		at = msgs[len(msgs)-1].End + 1
+	}
+	return req.insertProgram(at, responseTurns(resp))
+}
+
+// responseTurns extracts the message blocks of a response program, without
+// response metadata or response-level extensions. Messages without a role
+// become assistant messages; top-level THINK blocks, with the extensions
+// that follow them, move to the start of the next message.
+func responseTurns(resp *Program) *Program {
+	out := NewProgram()
+	out.Buffers = resp.Buffers
+	msgs := resp.Messages()
+	var (
+		lead    []Instruction // top-level reasoning awaiting its message
+		inThink bool          // inside a top-level THINK block
+		trail   bool          // right after a top-level THINK block
+	)
+	for i := 0; i < len(resp.Code); i++ {
+		inst := resp.Code[i]
+		if len(msgs) > 0 && i == msgs[0].Start {
+			m := msgs[0]
+			msgs = msgs[1:]
+			role := m.Role
+			if role == 0 {
+				role = ROLE_AST
+			}
+			out.Code = append(out.Code, Instruction{Op: MSG_START}, Instruction{Op: role})
+			out.Code = append(out.Code, lead...)
+			lead, trail = nil, false
+			depth := 0 // open THINK, CALL and RESULT blocks
+			for _, in := range resp.Code[m.Start+1 : m.End+1] {
+				switch in.Op {
+				case ROLE_SYS, ROLE_USR, ROLE_AST, ROLE_TOOL, RESP_ID, RESP_MODEL, RESP_DONE, USAGE:
+					continue
+				case THINK_START, CALL_START, RESULT_START:
+					depth++
+				case THINK_END, CALL_END, RESULT_END:
+					depth--
+				case EXT_DATA:
+					if depth == 0 {
+						continue
+					}
+				}
+				out.Code = append(out.Code, in)
+			}
+			i = m.End
+			continue
+		}
+		switch {
+		case inst.Op == THINK_START || inThink:
+			lead = append(lead, inst)
+			inThink = inst.Op != THINK_END
+			trail = !inThink
+		case trail && (inst.Op == EXT_DATA || inst.Op == SET_META):
+			lead = append(lead, inst)
+		default:
+			trail = false
+		}
+	}
+	if len(lead) > 0 {
+		out.Code = append(out.Code, Instruction{Op: MSG_START}, Instruction{Op: ROLE_AST})
+		out.Code = append(out.Code, lead...)
+		out.Code = append(out.Code, Instruction{Op: MSG_END})
+	}
+	return out
+}
+
+// Fork returns a new program that keeps everything outside messages
+// (config, tool definitions, extensions) and messages 0..atMessage
+// inclusive, dropping the rest of the conversation. A negative atMessage
+// keeps no messages.
+func (p *Program) Fork(atMessage int) *Program {
+	msgs := p.Messages()
+	if atMessage >= len(msgs)-1 {
+		return p.Clone()
+	}
+	var drop []MessageSpan
+	if atMessage < 0 {
+		drop = msgs
+	} else {
+		drop = msgs[atMessage+1:]
+	}
+	return p.RemoveMessages(drop...)
+}
+
+// ReplaceLastAssistant returns a new program in which the last assistant
+// message, and any messages after it, are replaced by the messages of the
+// response program resp (as in AppendResponse). Without an assistant
+// message, resp is appended.
+func (p *Program) ReplaceLastAssistant(resp *Program) *Program {
+	asts := p.MessagesByRole(ROLE_AST)
+	if len(asts) == 0 {
+		return AppendResponse(p, resp)
+	}
+	msgs := p.Messages()
+	var drop []MessageSpan
+	for _, m := range msgs {
+		if m.Start >= asts[len(asts)-1].Start {
+			drop = append(drop, m)
+		}
+	}
+	// Nothing before the first dropped message is removed, so its start is
+	// also the insertion point in the trimmed program.
+	return p.RemoveMessages(drop...).insertProgram(drop[0].Start, responseTurns(resp))
+}
+
+// insertProgram returns a new program with other's instructions inserted at
+// index at. Buffers from other are re-indexed as in Append.
+func (p *Program) insertProgram(at int, other *Program) *Program {
+	joined := p.Append(other)
+	n := len(p.Code)
+	code := make([]Instruction, 0, len(joined.Code))
+	code = append(code, joined.Code[:at]...)
+	code = append(code, joined.Code[n:]...)
+	code = append(code, joined.Code[at:n]...)
+	joined.Code = code
+	return joined
+}
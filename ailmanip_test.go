@@ -2,6 +2,8 @@ package ail
 
 import (
 	"encoding/json"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -301,6 +303,132 @@ func TestToolDefs(t *testing.T) {
 	}
 }
 
+// parsedToolProgram parses a request so both tools share one DEF block.
+func parsedToolProgram(t *testing.T) *Program {
+	t.Helper()
+	body := `{"model":"gpt-4o","tools":[
+		{"type":"function","function":{"name":"get_weather","description":"Weather","parameters":{"type":"object"}}},
+		{"type":"function","function":{"name":"search","description":"Search"}},
+		{"type":"function","function":{"name":"db_query"}}],
+		"messages":[{"role":"user","content":"hi"},
+		{"role":"assistant","tool_calls":[{"id":"c1","type":"function","function":{"name":"search","arguments":"{}"}}]}]}`
+	p, err := (&ChatCompletionsParser{}).ParseRequest([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestToolDefsSharedBlock(t *testing.T) {
+	p := parsedToolProgram(t)
+	defs := p.ToolDefs()
+	if len(defs) != 3 || defs[1].Name != "search" {
+		t.Fatalf("defs = %+v", defs)
+	}
+	for i, d := range defs {
+		if p.Code[d.Start].Op != DEF_NAME || p.Code[d.BlockStart].Op != DEF_START || p.Code[d.BlockEnd].Op != DEF_END {
+			t.Errorf("def %d span = %+v", i, d)
+		}
+		if i > 0 && d.Start != defs[i-1].End+1 {
+			t.Errorf("def %d does not follow def %d", i, i-1)
+		}
+	}
+	if defs[2].End != defs[2].BlockEnd-1 {
+		t.Errorf("last def should end before DEF_END: %+v", defs[2])
+	}
+}
+
+func TestRemoveAndKeepTools(t *testing.T) {
+	for _, p := range []*Program{buildToolProgram(), parsedToolProgram(t)} {
+		out := p.RemoveTools("get_weather")
+		if defs := out.ToolDefs(); len(defs) == 0 || defs[0].Name != "search" {
+			t.Errorf("after RemoveTools: %+v", defs)
+		}
+		if out.FindAll(DEF_START) == nil || len(out.FindAll(DEF_START)) != len(out.FindAll(DEF_END)) {
+			t.Errorf("unbalanced DEF blocks:\n%s", out.Disasm())
+		}
+
+		none := p.KeepTools(func(string) bool { return false })
+		if none.HasOpcode(DEF_START) || none.HasOpcode(DEF_NAME) {
+			t.Errorf("KeepTools(false) left definitions:\n%s", none.Disasm())
+		}
+		if none.CountMessages() != p.CountMessages() {
+			t.Error("KeepTools dropped messages")
+		}
+	}
+}
+
+func TestRenameTool(t *testing.T) {
+	p := parsedToolProgram(t)
+	out := p.RenameTool("search", "web_search")
+	if out.ToolDefs()[1].Name != "web_search" || out.ToolCalls()[0].Name != "web_search" {
+		t.Errorf("rename not applied:\n%s", out.Disasm())
+	}
+	if p.ToolCalls()[0].Name != "search" {
+		t.Error("original program modified")
+	}
+}
+
+func TestAddTool(t *testing.T) {
+	p := buildToolProgram()
+	out := p.AddTool("lookup", "Look up", json.RawMessage(`{"type":"object"}`))
+	defs := out.ToolDefs()
+	if len(defs) != 3 || defs[2].Name != "lookup" || out.Code[defs[2].Start].Op != DEF_START {
+		t.Fatalf("defs = %+v", defs)
+	}
+	if defs[2].End >= out.Messages()[0].Start {
+		t.Error("new tool placed after messages")
+	}
+
+	// Re-adding replaces the existing definition.
+	out = out.AddTool("get_weather", "", nil)
+	defs = out.ToolDefs()
+	if len(defs) != 3 || defs[2].Name != "get_weather" || defs[2].End-defs[2].Start != 2 {
+		t.Errorf("replace: defs = %+v", defs)
+	}
+
+	empty := Build().User(Text("hi")).MustProgram().AddTool("f", "", nil)
+	if len(empty.ToolDefs()) != 1 || empty.ToolDefs()[0].End > empty.Messages()[0].Start {
+		t.Errorf("add to program without tools:\n%s", empty.Disasm())
+	}
+}
+
+func TestMergeToolDefs(t *testing.T) {
+	p := buildToolProgram().Append(parsedToolProgram(t))
+	out := p.MergeToolDefs()
+	if n := len(out.FindAll(DEF_START)); n != 1 {
+		t.Fatalf("expected one DEF block, got %d:\n%s", n, out.Disasm())
+	}
+	var names []string
+	for _, d := range out.ToolDefs() {
+		names = append(names, d.Name)
+	}
+	if strings.Join(names, ",") != "get_weather,search,db_query" {
+		t.Errorf("names = %v", names)
+	}
+	// The later get_weather definition (description "Weather") wins.
+	if d := out.ToolDefs()[0]; out.Code[d.Start+1].Str != "Weather" {
+		t.Errorf("expected last definition to win:\n%s", out.Disasm())
+	}
+	if out.CountMessages() != p.CountMessages() {
+		t.Error("messages lost")
+	}
+}
+
+func TestToolEditsCopyBuffers(t *testing.T) {
+	p := buildToolProgram().Append(Build().User(Image([]byte("aW1n"), "image/png")).MustProgram())
+	for name, out := range map[string]*Program{
+		"KeepTools":     p.KeepTools(func(string) bool { return true }),
+		"RemoveTools":   p.RemoveTools("search"),
+		"MergeToolDefs": p.MergeToolDefs(),
+	} {
+		out.Buffers[0][0] = 'X'
+		if string(p.Buffers[0]) != "aW1n" {
+			t.Fatalf("%s shares buffers with its input", name)
+		}
+	}
+}
+
 func TestToolCalls(t *testing.T) {
 	p := buildToolProgram()
 	calls := p.ToolCalls()
@@ -562,6 +690,142 @@ func TestAppendUserMessage(t *testing.T) {
 	}
 }
 
+// ─── Conversation turns ──────────────────────────────────────────────────────
+
+func TestAppendResponse(t *testing.T) {
+	req := Build().Model("m").Tools(Func("f", "", nil)).User(Text("hi")).MustProgram()
+	req.EmitExt(StyleChatCompletions, "user", json.RawMessage(`"u1"`))
+	resp := Build().ResponseID("r1").ResponseModel("m-2024").Usage(map[string]int{"total_tokens": 3}).
+		Assistant(Thinking("hmm", "sig"), ToolCall("c1", "f", map[string]int{"x": 1})).
+		Done("tool_calls").MustProgram()
+	resp.EmitExt(StyleChatCompletions, "object", json.RawMessage(`"chat.completion"`))
+
+	out := AppendResponse(req, resp)
+	for _, op := range []Opcode{RESP_ID, RESP_MODEL, RESP_DONE, USAGE} {
+		if out.HasOpcode(op) {
+			t.Errorf("%s kept:\n%s", op, out.Disasm())
+		}
+	}
+	if n := len(out.FindAll(DEF_START)); n != 1 || len(out.FindAll(SET_MODEL)) != 1 {
+		t.Errorf("config or defs duplicated:\n%s", out.Disasm())
+	}
+	msgs := out.Messages()
+	if len(msgs) != 2 || msgs[1].Role != ROLE_AST || len(out.ToolCalls()) != 1 {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	if last := out.Code[len(out.Code)-1]; last.Op != EXT_DATA || last.Key != "user" {
+		t.Errorf("request extension not kept last:\n%s", out.Disasm())
+	}
+	ref := out.Code[out.FindAll(THINK_REF)[0]].Ref
+	if string(out.Buffers[ref]) != "sig" {
+		t.Errorf("thinking signature buffer = %q", out.Buffers[ref])
+	}
+}
+
+func TestAppendResponseDropsResponseExtensions(t *testing.T) {
+	body, err := os.ReadFile("fixtures/genai/response/safety_settings.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&GoogleGenAIParser{}).ParseResponse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := Build().Model("gemini-1.5-pro").User(Text("hi")).MustProgram()
+	out, err := (&GoogleGenAIEmitter{}).EmitRequest(AppendResponse(req, resp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Contents []map[string]json.RawMessage `json:"contents"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Contents) != 2 {
+		t.Fatalf("contents = %s", out)
+	}
+	for key := range got.Contents[1] {
+		if key != "role" && key != "parts" {
+			t.Errorf("model turn carries response field %q:\n%s", key, out)
+		}
+	}
+}
+
+func TestAppendResponseKeepsBlockExtensions(t *testing.T) {
+	body, err := os.ReadFile("fixtures/responses/response/reasoning.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&ResponsesParser{}).ParseResponse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := Build().Assistant(ToolCall("toolu_1", "f", map[string]int{"x": 1})).MustProgram()
+	at := call.FindAll(CALL_END)[0]
+	call.Code = append(call.Code[:at], append([]Instruction{{Op: EXT_DATA, NS: StyleAnthropic, Key: "caller", JSON: json.RawMessage(`{"type":"direct"}`)}}, call.Code[at:]...)...)
+	call.EmitExt(StyleAnthropic, "stop_sequence", json.RawMessage(`null`))
+
+	req := Build().Model("o4-mini").User(Text("6*7?")).MustProgram()
+	out := AppendResponse(AppendResponse(req, resp), call)
+	conv, err := out.Decompile()
+	if err != nil {
+		t.Fatalf("decompile:\n%s\n%v", out.Disasm(), err)
+	}
+	if len(conv.Messages) != 3 {
+		t.Fatalf("messages:\n%s", out.Disasm())
+	}
+	ast := conv.Messages[1]
+	if ast.Role != ROLE_AST || len(ast.Parts) != 2 || ast.Parts[0].Type != PartThinking || ast.Text() != "6 × 7 = 42." {
+		t.Fatalf("assistant turn:\n%s", out.Disasm())
+	}
+	if x := ast.Parts[0].Extensions; len(x) != 1 || x[0].Key != "encrypted_content" {
+		t.Errorf("reasoning extensions = %+v", x)
+	}
+	if len(ast.Extensions) != 0 {
+		t.Errorf("message item extensions kept: %+v", ast.Extensions)
+	}
+	if x := conv.Messages[2].Parts[0].Extensions; len(x) != 1 || x[0].Key != "caller" {
+		t.Errorf("call extensions = %+v", x)
+	}
+	if len(conv.Extensions) != 0 {
+		t.Errorf("response extensions kept: %+v", conv.Extensions)
+	}
+}
+
+func TestForkAndReplaceLastAssistant(t *testing.T) {
+	p := Build().Model("m").
+		System("sys").
+		User(Text("q1")).
+		Assistant(Text("a1")).
+		User(Text("q2")).
+		Assistant(Text("a2")).
+		MustProgram()
+
+	f := p.Fork(2)
+	if f.CountMessages() != 3 || f.GetModel() != "m" || f.MessageText(f.Messages()[2]) != "a1" {
+		t.Errorf("Fork(2):\n%s", f.Disasm())
+	}
+	if p.Fork(-1).CountMessages() != 0 || p.Fork(10).CountMessages() != 5 {
+		t.Error("Fork bounds")
+	}
+
+	resp := Build().ResponseID("r").Assistant(Text("a2'")).Done("stop").MustProgram()
+	r := p.ReplaceLastAssistant(resp)
+	msgs := r.Messages()
+	if len(msgs) != 5 || r.MessageText(msgs[4]) != "a2'" || r.HasOpcode(RESP_ID) {
+		t.Errorf("ReplaceLastAssistant:\n%s", r.Disasm())
+	}
+
+	// Messages after the last assistant turn are dropped with it.
+	withResult := AppendResponse(p, Build().Assistant(ToolCall("c", "f", nil)).MustProgram()).
+		Append(Build().Tool(Result("c", "ok")).MustProgram())
+	r = withResult.ReplaceLastAssistant(resp)
+	if r.CountMessages() != 6 || r.HasOpcode(RESULT_START) || r.HasOpcode(CALL_START) {
+		t.Errorf("ReplaceLastAssistant with trailing results:\n%s", r.Disasm())
+	}
+}
+
 // ─── Immutability checks ────────────────────────────────────────────────────
 
 func TestManipulationsAreImmutable(t *testing.T) {
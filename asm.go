@@ -24,9 +24,9 @@ var stringArgOps = map[Opcode]bool{
 	TXT_CHUNK: true, DEF_NAME: true, DEF_DESC: true,
 	CALL_START: true, CALL_NAME: true,
 	RESULT_START: true, RESULT_DATA: true,
-	RESP_ID: true, RESP_MODEL: true, RESP_DONE: true,
+	RESP_ID: true, RESP_MODEL: true,
 	SET_MODEL: true, SET_STOP: true, STREAM_DELTA: true,
-	THINK_CHUNK: true, STREAM_THINK_DELTA: true,
+	THINK_CHUNK: true, STREAM_THINK_DELTA: true, STREAM_THINK_SIG: true,
 }
 
 // opcodes that take a float64 argument.
@@ -41,7 +41,8 @@ var intArgOps = map[Opcode]bool{
 
 // opcodes that take a raw JSON argument.
 var jsonArgOps = map[Opcode]bool{
-	DEF_SCHEMA: true, CALL_ARGS: true, USAGE: true, STREAM_TOOL_DELTA: true,
+	DEF_SCHEMA: true, CALL_ARGS: true, USAGE: true, RESP_ERROR: true, STREAM_TOOL_DELTA: true,
+	STREAM_BLOCK_START: true, STREAM_BLOCK_END: true, STREAM_ERROR: true,
 	SET_THINK: true, SET_FMT: true,
 }
 
@@ -67,6 +68,15 @@ var refArgOps = map[Opcode]bool{
 // lines are taken verbatim — indentation is NOT stripped — so the value
 // preserves exactly the bytes between the <<< and >>> markers.
 //
+// EXT_DATA takes an optional namespace before the key, written as "@style":
+//
+//	EXT_DATA @anthropic-messages cache_control {"type":"ephemeral"}
+//
+// RESP_DONE takes the canonical finish reason, optionally followed by the
+// namespace and native value it was parsed from:
+//
+//	RESP_DONE tool_calls @google-genai STOP
+//
 // This is the inverse of Program.Disasm().
 func Asm(text string) (*Program, error) {
 	prog := NewProgram()
@@ -194,8 +204,22 @@ func Asm(text string) (*Program, error) {
 			}
 			prog.EmitKeyVal(op, key, val)
 
+		case op == RESP_DONE:
+			reason, native := splitFirst(strings.TrimSpace(rest))
+			inst := Instruction{Op: RESP_DONE, Str: reason}
+			if strings.HasPrefix(native, "@") {
+				ns, val := splitFirst(native[1:])
+				inst.NS, inst.Key = Style(ns), val
+			}
+			prog.Code = append(prog.Code, inst)
+
 		case op == EXT_DATA:
 			key, j := splitFirst(rest)
+			var ns Style
+			if strings.HasPrefix(key, "@") {
+				ns = Style(key[1:])
+				key, j = splitFirst(j)
+			}
 			if key == "" {
 				return nil, fmt.Errorf("line %d: EXT_DATA requires key and JSON", i+1)
 			}
@@ -214,7 +238,7 @@ func Asm(text string) (*Program, error) {
 			if !json.Valid([]byte(j)) {
 				return nil, fmt.Errorf("line %d: EXT_DATA invalid JSON: %s", i+1, j)
 			}
-			prog.EmitKeyJSON(op, key, json.RawMessage(j))
+			prog.EmitExt(ns, key, json.RawMessage(j))
 
 		default:
 			// No-arg opcodes: MSG_START, MSG_END, ROLE_*, SET_STREAM, DEF_START, DEF_END, etc.
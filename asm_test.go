@@ -136,6 +136,27 @@ func TestAsmExtData(t *testing.T) {
 	}
 }
 
+func TestAsmExtDataNamespace(t *testing.T) {
+	text := `EXT_DATA @anthropic-messages cache_control {"type":"ephemeral"}
+`
+	prog, err := Asm(text)
+	if err != nil {
+		t.Fatalf("Asm failed: %v", err)
+	}
+
+	inst := prog.Code[0]
+	if inst.NS != StyleAnthropic || inst.Key != "cache_control" {
+		t.Errorf("EXT_DATA: %+v", inst)
+	}
+	if string(inst.JSON) != `{"type":"ephemeral"}` {
+		t.Errorf("EXT_DATA JSON: %s", inst.JSON)
+	}
+
+	if got := prog.Disasm(); got != text {
+		t.Errorf("Disasm round-trip:\n got %q\nwant %q", got, text)
+	}
+}
+
 func TestAsmRefs(t *testing.T) {
 	text := `IMG_REF ref:0
 AUD_REF ref:1
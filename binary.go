@@ -11,7 +11,10 @@ import (
 // Binary format constants.
 var binaryMagic = [4]byte{'A', 'I', 'L', 0x00}
 
-const binaryVersion uint8 = 1
+// binaryVersion is the version written by Encode. Decode also accepts
+// version 1, which predates EXT_DATA namespaces, and version 2, which
+// predates native finish values on RESP_DONE.
+const binaryVersion uint8 = 3
 
 // ─── Binary Encoder ──────────────────────────────────────────────────────────
 
@@ -20,6 +23,10 @@ const binaryVersion uint8 = 1
 // Wire layout:
 //
 //	[magic 4B][version 1B][bufCount uint32][buf0Len uint32][buf0 data]…[instructions…]
+//
+// EXT_DATA is encoded as key, namespace and JSON (the namespace was added in
+// version 2). RESP_DONE is encoded as reason, native value and namespace
+// (the last two were added in version 3).
 func (p *Program) Encode(w io.Writer) error {
 	// Header
 	if _, err := w.Write(binaryMagic[:]); err != nil {
@@ -40,72 +47,101 @@ func (p *Program) Encode(w io.Writer) error {
 	}
 
 	// Instructions
-	for _, inst := range p.Code {
-		if _, err := w.Write([]byte{byte(inst.Op)}); err != nil {
-			return err
+	for i, inst := range p.Code {
+		if err := encodeInstruction(w, inst); err != nil {
+			return fmt.Errorf("ail.Encode: instruction %d: %w", i, err)
 		}
-		switch inst.Op {
-		// No-arg opcodes
-		case MSG_START, MSG_END, ROLE_SYS, ROLE_USR, ROLE_AST, ROLE_TOOL,
-			DEF_START, DEF_END, CALL_END, RESULT_END,
-			SET_STREAM, STREAM_START, STREAM_END,
-			THINK_START, THINK_END:
-			// nothing extra
+	}
+	return nil
+}
 
-		// String arg
-		case TXT_CHUNK, DEF_NAME, DEF_DESC, CALL_START, CALL_NAME,
-			RESULT_START, RESULT_DATA, RESP_ID, RESP_MODEL, RESP_DONE,
-			SET_MODEL, SET_STOP, STREAM_DELTA,
-			THINK_CHUNK, STREAM_THINK_DELTA:
-			if err := writeString(w, inst.Str); err != nil {
-				return err
-			}
+// encodeInstruction writes a single instruction (opcode byte + arguments).
+func encodeInstruction(w io.Writer, inst Instruction) error {
+	if _, err := w.Write([]byte{byte(inst.Op)}); err != nil {
+		return err
+	}
+	return encodeArgs(w, inst)
+}
 
-		// Float arg
-		case SET_TEMP, SET_TOPP:
-			if err := writeFloat64(w, inst.Num); err != nil {
-				return err
-			}
+// encodeArgs writes the arguments of inst according to its opcode.
+func encodeArgs(w io.Writer, inst Instruction) error {
+	switch inst.Op {
+	// No-arg opcodes
+	case MSG_START, MSG_END, ROLE_SYS, ROLE_USR, ROLE_AST, ROLE_TOOL,
+		DEF_START, DEF_END, CALL_END, RESULT_END,
+		SET_STREAM, STREAM_START, STREAM_END,
+		THINK_START, THINK_END:
+		// nothing extra
+
+	// String arg
+	case TXT_CHUNK, DEF_NAME, DEF_DESC, CALL_START, CALL_NAME,
+		RESULT_START, RESULT_DATA, RESP_ID, RESP_MODEL,
+		SET_MODEL, SET_STOP, STREAM_DELTA,
+		THINK_CHUNK, STREAM_THINK_DELTA, STREAM_THINK_SIG:
+		if err := writeString(w, inst.Str); err != nil {
+			return err
+		}
 
-		// Int arg
-		case SET_MAX:
-			if err := writeInt32(w, inst.Int); err != nil {
-				return err
-			}
+	// Float arg
+	case SET_TEMP, SET_TOPP:
+		if err := writeFloat64(w, inst.Num); err != nil {
+			return err
+		}
 
-		// JSON arg
-		case DEF_SCHEMA, CALL_ARGS, USAGE, STREAM_TOOL_DELTA, SET_THINK, SET_FMT:
-			if err := writeBytes(w, inst.JSON); err != nil {
-				return err
-			}
+	// Int arg
+	case SET_MAX:
+		if err := writeInt32(w, inst.Int); err != nil {
+			return err
+		}
 
-		// RefID arg
-		case IMG_REF, AUD_REF, TXT_REF, THINK_REF:
-			if err := writeUint32(w, inst.Ref); err != nil {
-				return err
-			}
+	// JSON arg
+	case DEF_SCHEMA, CALL_ARGS, USAGE, RESP_ERROR, STREAM_TOOL_DELTA, STREAM_BLOCK_START, STREAM_BLOCK_END, STREAM_ERROR,
+		SET_THINK, SET_FMT:
+		if err := writeBytes(w, inst.JSON); err != nil {
+			return err
+		}
 
-		// Key + Val (two strings)
-		case SET_META:
-			if err := writeString(w, inst.Key); err != nil {
-				return err
-			}
-			if err := writeString(w, inst.Str); err != nil {
-				return err
-			}
+	// RefID arg
+	case IMG_REF, AUD_REF, TXT_REF, THINK_REF:
+		if err := writeUint32(w, inst.Ref); err != nil {
+			return err
+		}
 
-		// Key + JSON
-		case EXT_DATA:
-			if err := writeString(w, inst.Key); err != nil {
-				return err
-			}
-			if err := writeBytes(w, inst.JSON); err != nil {
-				return err
-			}
+	// Key + Val (two strings)
+	case SET_META:
+		if err := writeString(w, inst.Key); err != nil {
+			return err
+		}
+		if err := writeString(w, inst.Str); err != nil {
+			return err
+		}
 
-		default:
-			return fmt.Errorf("ail.Encode: unknown opcode 0x%02X", inst.Op)
+	// Reason + Native + Namespace
+	case RESP_DONE:
+		if err := writeString(w, inst.Str); err != nil {
+			return err
+		}
+		if err := writeString(w, inst.Key); err != nil {
+			return err
 		}
+		if err := writeString(w, string(inst.NS)); err != nil {
+			return err
+		}
+
+	// Key + Namespace + JSON
+	case EXT_DATA:
+		if err := writeString(w, inst.Key); err != nil {
+			return err
+		}
+		if err := writeString(w, string(inst.NS)); err != nil {
+			return err
+		}
+		if err := writeBytes(w, inst.JSON); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown opcode 0x%02X", byte(inst.Op))
 	}
 	return nil
 }
@@ -123,8 +159,9 @@ func Decode(r io.Reader) (*Program, error) {
 		header[2] != binaryMagic[2] || header[3] != binaryMagic[3] {
 		return nil, fmt.Errorf("ail.Decode: invalid magic bytes %q", header[:4])
 	}
-	if header[4] != binaryVersion {
-		return nil, fmt.Errorf("ail.Decode: unsupported version %d (want %d)", header[4], binaryVersion)
+	version := header[4]
+	if version < 1 || version > binaryVersion {
+		return nil, fmt.Errorf("ail.Decode: unsupported version %d (want <= %d)", version, binaryVersion)
 	}
 
 	// Buffers
@@ -166,9 +203,9 @@ func Decode(r io.Reader) (*Program, error) {
 
 		// String arg
 		case TXT_CHUNK, DEF_NAME, DEF_DESC, CALL_START, CALL_NAME,
-			RESULT_START, RESULT_DATA, RESP_ID, RESP_MODEL, RESP_DONE,
+			RESULT_START, RESULT_DATA, RESP_ID, RESP_MODEL,
 			SET_MODEL, SET_STOP, STREAM_DELTA,
-			THINK_CHUNK, STREAM_THINK_DELTA:
+			THINK_CHUNK, STREAM_THINK_DELTA, STREAM_THINK_SIG:
 			s, err := readString(r)
 			if err != nil {
 				return nil, fmt.Errorf("ail.Decode %s: %w", op.Name(), err)
@@ -192,7 +229,8 @@ func Decode(r io.Reader) (*Program, error) {
 			inst.Int = i
 
 		// JSON arg
-		case DEF_SCHEMA, CALL_ARGS, USAGE, STREAM_TOOL_DELTA, SET_THINK, SET_FMT:
+		case DEF_SCHEMA, CALL_ARGS, USAGE, RESP_ERROR, STREAM_TOOL_DELTA, STREAM_BLOCK_START, STREAM_BLOCK_END, STREAM_ERROR,
+			SET_THINK, SET_FMT:
 			b, err := readBytes(r)
 			if err != nil {
 				return nil, fmt.Errorf("ail.Decode %s: %w", op.Name(), err)
@@ -220,12 +258,38 @@ func Decode(r io.Reader) (*Program, error) {
 			inst.Key = k
 			inst.Str = v
 
-		// Key + JSON
+		// Reason + Native and Namespace (v3+)
+		case RESP_DONE:
+			s, err := readString(r)
+			if err != nil {
+				return nil, fmt.Errorf("ail.Decode RESP_DONE: %w", err)
+			}
+			inst.Str = s
+			if version >= 3 {
+				native, err := readString(r)
+				if err != nil {
+					return nil, fmt.Errorf("ail.Decode RESP_DONE native: %w", err)
+				}
+				ns, err := readString(r)
+				if err != nil {
+					return nil, fmt.Errorf("ail.Decode RESP_DONE namespace: %w", err)
+				}
+				inst.Key, inst.NS = native, Style(ns)
+			}
+
+		// Key + Namespace (v2+) + JSON
 		case EXT_DATA:
 			k, err := readString(r)
 			if err != nil {
 				return nil, fmt.Errorf("ail.Decode EXT_DATA key: %w", err)
 			}
+			if version >= 2 {
+				ns, err := readString(r)
+				if err != nil {
+					return nil, fmt.Errorf("ail.Decode EXT_DATA namespace: %w", err)
+				}
+				inst.NS = Style(ns)
+			}
 			b, err := readBytes(r)
 			if err != nil {
 				return nil, fmt.Errorf("ail.Decode EXT_DATA json: %w", err)
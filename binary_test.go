@@ -46,6 +46,9 @@ func TestBinaryRoundTrip(t *testing.T) {
 	// Meta and ext
 	orig.EmitKeyVal(SET_META, "user", "test-user")
 	orig.EmitJSON(SET_FMT, json.RawMessage(`{"type":"json_object"}`))
+	orig.EmitExt(StyleAnthropic, "cache_control", json.RawMessage(`{"type":"ephemeral"}`))
+	orig.EmitKeyJSON(EXT_DATA, "seed", json.RawMessage(`42`))
+	orig.emitFinish(StyleGoogleGenAI, "SAFETY", false)
 
 	// Encode
 	var buf bytes.Buffer
@@ -94,6 +97,9 @@ func TestBinaryRoundTrip(t *testing.T) {
 		if got.Ref != want.Ref {
 			t.Errorf("inst %d (%s): ref %d != %d", i, want.Op, got.Ref, want.Ref)
 		}
+		if got.NS != want.NS {
+			t.Errorf("inst %d (%s): ns %q != %q", i, want.Op, got.NS, want.NS)
+		}
 		if string(got.JSON) != string(want.JSON) {
 			t.Errorf("inst %d (%s): json %s != %s", i, want.Op, got.JSON, want.JSON)
 		}
@@ -115,3 +121,44 @@ func TestBinaryInvalidVersion(t *testing.T) {
 		t.Fatal("expected error for unsupported version")
 	}
 }
+
+func TestBinaryDecodeVersion1ExtData(t *testing.T) {
+	// Version 1 encoded EXT_DATA as key + JSON, without a namespace.
+	var buf bytes.Buffer
+	buf.Write([]byte{'A', 'I', 'L', 0x00, 0x01, 0, 0, 0, 0})
+	buf.WriteByte(byte(EXT_DATA))
+	writeString(&buf, "seed")
+	writeBytes(&buf, []byte(`42`))
+
+	prog, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(prog.Code) != 1 {
+		t.Fatalf("instruction count: got %d, want 1", len(prog.Code))
+	}
+	inst := prog.Code[0]
+	if inst.Key != "seed" || string(inst.JSON) != "42" || inst.NS != "" {
+		t.Errorf("EXT_DATA: %+v", inst)
+	}
+}
+
+func TestBinaryDecodeVersion2RespDone(t *testing.T) {
+	// Version 2 encoded RESP_DONE as a single string.
+	var buf bytes.Buffer
+	buf.Write([]byte{'A', 'I', 'L', 0x00, 0x02, 0, 0, 0, 0})
+	buf.WriteByte(byte(RESP_DONE))
+	writeString(&buf, "stop")
+	buf.WriteByte(byte(MSG_END))
+
+	prog, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(prog.Code) != 2 {
+		t.Fatalf("instruction count: got %d, want 2", len(prog.Code))
+	}
+	if inst := prog.Code[0]; inst.Str != "stop" || inst.Key != "" || inst.NS != "" {
+		t.Errorf("RESP_DONE: %+v", inst)
+	}
+}
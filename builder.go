@@ -0,0 +1,365 @@
+package ail
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ─── Builder ─────────────────────────────────────────────────────────────────
+
+// Builder constructs a Program through a fluent, typed API. Every message,
+// tool definition, tool call and thinking block it writes is emitted as a
+// balanced START/END pair, and media payloads are stored in the program's
+// side-buffer automatically.
+//
+//	prog, err := ail.Build().
+//		Model("gpt-4o").
+//		System("You are terse.").
+//		User(ail.Text("What is in this image?"), ail.Image(data, "image/png")).
+//		Assistant(ail.ToolCall("call_1", "lookup", map[string]any{"q": "cat"})).
+//		Tool(ail.Result("call_1", `{"answer":"a cat"}`)).
+//		Program()
+//
+// The first error encountered (for example, tool-call arguments that cannot
+// be marshaled to JSON) is recorded and returned by Program; subsequent calls
+// become no-ops.
+type Builder struct {
+	prog *Program
+	err  error
+}
+
+// Build starts a new, empty program builder.
+func Build() *Builder {
+	return &Builder{prog: NewProgram()}
+}
+
+// Program returns the built program, or the first error recorded while
+// building it. The builder must not be used after Program is called.
+func (b *Builder) Program() (*Program, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.prog, nil
+}
+
+// MustProgram is like Program but panics on error. Intended for tests and
+// static fixtures.
+func (b *Builder) MustProgram() *Program {
+	p, err := b.Program()
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// fail records the first error; later errors are dropped.
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// ─── Configuration ───────────────────────────────────────────────────────────
+
+// Model emits SET_MODEL.
+func (b *Builder) Model(model string) *Builder {
+	b.prog.EmitString(SET_MODEL, model)
+	return b
+}
+
+// Temperature emits SET_TEMP.
+func (b *Builder) Temperature(t float64) *Builder {
+	b.prog.EmitFloat(SET_TEMP, t)
+	return b
+}
+
+// TopP emits SET_TOPP.
+func (b *Builder) TopP(p float64) *Builder {
+	b.prog.EmitFloat(SET_TOPP, p)
+	return b
+}
+
+// MaxTokens emits SET_MAX.
+func (b *Builder) MaxTokens(n int32) *Builder {
+	b.prog.EmitInt(SET_MAX, n)
+	return b
+}
+
+// Stop emits one SET_STOP per stop sequence.
+func (b *Builder) Stop(sequences ...string) *Builder {
+	for _, s := range sequences {
+		b.prog.EmitString(SET_STOP, s)
+	}
+	return b
+}
+
+// Stream emits SET_STREAM.
+func (b *Builder) Stream() *Builder {
+	b.prog.Emit(SET_STREAM)
+	return b
+}
+
+// Thinking emits SET_THINK with the given configuration, which is marshaled
+// to JSON unless it already is a json.RawMessage.
+func (b *Builder) Thinking(cfg any) *Builder {
+	if j, ok := b.marshal("thinking config", cfg); ok {
+		b.prog.EmitJSON(SET_THINK, j)
+	}
+	return b
+}
+
+// Format emits SET_FMT with the given response-format configuration.
+func (b *Builder) Format(cfg any) *Builder {
+	if j, ok := b.marshal("response format", cfg); ok {
+		b.prog.EmitJSON(SET_FMT, j)
+	}
+	return b
+}
+
+// Meta emits SET_META key=val.
+func (b *Builder) Meta(key, val string) *Builder {
+	b.prog.EmitKeyVal(SET_META, key, val)
+	return b
+}
+
+// Ext emits an untagged EXT_DATA instruction, applied by every emitter.
+func (b *Builder) Ext(key string, val any) *Builder {
+	return b.ExtFor("", key, val)
+}
+
+// ExtFor emits an EXT_DATA instruction tagged with the namespace ns, so that
+// only emitters of that style (or ones that accept it) apply it.
+func (b *Builder) ExtFor(ns Style, key string, val any) *Builder {
+	if j, ok := b.marshal("extension "+key, val); ok {
+		b.prog.EmitExt(ns, key, j)
+	}
+	return b
+}
+
+// ─── Tool definitions ────────────────────────────────────────────────────────
+
+// ToolDef describes a function tool for Builder.Tools.
+type ToolDef struct {
+	Name        string
+	Description string
+	Schema      any // JSON schema; marshaled unless already json.RawMessage
+}
+
+// Func returns a ToolDef for a function tool.
+func Func(name, description string, schema any) ToolDef {
+	return ToolDef{Name: name, Description: description, Schema: schema}
+}
+
+// Tools emits one DEF_START…DEF_END block per definition.
+func (b *Builder) Tools(defs ...ToolDef) *Builder {
+	for _, d := range defs {
+		b.prog.Emit(DEF_START)
+		b.prog.EmitString(DEF_NAME, d.Name)
+		if d.Description != "" {
+			b.prog.EmitString(DEF_DESC, d.Description)
+		}
+		if d.Schema != nil {
+			if j, ok := b.marshal("schema for tool "+d.Name, d.Schema); ok {
+				b.prog.EmitJSON(DEF_SCHEMA, j)
+			}
+		}
+		b.prog.Emit(DEF_END)
+	}
+	return b
+}
+
+// ─── Messages ────────────────────────────────────────────────────────────────
+
+// System appends a system message containing the given text.
+func (b *Builder) System(text string) *Builder {
+	return b.Message(ROLE_SYS, Text(text))
+}
+
+// User appends a user message built from parts.
+func (b *Builder) User(parts ...Part) *Builder {
+	return b.Message(ROLE_USR, parts...)
+}
+
+// Assistant appends an assistant message built from parts.
+func (b *Builder) Assistant(parts ...Part) *Builder {
+	return b.Message(ROLE_AST, parts...)
+}
+
+// Tool appends a tool-role message built from parts (typically Result).
+func (b *Builder) Tool(parts ...Part) *Builder {
+	return b.Message(ROLE_TOOL, parts...)
+}
+
+// Message appends a MSG_START…MSG_END block with the given role opcode.
+// Nil parts are skipped.
+func (b *Builder) Message(role Opcode, parts ...Part) *Builder {
+	switch role {
+	case ROLE_SYS, ROLE_USR, ROLE_AST, ROLE_TOOL:
+	default:
+		b.fail(fmt.Errorf("ail: builder: %s is not a role opcode", role))
+		return b
+	}
+	b.prog.Emit(MSG_START)
+	b.prog.Emit(role)
+	for _, part := range parts {
+		if part == nil {
+			continue
+		}
+		part.emitPart(b)
+	}
+	b.prog.Emit(MSG_END)
+	return b
+}
+
+// ─── Response metadata ───────────────────────────────────────────────────────
+
+// ResponseID emits RESP_ID.
+func (b *Builder) ResponseID(id string) *Builder {
+	b.prog.EmitString(RESP_ID, id)
+	return b
+}
+
+// ResponseModel emits RESP_MODEL.
+func (b *Builder) ResponseModel(model string) *Builder {
+	b.prog.EmitString(RESP_MODEL, model)
+	return b
+}
+
+// Done attaches a RESP_DONE finish reason to the most recent message. If the
+// program does not end with a message, RESP_DONE is appended as-is.
+func (b *Builder) Done(reason string) *Builder {
+	n := len(b.prog.Code)
+	if n > 0 && b.prog.Code[n-1].Op == MSG_END {
+		b.prog.Code = append(b.prog.Code[:n-1], Instruction{Op: RESP_DONE, Str: reason}, Instruction{Op: MSG_END})
+		return b
+	}
+	b.prog.EmitString(RESP_DONE, reason)
+	return b
+}
+
+// Usage emits USAGE with the given statistics.
+func (b *Builder) Usage(usage any) *Builder {
+	if j, ok := b.marshal("usage", usage); ok {
+		b.prog.EmitJSON(USAGE, j)
+	}
+	return b
+}
+
+// marshal converts v to JSON, passing json.RawMessage through unchanged.
+func (b *Builder) marshal(what string, v any) (json.RawMessage, bool) {
+	if b.err != nil {
+		return nil, false
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw, true
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		b.fail(fmt.Errorf("ail: builder: marshal %s: %w", what, err))
+		return nil, false
+	}
+	return j, true
+}
+
+// ─── Parts ───────────────────────────────────────────────────────────────────
+
+// Part is a piece of message content accepted by Builder.Message and the
+// role helpers. Construct parts with Text, Image, Audio, Thinking, ToolCall
+// and Result.
+type Part interface {
+	emitPart(b *Builder)
+}
+
+type textPart string
+
+func (p textPart) emitPart(b *Builder) { b.prog.EmitString(TXT_CHUNK, string(p)) }
+
+// Text is a TXT_CHUNK part.
+func Text(s string) Part { return textPart(s) }
+
+type mediaPart struct {
+	op        Opcode
+	data      []byte
+	mediaType string
+}
+
+func (p mediaPart) emitPart(b *Builder) {
+	ref := b.prog.AddBuffer(p.data)
+	if p.mediaType != "" {
+		b.prog.EmitKeyVal(SET_META, "media_type", p.mediaType)
+	}
+	b.prog.EmitRef(p.op, ref)
+}
+
+// Image is an IMG_REF part. data is stored verbatim in the side-buffer, as
+// the parsers do: a base64 payload, a data: URI, or a URL. mediaType may be
+// empty (e.g. for URLs).
+func Image(data []byte, mediaType string) Part {
+	return mediaPart{op: IMG_REF, data: data, mediaType: mediaType}
+}
+
+// Audio is an AUD_REF part; data is a base64 payload stored verbatim.
+func Audio(data []byte, mediaType string) Part {
+	return mediaPart{op: AUD_REF, data: data, mediaType: mediaType}
+}
+
+type thinkingPart struct {
+	text      string
+	signature string
+}
+
+func (p thinkingPart) emitPart(b *Builder) {
+	b.prog.Emit(THINK_START)
+	if p.text != "" {
+		b.prog.EmitString(THINK_CHUNK, p.text)
+	}
+	if p.signature != "" {
+		b.prog.EmitRef(THINK_REF, b.prog.AddBuffer([]byte(p.signature)))
+	}
+	b.prog.Emit(THINK_END)
+}
+
+// Thinking is a THINK_START…THINK_END part. A non-empty signature is stored
+// as an opaque THINK_REF blob.
+func Thinking(text, signature string) Part {
+	return thinkingPart{text: text, signature: signature}
+}
+
+type toolCallPart struct {
+	id   string
+	name string
+	args any
+}
+
+func (p toolCallPart) emitPart(b *Builder) {
+	j, ok := b.marshal("arguments for call "+p.id, p.args)
+	if !ok {
+		return
+	}
+	b.prog.EmitString(CALL_START, p.id)
+	b.prog.EmitString(CALL_NAME, p.name)
+	b.prog.EmitJSON(CALL_ARGS, j)
+	b.prog.Emit(CALL_END)
+}
+
+// ToolCall is a CALL_START…CALL_END part. args is marshaled to JSON unless it
+// already is a json.RawMessage.
+func ToolCall(id, name string, args any) Part {
+	return toolCallPart{id: id, name: name, args: args}
+}
+
+type resultPart struct {
+	id   string
+	data string
+}
+
+func (p resultPart) emitPart(b *Builder) {
+	b.prog.EmitString(RESULT_START, p.id)
+	b.prog.EmitString(RESULT_DATA, p.data)
+	b.prog.Emit(RESULT_END)
+}
+
+// Result is a RESULT_START…RESULT_END part answering the call with the given ID.
+func Result(callID, data string) Part {
+	return resultPart{id: callID, data: data}
+}
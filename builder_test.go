@@ -0,0 +1,122 @@
+package ail
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBuilderMatchesHandEmitted(t *testing.T) {
+	got := Build().
+		Model("claude-3").
+		Temperature(0.5).
+		MaxTokens(1024).
+		Stop("END").
+		Stream().
+		System("Be brief.").
+		User(Text("Describe this"), Image([]byte("aGVsbG8="), "image/png")).
+		Assistant(
+			Thinking("Looking at it", "sig-1"),
+			ToolCall("call_1", "describe", map[string]string{"detail": "high"}),
+		).
+		Tool(Result("call_1", "a cat")).
+		MustProgram()
+
+	want := NewProgram()
+	want.EmitString(SET_MODEL, "claude-3")
+	want.EmitFloat(SET_TEMP, 0.5)
+	want.EmitInt(SET_MAX, 1024)
+	want.EmitString(SET_STOP, "END")
+	want.Emit(SET_STREAM)
+	want.Emit(MSG_START)
+	want.Emit(ROLE_SYS)
+	want.EmitString(TXT_CHUNK, "Be brief.")
+	want.Emit(MSG_END)
+	want.Emit(MSG_START)
+	want.Emit(ROLE_USR)
+	want.EmitString(TXT_CHUNK, "Describe this")
+	img := want.AddBuffer([]byte("aGVsbG8="))
+	want.EmitKeyVal(SET_META, "media_type", "image/png")
+	want.EmitRef(IMG_REF, img)
+	want.Emit(MSG_END)
+	want.Emit(MSG_START)
+	want.Emit(ROLE_AST)
+	want.Emit(THINK_START)
+	want.EmitString(THINK_CHUNK, "Looking at it")
+	sig := want.AddBuffer([]byte("sig-1"))
+	want.EmitRef(THINK_REF, sig)
+	want.Emit(THINK_END)
+	want.EmitString(CALL_START, "call_1")
+	want.EmitString(CALL_NAME, "describe")
+	want.EmitJSON(CALL_ARGS, json.RawMessage(`{"detail":"high"}`))
+	want.Emit(CALL_END)
+	want.Emit(MSG_END)
+	want.Emit(MSG_START)
+	want.Emit(ROLE_TOOL)
+	want.EmitString(RESULT_START, "call_1")
+	want.EmitString(RESULT_DATA, "a cat")
+	want.Emit(RESULT_END)
+	want.Emit(MSG_END)
+
+	if g, w := got.Disasm(), want.Disasm(); g != w {
+		t.Fatalf("builder output differs:\n--- got ---\n%s\n--- want ---\n%s", g, w)
+	}
+}
+
+func TestBuilderDoneInsideMessage(t *testing.T) {
+	prog := Build().
+		ResponseID("resp_1").
+		ResponseModel("gpt-4o").
+		Assistant(Text("hi")).
+		Done("stop").
+		Usage(json.RawMessage(`{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}`)).
+		MustProgram()
+
+	out, err := (&ChatCompletionsEmitter{}).EmitResponse(prog)
+	if err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	if !strings.Contains(string(out), `"finish_reason":"stop"`) {
+		t.Fatalf("finish_reason not attached to choice: %s", out)
+	}
+}
+
+func TestBuilderRecordsMarshalError(t *testing.T) {
+	_, err := Build().
+		Assistant(ToolCall("call_1", "f", func() {})).
+		User(Text("after")).
+		Program()
+	if err == nil {
+		t.Fatal("expected marshal error")
+	}
+}
+
+func TestBuilderRejectsNonRole(t *testing.T) {
+	if _, err := Build().Message(TXT_CHUNK, Text("x")).Program(); err == nil {
+		t.Fatal("expected error for non-role opcode")
+	}
+}
+
+func TestBuilderSkipsNilParts(t *testing.T) {
+	got := Build().User(nil, Text("hi"), nil).MustProgram()
+	want := Build().User(Text("hi")).MustProgram()
+	if d := Diff(want, got); !d.Equal() {
+		t.Fatalf("nil parts were not skipped:\n%s", d)
+	}
+}
+
+func TestBuilderExtNamespace(t *testing.T) {
+	prog := Build().
+		Ext("seed", 42).
+		ExtFor(StyleAnthropic, "cache_control", map[string]string{"type": "ephemeral"}).
+		MustProgram()
+	if len(prog.Code) != 2 {
+		t.Fatalf("expected 2 instructions, got %d", len(prog.Code))
+	}
+	if prog.Code[0].NS != "" || string(prog.Code[0].JSON) != "42" {
+		t.Errorf("untagged ext: %+v", prog.Code[0])
+	}
+	if prog.Code[1].NS != StyleAnthropic || prog.Code[1].Key != "cache_control" {
+		t.Errorf("tagged ext: %+v", prog.Code[1])
+	}
+}
@@ -0,0 +1,260 @@
+package ail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"sort"
+)
+
+// ─── Canonicalization ────────────────────────────────────────────────────────
+
+// Canonicalize returns an equivalent program in canonical form, so that
+// requests that differ only in representation compare (and hash) equal:
+//
+//   - Configuration comes first in a fixed order, followed by top-level
+//     SET_META and EXT_DATA, then a single DEF block, then messages.
+//   - SET_META and EXT_DATA at every level are sorted by key (then namespace).
+//   - JSON arguments are compacted with object keys sorted; numbers keep
+//     their literal form.
+//   - Adjacent TXT_CHUNKs (and THINK_CHUNKs, RESULT_DATAs) are merged and
+//     empty TXT_CHUNKs dropped.
+//   - Every tool result is moved into its own ROLE_TOOL message, so results
+//     carried in user messages (Anthropic) match tool messages (OpenAI).
+//   - Images and audio without a media type get the one emitters assume
+//     (image/png, audio/wav), which is what a converted request carries.
+//   - Buffers are renumbered in order of first reference; unreferenced
+//     buffers are dropped.
+//
+// Canonicalize works on request and response programs; stream programs
+// return the error from Decompile.
+func (p *Program) Canonicalize() (*Program, error) {
+	conv, err := p.Decompile()
+	if err != nil {
+		return nil, err
+	}
+	canonicalizeConversation(conv)
+
+	// Compile places top-level extensions last; hoist them into the header
+	// so that every message prefix covers them.
+	exts := conv.Extensions
+	conv.Extensions = nil
+	out := Compile(conv)
+	if len(exts) > 0 {
+		at := len(out.Code)
+		for i, inst := range out.Code {
+			if inst.Op == DEF_START || inst.Op == MSG_START || inst.Op == RESP_DONE {
+				at = i
+				break
+			}
+		}
+		hdr := NewProgram()
+		compileExt(hdr, exts)
+		out.Code = append(out.Code[:at], append(hdr.Code, out.Code[at:]...)...)
+	}
+	return out, nil
+}
+
+func canonicalizeConversation(c *Conversation) {
+	c.Config.Thinking = canonicalJSON(c.Config.Thinking)
+	c.Config.Format = canonicalJSON(c.Config.Format)
+	c.Usage = canonicalJSON(c.Usage)
+	sortMeta(c.Meta)
+	sortExtensions(c.Extensions)
+
+	for i := range c.Tools {
+		t := &c.Tools[i]
+		t.Schema = canonicalJSON(t.Schema)
+		sortMeta(t.Meta)
+		sortExtensions(t.Extensions)
+	}
+
+	var msgs []Message
+	for _, m := range c.Messages {
+		sortMeta(m.Meta)
+		sortExtensions(m.Extensions)
+		for j := range m.Parts {
+			part := &m.Parts[j]
+			if part.MediaType == "" {
+				part.MediaType = defaultMediaTypes[part.Type]
+			}
+			part.Args = canonicalJSON(part.Args)
+			sortMeta(part.Meta)
+			sortExtensions(part.Extensions)
+		}
+		m.Parts = mergeTextParts(m.Parts)
+		msgs = append(msgs, splitToolResults(m)...)
+	}
+	c.Messages = msgs
+}
+
+// defaultMediaTypes are the media types emitters fill in for parts that
+// carry none.
+var defaultMediaTypes = map[PartType]string{
+	PartImage: "image/png",
+	PartAudio: "audio/wav",
+}
+
+// mergeTextParts concatenates adjacent text parts and drops empty ones. A
+// text part with its own extras ends a run, since they apply to it alone.
+func mergeTextParts(parts []ContentPart) []ContentPart {
+	bare := func(part ContentPart) bool { return len(part.Meta) == 0 && len(part.Extensions) == 0 }
+	out := parts[:0]
+	for _, part := range parts {
+		if part.Type == PartText {
+			if part.Text == "" && bare(part) {
+				continue
+			}
+			if n := len(out); n > 0 && out[n-1].Type == PartText && bare(out[n-1]) {
+				out[n-1].Text += part.Text
+				out[n-1].Meta, out[n-1].Extensions = part.Meta, part.Extensions
+				continue
+			}
+		}
+		out = append(out, part)
+	}
+	return out
+}
+
+// splitToolResults moves each tool result of a user or tool message into a
+// ROLE_TOOL message of its own, keeping the remaining content (in order) in
+// messages of the original role. Message-level meta, extensions and finish
+// reason stay on the first resulting message.
+func splitToolResults(m Message) []Message {
+	if m.Role != ROLE_USR && m.Role != ROLE_TOOL {
+		return []Message{m}
+	}
+	var out []Message
+	var rest []ContentPart
+	flush := func() {
+		if len(rest) > 0 {
+			out = append(out, Message{Role: m.Role, Parts: rest})
+			rest = nil
+		}
+	}
+	for _, part := range m.Parts {
+		if part.Type != PartToolResult {
+			rest = append(rest, part)
+			continue
+		}
+		flush()
+		out = append(out, Message{Role: ROLE_TOOL, Parts: []ContentPart{part}})
+	}
+	flush()
+	if len(out) == 0 {
+		return []Message{m}
+	}
+	out[0].Meta, out[0].Extensions, out[0].FinishReason, out[0].FinishNative = m.Meta, m.Extensions, m.FinishReason, m.FinishNative
+	return out
+}
+
+func sortMeta(meta []Meta) {
+	sort.SliceStable(meta, func(i, j int) bool { return meta[i].Key < meta[j].Key })
+}
+
+func sortExtensions(exts []Extension) {
+	sort.SliceStable(exts, func(i, j int) bool {
+		if exts[i].Key != exts[j].Key {
+			return exts[i].Key < exts[j].Key
+		}
+		return exts[i].NS < exts[j].NS
+	})
+	for i := range exts {
+		exts[i].Value = canonicalJSON(exts[i].Value)
+	}
+}
+
+// canonicalJSON re-encodes j compactly with sorted object keys. Numbers are
+// preserved literally. Invalid JSON is returned unchanged.
+func canonicalJSON(j json.RawMessage) json.RawMessage {
+	if len(j) == 0 {
+		return j
+	}
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return j
+	}
+	out, err := encodeJSONValue(v)
+	if err != nil {
+		return j
+	}
+	return out
+}
+
+// encodeJSONValue marshals a decoded JSON value with sorted object keys and
+// without HTML escaping.
+func encodeJSONValue(v any) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// ─── Hashing ─────────────────────────────────────────────────────────────────
+
+// Hash returns the hex-encoded SHA-256 fingerprint of the program's
+// canonical form. Equivalent programs — including the same request parsed
+// from different provider formats — hash identically.
+//
+// Provider-namespaced EXT_DATA is left out of the fingerprint: it holds
+// passthrough fields (tool_choice, strict, safetySettings, …) that other
+// providers' emitters drop, so it would make a converted request hash
+// differently from its source. Requests that differ only in such fields
+// therefore share a hash; untagged extensions are covered.
+func (p *Program) Hash() (string, error) {
+	canon, err := p.Canonicalize()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, inst := range canon.Code {
+		hashInstruction(h, canon, inst)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// PrefixHashes returns one fingerprint per message: entry i covers the
+// canonical header (configuration, extensions, tool definitions) and
+// messages 0..i. A conversation that extends another shares its prefix
+// hashes, which makes them usable as cache keys for prompt prefixes.
+func (p *Program) PrefixHashes() ([]string, error) {
+	canon, err := p.Canonicalize()
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	h := sha256.New()
+	for _, inst := range canon.Code {
+		hashInstruction(h, canon, inst)
+		if inst.Op == MSG_END {
+			out = append(out, hex.EncodeToString(h.Sum(nil)))
+		}
+	}
+	return out, nil
+}
+
+// hashInstruction feeds inst into h using the binary encoding, except that
+// buffer references are replaced by the referenced bytes so the hash does
+// not depend on buffer numbering. Provider-namespaced EXT_DATA is skipped.
+func hashInstruction(h hash.Hash, p *Program, inst Instruction) {
+	if inst.Op == EXT_DATA && inst.NS != "" {
+		return
+	}
+	if refArgOps[inst.Op] {
+		h.Write([]byte{byte(inst.Op)})
+		var data []byte
+		if int(inst.Ref) < len(p.Buffers) {
+			data = p.Buffers[inst.Ref]
+		}
+		writeBytes(h, data)
+		return
+	}
+	encodeInstruction(h, inst) // writes to a hash never fail
+}
@@ -0,0 +1,209 @@
+package ail
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func mustHash(t *testing.T, p *Program) string {
+	t.Helper()
+	h, err := p.Hash()
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	return h
+}
+
+func TestHashIgnoresRepresentation(t *testing.T) {
+	// OpenAI layout: config scattered, one tool message per result.
+	a := NewProgram()
+	a.EmitString(SET_MODEL, "m")
+	a.Emit(DEF_START)
+	a.EmitString(DEF_NAME, "f")
+	a.EmitJSON(DEF_SCHEMA, json.RawMessage(`{"type":"object","properties":{}}`))
+	a.Emit(DEF_END)
+	a.Emit(MSG_START)
+	a.Emit(ROLE_USR)
+	a.EmitString(TXT_CHUNK, "hello ")
+	a.EmitString(TXT_CHUNK, "world")
+	a.EmitRef(IMG_REF, a.AddBuffer([]byte("img-1")))
+	a.EmitRef(IMG_REF, a.AddBuffer([]byte("img-2")))
+	a.Emit(MSG_END)
+	a.Emit(MSG_START)
+	a.Emit(ROLE_AST)
+	a.EmitString(CALL_START, "c1")
+	a.EmitString(CALL_NAME, "f")
+	a.EmitJSON(CALL_ARGS, json.RawMessage(`{"a":1,"b":[1, 2]}`))
+	a.Emit(CALL_END)
+	a.EmitString(CALL_START, "c2")
+	a.EmitString(CALL_NAME, "f")
+	a.EmitJSON(CALL_ARGS, json.RawMessage(`{}`))
+	a.Emit(CALL_END)
+	a.Emit(MSG_END)
+	for _, id := range []string{"c1", "c2"} {
+		a.Emit(MSG_START)
+		a.Emit(ROLE_TOOL)
+		a.EmitString(RESULT_START, id)
+		a.EmitString(RESULT_DATA, "ok")
+		a.Emit(RESULT_END)
+		a.Emit(MSG_END)
+	}
+	a.EmitFloat(SET_TEMP, 0.2)
+	a.EmitExt("", "x", json.RawMessage(`1`))
+	a.EmitExt("", "seed", json.RawMessage(`42`))
+
+	// Anthropic layout: results in a user message, merged text, reordered
+	// JSON keys and extensions, buffers stored in reverse order.
+	b := NewProgram()
+	b.EmitExt("", "seed", json.RawMessage(` 42 `))
+	b.EmitFloat(SET_TEMP, 0.2)
+	b.EmitExt("", "x", json.RawMessage(`1`))
+	b.EmitString(SET_MODEL, "m")
+	b.Emit(DEF_START)
+	b.EmitString(DEF_NAME, "f")
+	b.EmitJSON(DEF_SCHEMA, json.RawMessage(`{ "properties": {}, "type": "object" }`))
+	b.Emit(DEF_END)
+	img2 := b.AddBuffer([]byte("img-2"))
+	img1 := b.AddBuffer([]byte("img-1"))
+	b.Emit(MSG_START)
+	b.Emit(ROLE_USR)
+	b.EmitString(TXT_CHUNK, "hello world")
+	b.EmitString(TXT_CHUNK, "")
+	b.EmitRef(IMG_REF, img1)
+	b.EmitRef(IMG_REF, img2)
+	b.Emit(MSG_END)
+	b.Emit(MSG_START)
+	b.Emit(ROLE_AST)
+	b.EmitString(CALL_START, "c1")
+	b.EmitString(CALL_NAME, "f")
+	b.EmitJSON(CALL_ARGS, json.RawMessage(`{"b":[1,2],"a":1}`))
+	b.Emit(CALL_END)
+	b.EmitString(CALL_START, "c2")
+	b.EmitString(CALL_NAME, "f")
+	b.EmitJSON(CALL_ARGS, json.RawMessage(`{}`))
+	b.Emit(CALL_END)
+	b.Emit(MSG_END)
+	b.Emit(MSG_START)
+	b.Emit(ROLE_USR)
+	b.EmitString(RESULT_START, "c1")
+	b.EmitString(RESULT_DATA, "ok")
+	b.Emit(RESULT_END)
+	b.EmitString(RESULT_START, "c2")
+	b.EmitString(RESULT_DATA, "ok")
+	b.Emit(RESULT_END)
+	b.Emit(MSG_END)
+
+	if ha, hb := mustHash(t, a), mustHash(t, b); ha != hb {
+		ca, _ := a.Canonicalize()
+		cb, _ := b.Canonicalize()
+		t.Fatalf("hashes differ:\n%s\n---\n%s", ca.Disasm(), cb.Disasm())
+	}
+}
+
+func TestHashDistinguishesContent(t *testing.T) {
+	a := Build().Model("m").User(Text("hi")).MustProgram()
+	b := Build().Model("m").User(Text("hi!")).MustProgram()
+	c := Build().Model("m").User(Image([]byte("x"), "image/png")).MustProgram()
+	d := Build().Model("m").User(Image([]byte("y"), "image/png")).MustProgram()
+	if mustHash(t, a) == mustHash(t, b) {
+		t.Error("different text hashed equal")
+	}
+	if mustHash(t, c) == mustHash(t, d) {
+		t.Error("different buffer content hashed equal")
+	}
+}
+
+func TestHashAcrossProviders(t *testing.T) {
+	// Conversions that drop content the target cannot express.
+	lossy := map[string][]Style{
+		"json_mode.json": {StyleAnthropic, StyleGoogleGenAI}, // SET_FMT
+		"reasoning.json": {StyleResponses},                   // thinking
+		"vision.json":    {StyleResponses},                   // images
+	}
+	files, _ := filepath.Glob("fixtures/chat/request/*.json")
+	for _, file := range files {
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			input, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			src, err := (&ChatCompletionsParser{}).ParseRequest(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := mustHash(t, src)
+
+			for _, style := range []Style{StyleAnthropic, StyleGoogleGenAI, StyleResponses} {
+				out, err := ConvertRequest(input, StyleChatCompletions, style)
+				if err != nil {
+					t.Fatalf("%s: convert: %v", style, err)
+				}
+				parser, _ := GetParser(style)
+				prog, err := parser.ParseRequest(out)
+				if err != nil {
+					t.Fatalf("%s: parse: %v", style, err)
+				}
+				same := mustHash(t, prog) == want
+				if same == slices.Contains(lossy[name], style) {
+					ca, _ := src.Canonicalize()
+					cb, _ := prog.Canonicalize()
+					t.Errorf("%s: hashes equal = %v\n%s", style, same, Diff(ca, cb))
+				}
+			}
+		})
+	}
+}
+
+func TestHashSkipsNamespacedExtensions(t *testing.T) {
+	a := Build().Model("m").User(Text("hi")).MustProgram()
+	b := a.Clone()
+	b.EmitExt(StyleChatCompletions, "tool_choice", json.RawMessage(`"auto"`))
+	c := a.Clone()
+	c.EmitExt("", "tool_choice", json.RawMessage(`"auto"`))
+	if mustHash(t, a) != mustHash(t, b) {
+		t.Error("namespaced extension changed the hash")
+	}
+	if mustHash(t, a) == mustHash(t, c) {
+		t.Error("untagged extension did not change the hash")
+	}
+}
+
+func TestPrefixHashes(t *testing.T) {
+	short := Build().Model("m").System("sys").User(Text("q1")).MustProgram()
+	long := Build().Model("m").System("sys").User(Text("q1")).Assistant(Text("a1")).User(Text("q2")).MustProgram()
+
+	ps, err := short.PrefixHashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl, err := long.PrefixHashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 2 || len(pl) != 4 {
+		t.Fatalf("prefix counts: %d, %d", len(ps), len(pl))
+	}
+	for i := range ps {
+		if ps[i] != pl[i] {
+			t.Errorf("prefix %d differs", i)
+		}
+	}
+	if ps[1] != mustHash(t, short) {
+		t.Error("last prefix hash should equal Hash for a request")
+	}
+	if pl[2] == pl[3] {
+		t.Error("distinct prefixes hashed equal")
+	}
+}
+
+func TestCanonicalizeStream(t *testing.T) {
+	p := NewProgram()
+	p.Emit(STREAM_START)
+	if _, err := p.Hash(); err == nil {
+		t.Fatal("expected error for stream program")
+	}
+}
@@ -0,0 +1,619 @@
+package ail
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ─── Conversation types ──────────────────────────────────────────────────────
+// A Conversation is a typed, structural view of a Program. Decompile builds
+// one from instructions; Compile writes it back. Use it when a plugin needs
+// to read or rewrite content rather than splice instruction ranges.
+
+// Conversation is the decompiled form of a request or response program.
+type Conversation struct {
+	Config     Config
+	Meta       []Meta      // top-level SET_META
+	Extensions []Extension // top-level EXT_DATA
+	Tools      []Tool
+	Messages   []Message
+
+	// Response metadata (empty for requests).
+	ResponseID    string
+	ResponseModel string
+	Usage         json.RawMessage
+	FinishReason  string       // RESP_DONE found outside any message
+	FinishNative  NativeFinish // its native value, if any
+}
+
+// Config holds the SET_* configuration instructions. Pointer fields are nil
+// when the corresponding instruction is absent.
+type Config struct {
+	Model       string
+	Temperature *float64
+	TopP        *float64
+	MaxTokens   *int32
+	Stop        []string
+	Stream      bool
+	Thinking    json.RawMessage // SET_THINK
+	Format      json.RawMessage // SET_FMT
+}
+
+// Meta is a SET_META key/value pair.
+type Meta struct {
+	Key   string
+	Value string
+}
+
+// Extension is an EXT_DATA entry with its originating namespace.
+type Extension struct {
+	NS    Style
+	Key   string
+	Value json.RawMessage
+}
+
+// Tool is a single tool definition.
+type Tool struct {
+	Name        string
+	Description string
+	Schema      json.RawMessage
+	Meta        []Meta
+	Extensions  []Extension
+}
+
+// Message is a MSG_START…MSG_END block.
+type Message struct {
+	Role         Opcode // ROLE_SYS, ROLE_USR, ROLE_AST, or ROLE_TOOL
+	Parts        []ContentPart
+	FinishReason string       // RESP_DONE inside the message (responses)
+	FinishNative NativeFinish // its native value, if any
+	Meta         []Meta
+	Extensions   []Extension
+}
+
+// PartType identifies the kind of a ContentPart.
+type PartType uint8
+
+const (
+	PartText       PartType = iota + 1 // TXT_CHUNK: Text
+	PartImage                          // IMG_REF: Data, MediaType
+	PartAudio                          // AUD_REF: Data, MediaType
+	PartTextRef                        // TXT_REF: Data
+	PartThinking                       // THINK_START…THINK_END: Text, Data (signature)
+	PartToolCall                       // CALL_START…CALL_END: CallID, Name, Args
+	PartToolResult                     // RESULT_START…RESULT_END: CallID, Text
+)
+
+var partTypeNames = map[PartType]string{
+	PartText: "text", PartImage: "image", PartAudio: "audio", PartTextRef: "text_ref",
+	PartThinking: "thinking", PartToolCall: "tool_call", PartToolResult: "tool_result",
+}
+
+// String returns a lower-case name for the part type.
+func (t PartType) String() string {
+	if n, ok := partTypeNames[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("PartType(%d)", uint8(t))
+}
+
+// ContentPart is one ordered piece of message content. Which fields are set
+// depends on Type (see the PartType constants).
+type ContentPart struct {
+	Type      PartType
+	Text      string
+	Data      []byte // buffer payload, or the opaque thinking signature
+	MediaType string
+	CallID    string
+	Name      string
+	Args      json.RawMessage
+
+	// Part-level extras: the SET_META/EXT_DATA inside a call or result
+	// block, or directly after a text, media or thinking part (such as
+	// Anthropic's per-block cache_control or a Responses reasoning item's
+	// encrypted_content).
+	Meta       []Meta
+	Extensions []Extension
+}
+
+// ─── Decompile ───────────────────────────────────────────────────────────────
+
+// Decompile converts a request or response program into a Conversation.
+// Stream programs are not supported and return an error, as do content
+// opcodes outside a message and unbalanced blocks.
+//
+// THINK blocks outside a message (Responses reasoning items) are attached
+// to the start of the message that follows, or to a trailing assistant
+// message when none does.
+//
+// Buffer payloads are copied into the parts that reference them, so the
+// Conversation does not alias the program.
+func (p *Program) Decompile() (*Conversation, error) {
+	conv := &Conversation{}
+	var (
+		msg       *Message
+		tool      *Tool
+		inDef     bool
+		call      *ContentPart  // open CALL block
+		think     *ContentPart  // open THINK block
+		result    *ContentPart  // open RESULT block
+		trail     *ContentPart  // part whose trailing extras are collected
+		lead      []ContentPart // top-level THINK blocks awaiting a message
+		mediaType string        // pending SET_META media_type
+	)
+
+	buffer := func(i int, ref uint32) ([]byte, error) {
+		if int(ref) >= len(p.Buffers) {
+			return nil, fmt.Errorf("ail: decompile: %s at %d: ref %d out of range", p.Code[i].Op, i, ref)
+		}
+		return append([]byte(nil), p.Buffers[ref]...), nil
+	}
+	needMessage := func(i int) error {
+		if msg == nil {
+			return fmt.Errorf("ail: decompile: %s at %d outside message", p.Code[i].Op, i)
+		}
+		return nil
+	}
+	// lastPart returns the part just appended to msg; pointers are taken
+	// only while no further parts are appended to the same message.
+	lastPart := func() *ContentPart { return &msg.Parts[len(msg.Parts)-1] }
+
+	for i, inst := range p.Code {
+		if inst.Op != SET_META && inst.Op != EXT_DATA {
+			trail = nil
+		}
+		switch inst.Op {
+		// ── Configuration ──
+		case SET_MODEL:
+			conv.Config.Model = inst.Str
+		case SET_TEMP:
+			v := inst.Num
+			conv.Config.Temperature = &v
+		case SET_TOPP:
+			v := inst.Num
+			conv.Config.TopP = &v
+		case SET_MAX:
+			v := inst.Int
+			conv.Config.MaxTokens = &v
+		case SET_STOP:
+			conv.Config.Stop = append(conv.Config.Stop, inst.Str)
+		case SET_STREAM:
+			conv.Config.Stream = true
+		case SET_THINK:
+			conv.Config.Thinking = cloneRaw(inst.JSON)
+		case SET_FMT:
+			conv.Config.Format = cloneRaw(inst.JSON)
+
+		case SET_META:
+			m := Meta{Key: inst.Key, Value: inst.Str}
+			switch {
+			case call != nil:
+				call.Meta = append(call.Meta, m)
+			case result != nil:
+				result.Meta = append(result.Meta, m)
+			case think != nil:
+				think.Meta = append(think.Meta, m)
+			case msg != nil && inst.Key == "media_type":
+				mediaType = inst.Str
+			case trail != nil:
+				trail.Meta = append(trail.Meta, m)
+			case msg != nil:
+				msg.Meta = append(msg.Meta, m)
+			case tool != nil:
+				tool.Meta = append(tool.Meta, m)
+			default:
+				conv.Meta = append(conv.Meta, m)
+			}
+
+		case EXT_DATA:
+			x := Extension{NS: inst.NS, Key: inst.Key, Value: cloneRaw(inst.JSON)}
+			switch {
+			case call != nil:
+				call.Extensions = append(call.Extensions, x)
+			case result != nil:
+				result.Extensions = append(result.Extensions, x)
+			case think != nil:
+				think.Extensions = append(think.Extensions, x)
+			case trail != nil:
+				trail.Extensions = append(trail.Extensions, x)
+			case msg != nil:
+				msg.Extensions = append(msg.Extensions, x)
+			case tool != nil:
+				tool.Extensions = append(tool.Extensions, x)
+			default:
+				conv.Extensions = append(conv.Extensions, x)
+			}
+
+		// ── Tool definitions ──
+		case DEF_START:
+			if inDef || msg != nil {
+				return nil, fmt.Errorf("ail: decompile: unexpected DEF_START at %d", i)
+			}
+			inDef = true
+		case DEF_NAME:
+			if !inDef {
+				return nil, fmt.Errorf("ail: decompile: DEF_NAME at %d outside DEF block", i)
+			}
+			conv.Tools = append(conv.Tools, Tool{Name: inst.Str})
+			tool = &conv.Tools[len(conv.Tools)-1]
+		case DEF_DESC, DEF_SCHEMA:
+			if tool == nil {
+				return nil, fmt.Errorf("ail: decompile: %s at %d before DEF_NAME", inst.Op, i)
+			}
+			if inst.Op == DEF_DESC {
+				tool.Description = inst.Str
+			} else {
+				tool.Schema = cloneRaw(inst.JSON)
+			}
+		case DEF_END:
+			if !inDef {
+				return nil, fmt.Errorf("ail: decompile: unmatched DEF_END at %d", i)
+			}
+			inDef, tool = false, nil
+
+		// ── Messages ──
+		case MSG_START:
+			if msg != nil || inDef {
+				return nil, fmt.Errorf("ail: decompile: unexpected MSG_START at %d", i)
+			}
+			conv.Messages = append(conv.Messages, Message{Parts: lead})
+			msg = &conv.Messages[len(conv.Messages)-1]
+			lead = nil
+		case ROLE_SYS, ROLE_USR, ROLE_AST, ROLE_TOOL:
+			if err := needMessage(i); err != nil {
+				return nil, err
+			}
+			msg.Role = inst.Op
+		case MSG_END:
+			if msg == nil || call != nil || think != nil || result != nil {
+				return nil, fmt.Errorf("ail: decompile: unbalanced MSG_END at %d", i)
+			}
+			if mediaType != "" {
+				msg.Meta = append(msg.Meta, Meta{Key: "media_type", Value: mediaType})
+				mediaType = ""
+			}
+			msg = nil
+
+		// ── Content ──
+		case TXT_CHUNK:
+			if err := needMessage(i); err != nil {
+				return nil, err
+			}
+			msg.Parts = append(msg.Parts, ContentPart{Type: PartText, Text: inst.Str})
+			trail = lastPart()
+		case IMG_REF, AUD_REF, TXT_REF:
+			if err := needMessage(i); err != nil {
+				return nil, err
+			}
+			data, err := buffer(i, inst.Ref)
+			if err != nil {
+				return nil, err
+			}
+			part := ContentPart{Type: PartTextRef, Data: data}
+			if inst.Op != TXT_REF {
+				part.Type = PartImage
+				if inst.Op == AUD_REF {
+					part.Type = PartAudio
+				}
+				part.MediaType, mediaType = mediaType, ""
+			}
+			msg.Parts = append(msg.Parts, part)
+			trail = lastPart()
+
+		// ── Thinking ──
+		case THINK_START:
+			switch {
+			case think != nil || inDef:
+				return nil, fmt.Errorf("ail: decompile: unexpected THINK_START at %d", i)
+			case msg == nil:
+				lead = append(lead, ContentPart{Type: PartThinking})
+				think = &lead[len(lead)-1]
+			default:
+				msg.Parts = append(msg.Parts, ContentPart{Type: PartThinking})
+				think = lastPart()
+			}
+		case THINK_CHUNK:
+			if think == nil {
+				return nil, fmt.Errorf("ail: decompile: THINK_CHUNK at %d outside THINK block", i)
+			}
+			think.Text += inst.Str
+		case THINK_REF:
+			if think == nil {
+				return nil, fmt.Errorf("ail: decompile: THINK_REF at %d outside THINK block", i)
+			}
+			if think.Data != nil {
+				return nil, fmt.Errorf("ail: decompile: second THINK_REF at %d in THINK block", i)
+			}
+			data, err := buffer(i, inst.Ref)
+			if err != nil {
+				return nil, err
+			}
+			think.Data = data
+		case THINK_END:
+			if think == nil {
+				return nil, fmt.Errorf("ail: decompile: unmatched THINK_END at %d", i)
+			}
+			think, trail = nil, think
+
+		// ── Tool calls ──
+		case CALL_START:
+			if err := needMessage(i); err != nil {
+				return nil, err
+			}
+			msg.Parts = append(msg.Parts, ContentPart{Type: PartToolCall, CallID: inst.Str})
+			call = lastPart()
+		case CALL_NAME:
+			if call == nil {
+				return nil, fmt.Errorf("ail: decompile: CALL_NAME at %d outside CALL block", i)
+			}
+			call.Name = inst.Str
+		case CALL_ARGS:
+			if call == nil {
+				return nil, fmt.Errorf("ail: decompile: CALL_ARGS at %d outside CALL block", i)
+			}
+			call.Args = cloneRaw(inst.JSON)
+		case CALL_END:
+			if call == nil {
+				return nil, fmt.Errorf("ail: decompile: unmatched CALL_END at %d", i)
+			}
+			call = nil
+
+		// ── Tool results ──
+		case RESULT_START:
+			if err := needMessage(i); err != nil {
+				return nil, err
+			}
+			msg.Parts = append(msg.Parts, ContentPart{Type: PartToolResult, CallID: inst.Str})
+			result = lastPart()
+		case RESULT_DATA:
+			if result == nil {
+				return nil, fmt.Errorf("ail: decompile: RESULT_DATA at %d outside RESULT block", i)
+			}
+			result.Text += inst.Str
+		case RESULT_END:
+			if result == nil {
+				return nil, fmt.Errorf("ail: decompile: unmatched RESULT_END at %d", i)
+			}
+			result = nil
+
+		// ── Response metadata ──
+		case RESP_ID:
+			conv.ResponseID = inst.Str
+		case RESP_MODEL:
+			conv.ResponseModel = inst.Str
+		case RESP_DONE:
+			native := NativeFinish{NS: inst.NS, Value: inst.Key}
+			if msg != nil {
+				msg.FinishReason, msg.FinishNative = inst.Str, native
+			} else {
+				conv.FinishReason, conv.FinishNative = inst.Str, native
+			}
+		case USAGE:
+			conv.Usage = cloneRaw(inst.JSON)
+
+		case RESP_ERROR:
+			return nil, fmt.Errorf("ail: decompile: error response (RESP_ERROR at %d) not supported", i)
+		case STREAM_START, STREAM_DELTA, STREAM_TOOL_DELTA, STREAM_END, STREAM_THINK_DELTA,
+			STREAM_BLOCK_START, STREAM_BLOCK_END, STREAM_THINK_SIG, STREAM_ERROR:
+			return nil, fmt.Errorf("ail: decompile: stream opcode %s at %d not supported", inst.Op, i)
+		default:
+			return nil, fmt.Errorf("ail: decompile: unknown opcode %s at %d", inst.Op, i)
+		}
+	}
+
+	if msg != nil || inDef || think != nil {
+		return nil, fmt.Errorf("ail: decompile: unterminated block at end of program")
+	}
+	if len(lead) > 0 {
+		conv.Messages = append(conv.Messages, Message{Role: ROLE_AST, Parts: lead})
+	}
+	return conv, nil
+}
+
+// cloneRaw returns a copy of j, or nil if j is empty.
+func cloneRaw(j json.RawMessage) json.RawMessage {
+	if len(j) == 0 {
+		return nil
+	}
+	return append(json.RawMessage(nil), j...)
+}
+
+// ─── Compile ─────────────────────────────────────────────────────────────────
+
+// Compile converts a Conversation back into a Program. Instructions are laid
+// out the way the parsers produce them: response metadata, configuration,
+// top-level meta, a single DEF block, messages, then top-level extensions.
+// Block-level meta and extensions are emitted just before the block's END
+// opcode, which is where emitters collect them; those of text, media and
+// thinking parts directly follow the part.
+func Compile(c *Conversation) *Program {
+	p := NewProgram()
+
+	if c.ResponseID != "" {
+		p.EmitString(RESP_ID, c.ResponseID)
+	}
+	if c.ResponseModel != "" {
+		p.EmitString(RESP_MODEL, c.ResponseModel)
+	}
+	if len(c.Usage) > 0 {
+		p.EmitJSON(USAGE, cloneRaw(c.Usage))
+	}
+
+	cfg := c.Config
+	if cfg.Model != "" {
+		p.EmitString(SET_MODEL, cfg.Model)
+	}
+	if cfg.Temperature != nil {
+		p.EmitFloat(SET_TEMP, *cfg.Temperature)
+	}
+	if cfg.TopP != nil {
+		p.EmitFloat(SET_TOPP, *cfg.TopP)
+	}
+	if cfg.MaxTokens != nil {
+		p.EmitInt(SET_MAX, *cfg.MaxTokens)
+	}
+	for _, s := range cfg.Stop {
+		p.EmitString(SET_STOP, s)
+	}
+	if cfg.Stream {
+		p.Emit(SET_STREAM)
+	}
+	if len(cfg.Thinking) > 0 {
+		p.EmitJSON(SET_THINK, cloneRaw(cfg.Thinking))
+	}
+	if len(cfg.Format) > 0 {
+		p.EmitJSON(SET_FMT, cloneRaw(cfg.Format))
+	}
+	compileMeta(p, c.Meta)
+
+	if len(c.Tools) > 0 {
+		p.Emit(DEF_START)
+		for _, t := range c.Tools {
+			p.EmitString(DEF_NAME, t.Name)
+			if t.Description != "" {
+				p.EmitString(DEF_DESC, t.Description)
+			}
+			if len(t.Schema) > 0 {
+				p.EmitJSON(DEF_SCHEMA, cloneRaw(t.Schema))
+			}
+			compileMeta(p, t.Meta)
+			compileExt(p, t.Extensions)
+		}
+		p.Emit(DEF_END)
+	}
+
+	for _, m := range c.Messages {
+		p.Emit(MSG_START)
+		if m.Role != 0 {
+			p.Emit(m.Role)
+		}
+		for _, part := range m.Parts {
+			compilePart(p, part)
+		}
+		if m.FinishReason != "" {
+			compileFinish(p, m.FinishReason, m.FinishNative)
+		}
+		compileMeta(p, m.Meta)
+		compileExt(p, m.Extensions)
+		p.Emit(MSG_END)
+	}
+
+	if c.FinishReason != "" {
+		compileFinish(p, c.FinishReason, c.FinishNative)
+	}
+	compileExt(p, c.Extensions)
+	return p
+}
+
+func compileFinish(p *Program, reason string, native NativeFinish) {
+	p.Code = append(p.Code, Instruction{Op: RESP_DONE, Str: reason, Key: native.Value, NS: native.NS})
+}
+
+func compilePart(p *Program, part ContentPart) {
+	switch part.Type {
+	case PartText:
+		p.EmitString(TXT_CHUNK, part.Text)
+		compileMeta(p, part.Meta)
+		compileExt(p, part.Extensions)
+	case PartImage, PartAudio:
+		ref := p.AddBuffer(append([]byte(nil), part.Data...))
+		if part.MediaType != "" {
+			p.EmitKeyVal(SET_META, "media_type", part.MediaType)
+		}
+		op := IMG_REF
+		if part.Type == PartAudio {
+			op = AUD_REF
+		}
+		p.EmitRef(op, ref)
+		compileMeta(p, part.Meta)
+		compileExt(p, part.Extensions)
+	case PartTextRef:
+		p.EmitRef(TXT_REF, p.AddBuffer(append([]byte(nil), part.Data...)))
+		compileMeta(p, part.Meta)
+		compileExt(p, part.Extensions)
+	case PartThinking:
+		p.Emit(THINK_START)
+		if part.Text != "" {
+			p.EmitString(THINK_CHUNK, part.Text)
+		}
+		if len(part.Data) > 0 {
+			p.EmitRef(THINK_REF, p.AddBuffer(append([]byte(nil), part.Data...)))
+		}
+		p.Emit(THINK_END)
+		compileMeta(p, part.Meta)
+		compileExt(p, part.Extensions)
+	case PartToolCall:
+		p.EmitString(CALL_START, part.CallID)
+		if part.Name != "" {
+			p.EmitString(CALL_NAME, part.Name)
+		}
+		if len(part.Args) > 0 {
+			p.EmitJSON(CALL_ARGS, cloneRaw(part.Args))
+		}
+		compileMeta(p, part.Meta)
+		compileExt(p, part.Extensions)
+		p.Emit(CALL_END)
+	case PartToolResult:
+		p.EmitString(RESULT_START, part.CallID)
+		p.EmitString(RESULT_DATA, part.Text)
+		compileMeta(p, part.Meta)
+		compileExt(p, part.Extensions)
+		p.Emit(RESULT_END)
+	}
+}
+
+func compileMeta(p *Program, meta []Meta) {
+	for _, m := range meta {
+		p.EmitKeyVal(SET_META, m.Key, m.Value)
+	}
+}
+
+func compileExt(p *Program, exts []Extension) {
+	for _, x := range exts {
+		p.EmitExt(x.NS, x.Key, cloneRaw(x.Value))
+	}
+}
+
+// ─── Conversation helpers ────────────────────────────────────────────────────
+
+// Text returns the concatenated text parts of the message.
+func (m *Message) Text() string {
+	var sb strings.Builder
+	for _, part := range m.Parts {
+		if part.Type == PartText {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String()
+}
+
+// ToolCalls returns the message's tool-call parts in order.
+func (m *Message) ToolCalls() []ContentPart {
+	return m.partsOf(PartToolCall)
+}
+
+// ToolResults returns the message's tool-result parts in order.
+func (m *Message) ToolResults() []ContentPart {
+	return m.partsOf(PartToolResult)
+}
+
+func (m *Message) partsOf(t PartType) []ContentPart {
+	var out []ContentPart
+	for _, part := range m.Parts {
+		if part.Type == t {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// Tool returns the tool definition with the given name.
+func (c *Conversation) Tool(name string) (*Tool, bool) {
+	for i := range c.Tools {
+		if c.Tools[i].Name == name {
+			return &c.Tools[i], true
+		}
+	}
+	return nil, false
+}
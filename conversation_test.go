@@ -0,0 +1,392 @@
+package ail
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// decompileCases adds the fixtures that parse but have no emitter of their
+// own style, so TestE2ERoundTrip cannot cover them.
+var decompileCases = append(e2eCases[:len(e2eCases):len(e2eCases)],
+	e2eCase{"responses/response", StyleResponses, "response"},
+)
+
+// TestDecompileCompileFixtures checks that Compile(Decompile(p)) keeps every
+// instruction of p in its block and emits the same JSON as p for every
+// request/response fixture and every target style. Top-level reasoning moves
+// into the assistant message, where emitters render it, so programs that
+// have it are only checked for stability.
+func TestDecompileCompileFixtures(t *testing.T) {
+	targets := []Style{StyleChatCompletions, StyleResponses, StyleAnthropic, StyleGoogleGenAI}
+
+	for _, tc := range decompileCases {
+		if tc.kind == "stream" {
+			continue
+		}
+		files, _ := filepath.Glob(filepath.Join("fixtures", tc.dir, "*.json"))
+		for _, file := range files {
+			t.Run(tc.dir+"/"+filepath.Base(file), func(t *testing.T) {
+				input, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				prog, err := parseFixture(input, tc.style, tc.kind)
+				if err != nil {
+					t.Fatalf("parse: %v", err)
+				}
+				conv, err := prog.Decompile()
+				if err != nil {
+					t.Fatalf("decompile: %v", err)
+				}
+				rebuilt := Compile(conv)
+
+				again, err := rebuilt.Decompile()
+				if err != nil {
+					t.Fatalf("decompile rebuilt: %v", err)
+				}
+				if !reflect.DeepEqual(conv, again) {
+					t.Errorf("conversation not stable across Compile/Decompile")
+				}
+				if hasTopLevelThink(prog) {
+					return
+				}
+				if want, got := placedInstructions(prog), placedInstructions(rebuilt); !reflect.DeepEqual(want, got) {
+					t.Errorf("instructions moved:\nwant %q\n got %q", want, got)
+				}
+
+				for _, to := range targets {
+					want, werr := emitFixture(prog, to, tc.kind)
+					got, gerr := emitFixture(rebuilt, to, tc.kind)
+					if (werr == nil) != (gerr == nil) {
+						t.Fatalf("%s: emit errors differ: %v vs %v", to, werr, gerr)
+					}
+					if werr != nil {
+						continue // e.g. no response emitter for this style
+					}
+					assertJSONEqual(t, want, got)
+				}
+			})
+		}
+	}
+}
+
+// placedInstructions lists p's instructions, each prefixed with the
+// message, part and block it sits in, in sorted order. Buffer references are
+// replaced by their payload.
+func placedInstructions(p *Program) []string {
+	var (
+		out          []string
+		msg, part    = -1, 0
+		block        string
+		inMsg, inDef bool
+	)
+	for _, inst := range p.Code {
+		switch inst.Op {
+		case MSG_START:
+			msg, part, inMsg = msg+1, 0, true
+		case DEF_START:
+			inDef = true
+		case TXT_CHUNK, IMG_REF, AUD_REF, TXT_REF:
+			part++
+		case THINK_START, CALL_START, RESULT_START:
+			part++
+			block = inst.Op.String()
+		}
+		where := "top"
+		switch {
+		case inMsg:
+			where = fmt.Sprintf("msg %d part %d %s", msg, part, block)
+		case inDef:
+			where = "def"
+		}
+		arg := fmt.Sprintf("%q %v %d %s %q %s", inst.Str, inst.Num, inst.Int, inst.JSON, inst.Key, inst.NS)
+		if refArgOps[inst.Op] {
+			arg = fmt.Sprintf("%q", p.Buffers[inst.Ref])
+		}
+		out = append(out, where+": "+inst.Op.String()+" "+arg)
+		switch inst.Op {
+		case MSG_END:
+			inMsg = false
+		case DEF_END:
+			inDef = false
+		case THINK_END, CALL_END, RESULT_END:
+			block = ""
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func hasTopLevelThink(p *Program) bool {
+	inMsg := false
+	for _, inst := range p.Code {
+		switch inst.Op {
+		case MSG_START:
+			inMsg = true
+		case MSG_END:
+			inMsg = false
+		case THINK_START:
+			if !inMsg {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseFixture(input []byte, style Style, kind string) (*Program, error) {
+	if kind == "request" {
+		p, err := GetParser(style)
+		if err != nil {
+			return nil, err
+		}
+		return p.ParseRequest(input)
+	}
+	p, err := GetResponseParser(style)
+	if err != nil {
+		return nil, err
+	}
+	return p.ParseResponse(input)
+}
+
+func emitFixture(prog *Program, style Style, kind string) ([]byte, error) {
+	if kind == "request" {
+		e, err := GetEmitter(style)
+		if err != nil {
+			return nil, err
+		}
+		return e.EmitRequest(prog)
+	}
+	e, err := GetResponseEmitter(style)
+	if err != nil {
+		return nil, err
+	}
+	return e.EmitResponse(prog)
+}
+
+func TestDecompileStructure(t *testing.T) {
+	prog := buildToolProgram()
+	prog.EmitExt(StyleAnthropic, "metadata", json.RawMessage(`{"user_id":"u1"}`))
+
+	conv, err := prog.Decompile()
+	if err != nil {
+		t.Fatalf("decompile: %v", err)
+	}
+	if conv.Config.Model != "gpt-4o" {
+		t.Errorf("model = %q", conv.Config.Model)
+	}
+	if len(conv.Tools) != 2 || conv.Tools[1].Name != "search" {
+		t.Fatalf("tools = %+v", conv.Tools)
+	}
+	if len(conv.Messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(conv.Messages))
+	}
+	calls := conv.Messages[1].ToolCalls()
+	if len(calls) != 1 || calls[0].CallID != "call_abc123" || string(calls[0].Args) != `{"city":"Paris"}` {
+		t.Errorf("calls = %+v", calls)
+	}
+	results := conv.Messages[2].ToolResults()
+	if len(results) != 1 || results[0].Text != `{"temp":22,"unit":"C"}` {
+		t.Errorf("results = %+v", results)
+	}
+	if len(conv.Extensions) != 1 || conv.Extensions[0].NS != StyleAnthropic {
+		t.Errorf("extensions = %+v", conv.Extensions)
+	}
+}
+
+func TestDecompileMedia(t *testing.T) {
+	prog := Build().
+		User(Text("look"), Image([]byte("aW1n"), "image/png")).
+		Assistant(Thinking("hmm", "sig"), Text("a picture")).
+		MustProgram()
+
+	conv, err := prog.Decompile()
+	if err != nil {
+		t.Fatalf("decompile: %v", err)
+	}
+	img := conv.Messages[0].Parts[1]
+	if img.Type != PartImage || string(img.Data) != "aW1n" || img.MediaType != "image/png" {
+		t.Errorf("image part = %+v", img)
+	}
+	think := conv.Messages[1].Parts[0]
+	if think.Type != PartThinking || think.Text != "hmm" || string(think.Data) != "sig" {
+		t.Errorf("thinking part = %+v", think)
+	}
+
+	// Mutate and recompile.
+	conv.Messages[1].Parts[1].Text = "a cat"
+	out := Compile(conv)
+	conv2, err := out.Decompile()
+	if err != nil {
+		t.Fatalf("decompile recompiled: %v", err)
+	}
+	if got := conv2.Messages[1].Text(); got != "a cat" {
+		t.Fatalf("mutation lost: %q", got)
+	}
+	if len(out.Buffers) != 2 {
+		t.Errorf("expected 2 buffers, got %d", len(out.Buffers))
+	}
+}
+
+// TestCompileKeepsInstructionPlacement checks that part-level extras come
+// back where they were: inside result blocks and after the text, media or
+// thinking part they follow.
+func TestCompileKeepsInstructionPlacement(t *testing.T) {
+	cache := json.RawMessage(`{"type":"ephemeral"}`)
+	p := NewProgram()
+	p.EmitString(SET_MODEL, "m")
+	p.Emit(MSG_START)
+	p.Emit(ROLE_AST)
+	p.Emit(THINK_START)
+	p.EmitString(THINK_CHUNK, "hmm")
+	p.EmitRef(THINK_REF, p.AddBuffer([]byte("sig")))
+	p.Emit(THINK_END)
+	p.EmitExt(StyleResponses, "encrypted_content", json.RawMessage(`"enc"`))
+	p.EmitString(CALL_START, "c1")
+	p.EmitString(CALL_NAME, "f")
+	p.EmitExt(StyleAnthropic, "cache_control", cache)
+	p.Emit(CALL_END)
+	p.Emit(MSG_END)
+	p.Emit(MSG_START)
+	p.Emit(ROLE_USR)
+	p.EmitString(RESULT_START, "c1")
+	p.EmitString(RESULT_DATA, "boom")
+	p.EmitKeyVal(SET_META, "source", "sandbox")
+	p.EmitExt(StyleAnthropic, "is_error", json.RawMessage(`true`))
+	p.Emit(RESULT_END)
+	p.EmitString(TXT_CHUNK, "first")
+	p.EmitExt(StyleAnthropic, "cache_control", cache)
+	p.EmitString(TXT_CHUNK, "second")
+	p.EmitKeyVal(SET_META, "media_type", "image/png")
+	p.EmitRef(IMG_REF, p.AddBuffer([]byte("aW1n")))
+	p.EmitExt(StyleAnthropic, "cache_control", cache)
+	p.EmitExt(StyleAnthropic, "name", json.RawMessage(`"u1"`))
+	p.Emit(MSG_END)
+
+	conv, err := p.Decompile()
+	if err != nil {
+		t.Fatalf("decompile: %v", err)
+	}
+	if res := conv.Messages[1].Parts[0]; len(res.Extensions) != 1 || len(res.Meta) != 1 {
+		t.Errorf("result extras = %+v, %+v", res.Meta, res.Extensions)
+	}
+	if txt := conv.Messages[1].Parts[1]; len(txt.Extensions) != 1 {
+		t.Errorf("text extras = %+v", txt.Extensions)
+	}
+
+	out := Compile(conv)
+	if !reflect.DeepEqual(out.Code, p.Code) || !reflect.DeepEqual(out.Buffers, p.Buffers) {
+		t.Errorf("instructions differ:\n%s\n---\n%s", p.Disasm(), out.Disasm())
+	}
+}
+
+func TestDecompileTopLevelReasoning(t *testing.T) {
+	body, err := os.ReadFile("fixtures/responses/response/reasoning.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := (&ResponsesParser{}).ParseResponse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, err := prog.Decompile()
+	if err != nil {
+		t.Fatalf("decompile: %v", err)
+	}
+	if len(conv.Messages) != 1 {
+		t.Fatalf("messages = %+v", conv.Messages)
+	}
+	m := conv.Messages[0]
+	if m.Role != ROLE_AST || len(m.Parts) != 2 || m.Text() != "6 × 7 = 42." {
+		t.Fatalf("message = %+v", m)
+	}
+	think := m.Parts[0]
+	if think.Type != PartThinking || think.Text != "The user asks for 6 times 7." {
+		t.Errorf("thinking part = %+v", think)
+	}
+	if len(think.Extensions) != 1 || think.Extensions[0].Key != "encrypted_content" {
+		t.Errorf("thinking extensions = %+v", think.Extensions)
+	}
+
+	out, err := (&ChatCompletionsEmitter{}).EmitResponse(Compile(conv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chat struct {
+		Choices []struct {
+			Message struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(out, &chat); err != nil {
+		t.Fatal(err)
+	}
+	if len(chat.Choices) != 1 || chat.Choices[0].Message.ReasoningContent != think.Text {
+		t.Errorf("chat response = %s", out)
+	}
+
+	// Reasoning with no message after it gets an assistant message.
+	p := NewProgram()
+	p.Emit(THINK_START)
+	p.EmitString(THINK_CHUNK, "hmm")
+	p.Emit(THINK_END)
+	conv, err = p.Decompile()
+	if err != nil {
+		t.Fatalf("decompile: %v", err)
+	}
+	if len(conv.Messages) != 1 || conv.Messages[0].Role != ROLE_AST || conv.Messages[0].Parts[0].Text != "hmm" {
+		t.Errorf("messages = %+v", conv.Messages)
+	}
+}
+
+func TestDecompileErrors(t *testing.T) {
+	cases := map[string]func(p *Program){
+		"stream": func(p *Program) {
+			p.Emit(STREAM_START)
+		},
+		"text outside message": func(p *Program) {
+			p.EmitString(TXT_CHUNK, "x")
+		},
+		"unterminated message": func(p *Program) {
+			p.Emit(MSG_START)
+			p.Emit(ROLE_USR)
+		},
+		"unbalanced call": func(p *Program) {
+			p.Emit(MSG_START)
+			p.EmitString(CALL_START, "c")
+			p.Emit(MSG_END)
+		},
+		"second signature": func(p *Program) {
+			p.Emit(MSG_START)
+			p.Emit(THINK_START)
+			p.EmitRef(THINK_REF, p.AddBuffer([]byte("a")))
+			p.EmitRef(THINK_REF, p.AddBuffer([]byte("b")))
+			p.Emit(THINK_END)
+			p.Emit(MSG_END)
+		},
+		"unterminated thinking": func(p *Program) {
+			p.Emit(THINK_START)
+		},
+		"bad ref": func(p *Program) {
+			p.Emit(MSG_START)
+			p.EmitRef(IMG_REF, 3)
+			p.Emit(MSG_END)
+		},
+	}
+	for name, build := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := NewProgram()
+			build(p)
+			if _, err := p.Decompile(); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -68,6 +68,38 @@ func GetResponseEmitter(style Style) (ResponseEmitter, error) {
 	}
 }
 
+// GetErrorParser returns the appropriate error parser for a style.
+func GetErrorParser(style Style) (ErrorParser, error) {
+	switch style {
+	case StyleChatCompletions:
+		return &ChatCompletionsParser{}, nil
+	case StyleResponses:
+		return &ResponsesParser{}, nil
+	case StyleAnthropic:
+		return &AnthropicParser{}, nil
+	case StyleGoogleGenAI:
+		return &GoogleGenAIParser{}, nil
+	default:
+		return nil, fmt.Errorf("ail: no error parser for style %q", style)
+	}
+}
+
+// GetErrorEmitter returns the appropriate error emitter for a style.
+func GetErrorEmitter(style Style) (ErrorEmitter, error) {
+	switch style {
+	case StyleChatCompletions:
+		return &ChatCompletionsEmitter{}, nil
+	case StyleResponses:
+		return &ResponsesEmitter{}, nil
+	case StyleAnthropic:
+		return &AnthropicEmitter{}, nil
+	case StyleGoogleGenAI:
+		return &GoogleGenAIEmitter{}, nil
+	default:
+		return nil, fmt.Errorf("ail: no error emitter for style %q", style)
+	}
+}
+
 // GetStreamChunkParser returns the appropriate stream chunk parser.
 func GetStreamChunkParser(style Style) (StreamChunkParser, error) {
 	switch style {
@@ -502,6 +502,50 @@ func TestExtDataPassthrough(t *testing.T) {
 	}
 }
 
+func TestExtDataNamespaceFiltering(t *testing.T) {
+	input := `{
+		"model": "gpt-4",
+		"messages": [{"role": "user", "content": "Hi"}],
+		"seed": 42
+	}`
+
+	prog, err := (&ChatCompletionsParser{}).ParseRequest([]byte(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for _, inst := range prog.Code {
+		if inst.Op == EXT_DATA && inst.NS != StyleChatCompletions {
+			t.Errorf("EXT_DATA %s: namespace %q, want %q", inst.Key, inst.NS, StyleChatCompletions)
+		}
+	}
+	prog.EmitKeyJSON(EXT_DATA, "untagged", json.RawMessage(`true`))
+
+	// Foreign namespace is dropped, untagged extensions still apply.
+	out, err := (&AnthropicEmitter{}).EmitRequest(prog)
+	if err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	var result map[string]json.RawMessage
+	json.Unmarshal(out, &result)
+	if _, ok := result["seed"]; ok {
+		t.Error("seed from chat namespace should not reach the Anthropic request")
+	}
+	if _, ok := result["untagged"]; !ok {
+		t.Error("untagged EXT_DATA should always be applied")
+	}
+
+	// Explicitly accepted namespaces are applied.
+	out, err = (&AnthropicEmitter{AcceptExt: []Style{StyleChatCompletions}}).EmitRequest(prog)
+	if err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	result = nil
+	json.Unmarshal(out, &result)
+	if string(result["seed"]) != "42" {
+		t.Errorf("seed with AcceptExt: got %s, want 42", result["seed"])
+	}
+}
+
 func TestResponseFormatChatToResponses(t *testing.T) {
 	input := `{
 		"model": "gpt-4o",
@@ -0,0 +1,620 @@
+package ail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ─── Diff types ──────────────────────────────────────────────────────────────
+
+// ChangeKind classifies a single difference reported by Diff.
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"   // present only in b
+	ChangeRemoved ChangeKind = "removed" // present only in a
+	ChangeChanged ChangeKind = "changed" // present in both with different content
+)
+
+// DiffSpan is an inclusive instruction range [Start, End] in one program.
+type DiffSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Change is one structural difference between two programs.
+//
+// Path locates the difference, e.g. "config.SET_TEMP", "tools[search]",
+// "messages[2].call[call_1].args.city" or "messages[1→2].content[0]".
+// Message indices are written "a→b" when the aligned messages sit at
+// different positions. A and B are the affected instruction ranges in each
+// program (nil for the side where the element is absent); Old and New render
+// the differing content as disassembly, or as compact JSON for differences
+// inside CALL_ARGS, DEF_SCHEMA and other JSON arguments.
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	Path string     `json:"path"`
+	A    *DiffSpan  `json:"a,omitempty"`
+	B    *DiffSpan  `json:"b,omitempty"`
+	Old  string     `json:"old,omitempty"`
+	New  string     `json:"new,omitempty"`
+}
+
+// ProgramDiff is the result of Diff. It marshals to JSON as
+// {"changes": […]}; String renders it as unified text.
+type ProgramDiff struct {
+	Changes []Change `json:"changes"`
+}
+
+// Equal reports whether no differences were found.
+func (d *ProgramDiff) Equal() bool { return len(d.Changes) == 0 }
+
+// String renders the diff as unified text:
+//
+//	--- a
+//	+++ b
+//	@@ config.SET_TEMP @@ a[1] b[1]
+//	-SET_TEMP 0.7000
+//	+SET_TEMP 0.5000
+func (d *ProgramDiff) String() string {
+	var sb strings.Builder
+	sb.WriteString("--- a\n+++ b\n")
+	for _, c := range d.Changes {
+		sb.WriteString("@@ ")
+		sb.WriteString(c.Path)
+		sb.WriteString(" @@")
+		if c.A != nil {
+			sb.WriteString(" a" + c.A.String())
+		}
+		if c.B != nil {
+			sb.WriteString(" b" + c.B.String())
+		}
+		sb.WriteByte('\n')
+		writePrefixed(&sb, "-", c.Old)
+		writePrefixed(&sb, "+", c.New)
+	}
+	return sb.String()
+}
+
+// JSON renders the diff as indented JSON.
+func (d *ProgramDiff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// String formats the span as "[start]" or "[start-end]".
+func (s DiffSpan) String() string {
+	if s.Start == s.End {
+		return fmt.Sprintf("[%d]", s.Start)
+	}
+	return fmt.Sprintf("[%d-%d]", s.Start, s.End)
+}
+
+func writePrefixed(sb *strings.Builder, prefix, text string) {
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		sb.WriteString(prefix)
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+}
+
+// ─── Diff ────────────────────────────────────────────────────────────────────
+
+// Diff compares two programs structurally rather than line by line.
+// Top-level configuration, SET_META and EXT_DATA are matched by key, tool
+// definitions by name, messages by longest-common-subsequence alignment
+// (unmatched messages of the same role are compared in place), and tool
+// calls and results inside a message by call ID. JSON arguments are
+// compared value-by-value, so key order and whitespace do not register.
+func Diff(a, b *Program) *ProgramDiff {
+	d := &differ{a: a, b: b}
+	d.node("", buildDiffTree(a), buildDiffTree(b))
+	return &ProgramDiff{Changes: d.changes}
+}
+
+// diffNode is a keyed element of a program: a single instruction or a block.
+// Keyed children are matched by key; seq children are aligned by order.
+type diffNode struct {
+	key        string // path segment
+	kind       string // alignment class for seq pairing (e.g. "message:ROLE_USR")
+	start, end int    // inclusive instruction range
+	keyed      []*diffNode
+	seq        []*diffNode
+	container  bool
+}
+
+func buildDiffTree(p *Program) *diffNode {
+	root := &diffNode{container: true, start: 0, end: len(p.Code) - 1}
+	counts := map[string]int{}
+	msgIndex := 0
+
+	for i := 0; i < len(p.Code); i++ {
+		inst := p.Code[i]
+		switch inst.Op {
+		case MSG_START:
+			end := blockEnd(p, i, MSG_START, MSG_END)
+			msg := buildMessageNode(p, i, end)
+			msg.key = fmt.Sprintf("messages[%d]", msgIndex)
+			msgIndex++
+			root.seq = append(root.seq, msg)
+			i = end
+		case DEF_START:
+			end := blockEnd(p, i, DEF_START, DEF_END)
+			root.keyed = append(root.keyed, buildToolNodes(p, i, end)...)
+			i = end
+		default:
+			key := topLevelKey(inst, counts)
+			leaf := &diffNode{key: key, kind: inst.Op.Name(), start: i, end: i}
+			if isStreamOp(inst.Op) {
+				root.seq = append(root.seq, leaf)
+			} else {
+				root.keyed = append(root.keyed, leaf)
+			}
+		}
+	}
+	return root
+}
+
+// blockEnd returns the index of the END opcode closing the block opened at
+// start, or the last instruction if the block is unterminated.
+func blockEnd(p *Program, start int, open, close Opcode) int {
+	depth := 0
+	for j := start; j < len(p.Code); j++ {
+		switch p.Code[j].Op {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return len(p.Code) - 1
+}
+
+func isStreamOp(op Opcode) bool {
+	return op >= STREAM_START && op <= 0x6F
+}
+
+// topLevelKey names a top-level instruction. Repeated opcodes (SET_STOP,
+// stream events) get an occurrence index.
+func topLevelKey(inst Instruction, counts map[string]int) string {
+	var base string
+	switch inst.Op {
+	case SET_META:
+		base = "meta[" + inst.Key + "]"
+	case EXT_DATA:
+		base = "ext[" + extLabel(inst) + "]"
+	default:
+		base = inst.Op.Name()
+		if inst.Op >= SET_MODEL {
+			base = "config." + base
+		}
+	}
+	n := counts[base]
+	counts[base]++
+	if n > 0 || inst.Op == SET_STOP {
+		return fmt.Sprintf("%s#%d", base, n)
+	}
+	return base
+}
+
+func extLabel(inst Instruction) string {
+	if inst.NS != "" {
+		return string(inst.NS) + ":" + inst.Key
+	}
+	return inst.Key
+}
+
+// buildToolNodes splits a DEF block into one node per tool, spanning DEF_NAME
+// up to (not including) the next DEF_NAME or DEF_END.
+func buildToolNodes(p *Program, start, end int) []*diffNode {
+	var tools []*diffNode
+	for _, d := range p.ToolDefs() {
+		if d.BlockStart != start {
+			continue
+		}
+		tool := &diffNode{key: "tools[" + d.Name + "]", kind: "tool", start: d.Start, end: d.End, container: true}
+		for j := d.Start; j <= d.End; j++ {
+			inst := p.Code[j]
+			var key string
+			switch inst.Op {
+			case DEF_START, DEF_NAME, DEF_END:
+				continue
+			case DEF_DESC:
+				key = "description"
+			case DEF_SCHEMA:
+				key = "schema"
+			case SET_META:
+				key = "meta[" + inst.Key + "]"
+			case EXT_DATA:
+				key = "ext[" + extLabel(inst) + "]"
+			default:
+				key = inst.Op.Name()
+			}
+			tool.keyed = append(tool.keyed, &diffNode{key: key, start: j, end: j})
+		}
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+func buildMessageNode(p *Program, start, end int) *diffNode {
+	msg := &diffNode{start: start, end: end, container: true, kind: "message"}
+	content := 0
+	counts := map[string]int{}
+	addKeyed := func(key string, s, e int) *diffNode {
+		if n := counts[key]; n > 0 {
+			counts[key]++
+			key = fmt.Sprintf("%s#%d", key, n)
+		} else {
+			counts[key] = 1
+		}
+		n := &diffNode{key: key, start: s, end: e}
+		msg.keyed = append(msg.keyed, n)
+		return n
+	}
+	addContent := func(s, e int) {
+		msg.seq = append(msg.seq, &diffNode{
+			key: fmt.Sprintf("content[%d]", content), kind: p.Code[e].Op.Name(), start: s, end: e,
+		})
+		content++
+	}
+
+	for j := start + 1; j < end; j++ {
+		inst := p.Code[j]
+		switch inst.Op {
+		case ROLE_SYS, ROLE_USR, ROLE_AST, ROLE_TOOL:
+			msg.kind = "message:" + inst.Op.Name()
+			addKeyed("role", j, j)
+		case SET_META:
+			// media_type belongs to the following media reference.
+			if inst.Key == "media_type" && j+1 < end && (p.Code[j+1].Op == IMG_REF || p.Code[j+1].Op == AUD_REF) {
+				addContent(j, j+1)
+				j++
+				continue
+			}
+			addKeyed("meta["+inst.Key+"]", j, j)
+		case EXT_DATA:
+			addKeyed("ext["+extLabel(inst)+"]", j, j)
+		case RESP_DONE:
+			addKeyed("finish", j, j)
+		case CALL_START:
+			e := blockEnd(p, j, CALL_START, CALL_END)
+			id := inst.Str
+			if id == "" {
+				id = "#" + fmt.Sprint(counts["call"])
+				counts["call"]++
+			}
+			call := addKeyed("call["+id+"]", j, e)
+			call.container = true
+			for k := j + 1; k < e; k++ {
+				ci := p.Code[k]
+				key := ci.Op.Name()
+				switch ci.Op {
+				case CALL_NAME:
+					key = "name"
+				case CALL_ARGS:
+					key = "args"
+				case SET_META:
+					key = "meta[" + ci.Key + "]"
+				case EXT_DATA:
+					key = "ext[" + extLabel(ci) + "]"
+				}
+				call.keyed = append(call.keyed, &diffNode{key: key, start: k, end: k})
+			}
+			j = e
+		case RESULT_START:
+			e := blockEnd(p, j, RESULT_START, RESULT_END)
+			addKeyed("result["+inst.Str+"]", j, e)
+			j = e
+		case THINK_START:
+			e := blockEnd(p, j, THINK_START, THINK_END)
+			addContent(j, e)
+			j = e
+		default:
+			addContent(j, j)
+		}
+	}
+	return msg
+}
+
+// differ accumulates changes while walking two diff trees.
+type differ struct {
+	a, b    *Program
+	changes []Change
+}
+
+func (d *differ) add(kind ChangeKind, path string, an, bn *diffNode) {
+	c := Change{Kind: kind, Path: path}
+	if an != nil {
+		c.A = &DiffSpan{an.start, an.end}
+		c.Old = renderSpan(d.a, an.start, an.end)
+	}
+	if bn != nil {
+		c.B = &DiffSpan{bn.start, bn.end}
+		c.New = renderSpan(d.b, bn.start, bn.end)
+	}
+	d.changes = append(d.changes, c)
+}
+
+func joinPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// node compares two matched nodes at path.
+func (d *differ) node(path string, an, bn *diffNode) {
+	if !an.container || !bn.container {
+		d.leaf(path, an, bn)
+		return
+	}
+	d.keyed(path, an.keyed, bn.keyed)
+	d.seq(path, an.seq, bn.seq)
+}
+
+func (d *differ) keyed(path string, as, bs []*diffNode) {
+	bByKey := make(map[string]*diffNode, len(bs))
+	for _, n := range bs {
+		bByKey[n.key] = n
+	}
+	seen := make(map[string]bool, len(as))
+	for _, an := range as {
+		seen[an.key] = true
+		bn, ok := bByKey[an.key]
+		if !ok {
+			d.add(ChangeRemoved, joinPath(path, an.key), an, nil)
+			continue
+		}
+		if !d.equal(an, bn) {
+			d.node(joinPath(path, an.key), an, bn)
+		}
+	}
+	for _, bn := range bs {
+		if !seen[bn.key] {
+			d.add(ChangeAdded, joinPath(path, bn.key), nil, bn)
+		}
+	}
+}
+
+// seq aligns ordered children with an LCS over exact equality. Unmatched
+// runs between anchors are paired in order when their kinds agree and
+// compared in place; the rest are reported as added or removed.
+func (d *differ) seq(path string, as, bs []*diffNode) {
+	n, m := len(as), len(bs)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if d.equal(as[i], bs[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ga, gb []*diffNode
+	flush := func() {
+		k := 0
+		for ; k < len(ga) && k < len(gb) && ga[k].kind == gb[k].kind; k++ {
+			d.node(joinPath(path, pairKey(ga[k].key, gb[k].key)), ga[k], gb[k])
+		}
+		for _, an := range ga[k:] {
+			d.add(ChangeRemoved, joinPath(path, an.key), an, nil)
+		}
+		for _, bn := range gb[k:] {
+			d.add(ChangeAdded, joinPath(path, bn.key), nil, bn)
+		}
+		ga, gb = nil, nil
+	}
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case d.equal(as[i], bs[j]) && lcs[i][j] == lcs[i+1][j+1]+1:
+			flush()
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ga = append(ga, as[i])
+			i++
+		default:
+			gb = append(gb, bs[j])
+			j++
+		}
+	}
+	ga = append(ga, as[i:]...)
+	gb = append(gb, bs[j:]...)
+	flush()
+}
+
+// pairKey merges the keys of two aligned seq nodes: "messages[2]" and
+// "messages[3]" become "messages[2→3]".
+func pairKey(a, b string) string {
+	if a == b {
+		return a
+	}
+	ia, ib := strings.IndexByte(a, '['), strings.IndexByte(b, '[')
+	if ia < 0 || ib < 0 || a[:ia] != b[:ib] {
+		return a
+	}
+	return a[:len(a)-1] + "→" + b[ib+1:]
+}
+
+// leaf compares two single instructions or opaque blocks. Matching JSON
+// arguments are diffed value-by-value.
+func (d *differ) leaf(path string, an, bn *diffNode) {
+	if an.start == an.end && bn.start == bn.end {
+		ai, bi := d.a.Code[an.start], d.b.Code[bn.start]
+		if ai.Op == bi.Op && (jsonArgOps[ai.Op] || ai.Op == EXT_DATA) {
+			va, errA := decodeJSONValue(ai.JSON)
+			vb, errB := decodeJSONValue(bi.JSON)
+			if errA == nil && errB == nil {
+				span := func(n *diffNode) *DiffSpan { return &DiffSpan{n.start, n.end} }
+				for _, jc := range diffJSONValues("", va, vb) {
+					jc.Path = path + jc.Path
+					jc.A, jc.B = span(an), span(bn)
+					d.changes = append(d.changes, jc)
+				}
+				return
+			}
+		}
+	}
+	d.add(ChangeChanged, path, an, bn)
+}
+
+// equal reports whether two nodes cover equivalent instructions. Buffer
+// references compare by content; JSON arguments by value.
+func (d *differ) equal(an, bn *diffNode) bool {
+	if an.end-an.start != bn.end-bn.start || an.kind != bn.kind {
+		return false
+	}
+	for k := 0; k <= an.end-an.start; k++ {
+		if !d.sameInstruction(d.a.Code[an.start+k], d.b.Code[bn.start+k]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *differ) sameInstruction(x, y Instruction) bool {
+	if x.Op != y.Op || x.Str != y.Str || x.Num != y.Num || x.Int != y.Int || x.Key != y.Key || x.NS != y.NS {
+		return false
+	}
+	if refArgOps[x.Op] {
+		return bytes.Equal(bufferAt(d.a, x.Ref), bufferAt(d.b, y.Ref))
+	}
+	if bytes.Equal(x.JSON, y.JSON) {
+		return true
+	}
+	return bytes.Equal(canonicalJSON(x.JSON), canonicalJSON(y.JSON))
+}
+
+func bufferAt(p *Program, ref uint32) []byte {
+	if int(ref) < len(p.Buffers) {
+		return p.Buffers[ref]
+	}
+	return nil
+}
+
+// renderSpan disassembles instructions [start, end]. Buffer references are
+// shown with their size and a short content hash, since indices are not
+// comparable across programs.
+func renderSpan(p *Program, start, end int) string {
+	var sb strings.Builder
+	indent := 0
+	for _, inst := range p.Code[start : end+1] {
+		switch inst.Op {
+		case MSG_END, DEF_END, CALL_END, RESULT_END, STREAM_END, THINK_END:
+			indent = max(indent-1, 0)
+		}
+		sb.WriteString(strings.Repeat("  ", indent))
+		if refArgOps[inst.Op] {
+			buf := bufferAt(p, inst.Ref)
+			fmt.Fprintf(&sb, "%s ref:%d (%d bytes, sha256:%x)\n", inst.Op, inst.Ref, len(buf), sha256.Sum256(buf))
+		} else {
+			sb.WriteString((&Program{Code: []Instruction{inst}}).Disasm())
+		}
+		switch inst.Op {
+		case MSG_START, DEF_START, CALL_START, RESULT_START, STREAM_START, THINK_START:
+			indent++
+		}
+	}
+	return sb.String()
+}
+
+// ─── JSON value diff ─────────────────────────────────────────────────────────
+
+func decodeJSONValue(j json.RawMessage) (any, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// diffJSONValues returns changes between two decoded JSON values, with
+// paths relative to the value (".key", "[i]").
+func diffJSONValues(path string, a, b any) []Change {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var out []Change
+		for _, k := range keys {
+			x, inA := av[k]
+			y, inB := bv[k]
+			p := path + "." + k
+			switch {
+			case !inB:
+				out = append(out, Change{Kind: ChangeRemoved, Path: p, Old: compactJSONValue(x)})
+			case !inA:
+				out = append(out, Change{Kind: ChangeAdded, Path: p, New: compactJSONValue(y)})
+			default:
+				out = append(out, diffJSONValues(p, x, y)...)
+			}
+		}
+		return out
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		var out []Change
+		for i := 0; i < max(len(av), len(bv)); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(bv):
+				out = append(out, Change{Kind: ChangeRemoved, Path: p, Old: compactJSONValue(av[i])})
+			case i >= len(av):
+				out = append(out, Change{Kind: ChangeAdded, Path: p, New: compactJSONValue(bv[i])})
+			default:
+				out = append(out, diffJSONValues(p, av[i], bv[i])...)
+			}
+		}
+		return out
+	}
+	ja, jb := compactJSONValue(a), compactJSONValue(b)
+	if ja == jb {
+		return nil
+	}
+	return []Change{{Kind: ChangeChanged, Path: path, Old: ja, New: jb}}
+}
+
+func compactJSONValue(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,125 @@
+package ail
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func findChange(d *ProgramDiff, path string) (Change, bool) {
+	for _, c := range d.Changes {
+		if c.Path == path {
+			return c, true
+		}
+	}
+	return Change{}, false
+}
+
+func TestDiffEqual(t *testing.T) {
+	a := buildToolProgram()
+	b := buildToolProgram()
+	// Reformatted JSON and reordered buffers are not differences.
+	b.Code[4].JSON = json.RawMessage(`{ "properties": {"city": {"type":"string"}}, "type": "object" }`)
+	if d := Diff(a, b); !d.Equal() {
+		t.Fatalf("expected no changes, got:\n%s", d)
+	}
+}
+
+func TestDiffConfigAndTools(t *testing.T) {
+	a := Build().Model("m").Temperature(0.7).
+		Tools(Func("get_weather", "Get weather", json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`)),
+			Func("search", "Search", nil)).
+		User(Text("hi")).MustProgram()
+	b := Build().Model("m").Temperature(0.5).
+		Tools(Func("get_weather", "Get weather", json.RawMessage(`{"properties":{"city":{"type":"string"},"unit":{"type":"string"}},"type":"object"}`)),
+			Func("lookup", "Lookup", nil)).
+		User(Text("hi")).MustProgram()
+
+	d := Diff(a, b)
+	temp, ok := findChange(d, "config.SET_TEMP")
+	if !ok || temp.Kind != ChangeChanged || !strings.Contains(temp.Old, "0.7") || !strings.Contains(temp.New, "0.5") {
+		t.Errorf("temperature change = %+v", temp)
+	}
+	if c, ok := findChange(d, "tools[get_weather].schema.properties.unit"); !ok || c.Kind != ChangeAdded || c.New != `{"type":"string"}` {
+		t.Errorf("schema change = %+v (%v)", c, ok)
+	}
+	if c, ok := findChange(d, "tools[search]"); !ok || c.Kind != ChangeRemoved || c.A == nil || c.B != nil {
+		t.Errorf("removed tool = %+v", c)
+	}
+	if c, ok := findChange(d, "tools[lookup]"); !ok || c.Kind != ChangeAdded {
+		t.Errorf("added tool = %+v", c)
+	}
+	if len(d.Changes) != 4 {
+		t.Errorf("expected 4 changes, got:\n%s", d)
+	}
+}
+
+func TestDiffMessagesAligned(t *testing.T) {
+	a := Build().
+		System("sys").
+		User(Text("q1")).
+		Assistant(ToolCall("call_1", "get_weather", map[string]any{"city": "Paris", "days": 1})).
+		Tool(Result("call_1", "sunny")).
+		MustProgram()
+	b := Build().
+		System("sys").
+		User(Text("inserted")).
+		User(Text("q1")).
+		Assistant(ToolCall("call_1", "get_weather", map[string]any{"city": "London", "days": 1})).
+		Tool(Result("call_1", "sunny")).
+		MustProgram()
+
+	d := Diff(a, b)
+	if c, ok := findChange(d, "messages[1]"); !ok || c.Kind != ChangeAdded {
+		t.Errorf("inserted message not reported as added:\n%s", d)
+	}
+	c, ok := findChange(d, "messages[2→3].call[call_1].args.city")
+	if !ok || c.Kind != ChangeChanged || c.Old != `"Paris"` || c.New != `"London"` {
+		t.Errorf("args change = %+v\n%s", c, d)
+	}
+	if c.A == nil || a.Code[c.A.Start].Op != CALL_ARGS || c.B == nil || b.Code[c.B.Start].Op != CALL_ARGS {
+		t.Errorf("args change spans = %+v %+v", c.A, c.B)
+	}
+	if len(d.Changes) != 2 {
+		t.Errorf("expected 2 changes, got:\n%s", d)
+	}
+}
+
+func TestDiffContentAndBuffers(t *testing.T) {
+	a := Build().User(Text("look"), Image([]byte("aaa"), "image/png")).MustProgram()
+	b := Build().User(Text("look!"), Image([]byte("bbb"), "image/png")).MustProgram()
+
+	d := Diff(a, b)
+	if c, ok := findChange(d, "messages[0].content[0]"); !ok || c.Kind != ChangeChanged {
+		t.Errorf("text change missing:\n%s", d)
+	}
+	c, ok := findChange(d, "messages[0].content[1]")
+	if !ok || c.Kind != ChangeChanged || c.Old == c.New {
+		t.Errorf("image change = %+v", c)
+	}
+}
+
+func TestDiffRender(t *testing.T) {
+	a := Build().Model("a").MustProgram()
+	b := Build().Model("b").MustProgram()
+	d := Diff(a, b)
+
+	text := d.String()
+	for _, want := range []string{"--- a\n+++ b\n", "@@ config.SET_MODEL @@ a[0] b[0]\n", "-SET_MODEL a\n", "+SET_MODEL b\n"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text missing %q:\n%s", want, text)
+		}
+	}
+
+	out, err := d.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back ProgramDiff
+	if err := json.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Changes) != 1 || back.Changes[0].Kind != ChangeChanged || back.Changes[0].A.Start != 0 {
+		t.Errorf("json round trip = %+v", back)
+	}
+}
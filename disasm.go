@@ -72,9 +72,9 @@ func (p *Program) Disasm() string {
 
 		switch inst.Op {
 		case TXT_CHUNK, DEF_NAME, DEF_DESC, CALL_START, CALL_NAME,
-			RESULT_START, RESULT_DATA, RESP_ID, RESP_MODEL, RESP_DONE,
+			RESULT_START, RESULT_DATA, RESP_ID, RESP_MODEL,
 			SET_MODEL, SET_STOP, STREAM_DELTA,
-			THINK_CHUNK, STREAM_THINK_DELTA:
+			THINK_CHUNK, STREAM_THINK_DELTA, STREAM_THINK_SIG:
 			writeStr(inst.Str)
 
 		case SET_TEMP, SET_TOPP:
@@ -86,7 +86,8 @@ func (p *Program) Disasm() string {
 		case IMG_REF, AUD_REF, TXT_REF, THINK_REF:
 			sb.WriteString(fmt.Sprintf(" ref:%d", inst.Ref))
 
-		case DEF_SCHEMA, CALL_ARGS, USAGE, STREAM_TOOL_DELTA, SET_THINK, SET_FMT:
+		case DEF_SCHEMA, CALL_ARGS, USAGE, RESP_ERROR, STREAM_TOOL_DELTA, STREAM_BLOCK_START, STREAM_BLOCK_END, STREAM_ERROR,
+			SET_THINK, SET_FMT:
 			writeJSON(inst.JSON)
 
 		case SET_META:
@@ -95,7 +96,21 @@ func (p *Program) Disasm() string {
 			sb.WriteByte(' ')
 			sb.WriteString(inst.Str)
 
+		case RESP_DONE:
+			sb.WriteByte(' ')
+			sb.WriteString(inst.Str)
+			if inst.Key != "" {
+				sb.WriteString(" @")
+				sb.WriteString(string(inst.NS))
+				sb.WriteByte(' ')
+				sb.WriteString(inst.Key)
+			}
+
 		case EXT_DATA:
+			if inst.NS != "" {
+				sb.WriteString(" @")
+				sb.WriteString(string(inst.NS))
+			}
 			sb.WriteByte(' ')
 			sb.WriteString(inst.Key)
 			writeJSON(inst.JSON)
@@ -7,9 +7,26 @@ import (
 // ─── Anthropic Messages Emitter ──────────────────────────────────────────────
 
 // AnthropicEmitter converts an AIL Program into Anthropic Messages API JSON.
-type AnthropicEmitter struct{}
+type AnthropicEmitter struct {
+	// AcceptExt lists foreign EXT_DATA namespaces whose extensions are
+	// applied in addition to StyleAnthropic's own. Untagged extensions are
+	// always applied.
+	AcceptExt []Style
+
+	// ToolIDs names tool calls that arrive without an ID (Google GenAI);
+	// nil uses DefaultToolIDs. See Program.AssignToolIDs.
+	ToolIDs ToolIDFunc
+}
+
+func (e *AnthropicEmitter) toolIDs() ToolIDFunc {
+	if e.ToolIDs != nil {
+		return e.ToolIDs
+	}
+	return DefaultToolIDs(StyleAnthropic)
+}
 
 func (e *AnthropicEmitter) EmitRequest(prog *Program) ([]byte, error) {
+	prog = prog.AssignToolIDs(e.toolIDs())
 	result := make(map[string]any)
 	ec := NewExtrasCollector()
 	var messages []map[string]any
@@ -293,7 +310,9 @@ func (e *AnthropicEmitter) EmitRequest(prog *Program) ([]byte, error) {
 			}
 
 		case EXT_DATA:
-			ec.AddJSON(inst.Key, inst.JSON)
+			if acceptsExt(inst.NS, StyleAnthropic, e.AcceptExt) {
+				ec.AddJSON(inst.Key, inst.JSON)
+			}
 		}
 	}
 
@@ -5,6 +5,7 @@ import (
 )
 
 func (e *AnthropicEmitter) EmitResponse(prog *Program) ([]byte, error) {
+	prog = prog.AssignToolIDs(e.toolIDs())
 	result := map[string]any{
 		"type": "message",
 		"role": "assistant",
@@ -27,18 +28,7 @@ func (e *AnthropicEmitter) EmitResponse(prog *Program) ([]byte, error) {
 		case RESP_MODEL:
 			result["model"] = inst.Str
 		case USAGE:
-			// Convert standard usage to Anthropic format
-			var usage struct {
-				PromptTokens     int `json:"prompt_tokens"`
-				CompletionTokens int `json:"completion_tokens"`
-				TotalTokens      int `json:"total_tokens"`
-			}
-			if json.Unmarshal(inst.JSON, &usage) == nil {
-				result["usage"] = map[string]int{
-					"input_tokens":  usage.PromptTokens,
-					"output_tokens": usage.CompletionTokens,
-				}
-			}
+			result["usage"] = decodeUsage(inst.JSON).anthropic()
 
 		case MSG_START:
 			ec.Push()
@@ -128,19 +118,12 @@ func (e *AnthropicEmitter) EmitResponse(prog *Program) ([]byte, error) {
 			ec.Pop()
 
 		case RESP_DONE:
-			switch inst.Str {
-			case "stop":
-				result["stop_reason"] = "end_turn"
-			case "tool_calls":
-				result["stop_reason"] = "tool_use"
-			case "length":
-				result["stop_reason"] = "max_tokens"
-			default:
-				result["stop_reason"] = inst.Str
-			}
+			result["stop_reason"] = finishFor(inst, StyleAnthropic)
 
 		case EXT_DATA:
-			ec.AddJSON(inst.Key, inst.JSON)
+			if acceptsExt(inst.NS, StyleAnthropic, e.AcceptExt) {
+				ec.AddJSON(inst.Key, inst.JSON)
+			}
 
 		case SET_META:
 			if inst.Key != "media_type" {
@@ -19,6 +19,9 @@ func (e *AnthropicEmitter) EmitStreamChunk(prog *Program) ([]byte, error) {
 				if ahead.Op == RESP_MODEL {
 					msgObj["model"] = ahead.Str
 				}
+				if ahead.Op == USAGE {
+					msgObj["usage"] = decodeUsage(ahead.JSON).anthropic()
+				}
 			}
 			event["message"] = msgObj
 			return json.Marshal(event)
@@ -43,6 +46,47 @@ func (e *AnthropicEmitter) EmitStreamChunk(prog *Program) ([]byte, error) {
 			}
 			return json.Marshal(event)
 
+		case STREAM_THINK_SIG:
+			event := map[string]any{
+				"type": "content_block_delta",
+				"delta": map[string]any{
+					"type":      "signature_delta",
+					"signature": inst.Str,
+				},
+			}
+			return json.Marshal(event)
+
+		case STREAM_BLOCK_START:
+			var b struct {
+				Index int    `json:"index"`
+				Type  string `json:"type"`
+			}
+			if json.Unmarshal(inst.JSON, &b) == nil {
+				block := map[string]any{"type": b.Type}
+				switch b.Type {
+				case "text":
+					block["text"] = ""
+				case "thinking":
+					block["thinking"] = ""
+				case "tool_use":
+					block["input"] = map[string]any{}
+				}
+				event := map[string]any{
+					"type":          "content_block_start",
+					"index":         b.Index,
+					"content_block": block,
+				}
+				return json.Marshal(event)
+			}
+
+		case STREAM_BLOCK_END:
+			var b struct {
+				Index int `json:"index"`
+			}
+			if json.Unmarshal(inst.JSON, &b) == nil {
+				return json.Marshal(map[string]any{"type": "content_block_stop", "index": b.Index})
+			}
+
 		case STREAM_TOOL_DELTA:
 			var td map[string]any
 			if json.Unmarshal(inst.JSON, &td) == nil {
@@ -52,9 +96,10 @@ func (e *AnthropicEmitter) EmitStreamChunk(prog *Program) ([]byte, error) {
 						"type":  "content_block_start",
 						"index": td["index"],
 						"content_block": map[string]any{
-							"type": "tool_use",
-							"id":   td["id"],
-							"name": td["name"],
+							"type":  "tool_use",
+							"id":    td["id"],
+							"name":  td["name"],
+							"input": map[string]any{},
 						},
 					}
 					return json.Marshal(event)
@@ -73,26 +118,15 @@ func (e *AnthropicEmitter) EmitStreamChunk(prog *Program) ([]byte, error) {
 			}
 
 		case RESP_DONE:
-			stopReason := "end_turn"
-			switch inst.Str {
-			case "stop":
-				stopReason = "end_turn"
-			case "tool_calls":
-				stopReason = "tool_use"
-			case "length":
-				stopReason = "max_tokens"
-			default:
-				stopReason = inst.Str
-			}
 			event := map[string]any{
 				"type":  "message_delta",
-				"delta": map[string]any{"stop_reason": stopReason},
+				"delta": map[string]any{"stop_reason": finishFor(inst, StyleAnthropic)},
 			}
 			// Look ahead for USAGE in the same chunk (Anthropic puts
 			// usage alongside stop_reason in message_delta).
 			for _, ahead := range prog.Code {
 				if ahead.Op == USAGE {
-					event["usage"] = json.RawMessage(ahead.JSON)
+					event["usage"] = decodeUsage(ahead.JSON).anthropic()
 				}
 			}
 			return json.Marshal(event)
@@ -100,6 +134,10 @@ func (e *AnthropicEmitter) EmitStreamChunk(prog *Program) ([]byte, error) {
 		case STREAM_END:
 			return json.Marshal(map[string]any{"type": "message_stop"})
 
+		case STREAM_ERROR:
+			body, _ := anthropicErrorBody(decodeProviderError(inst.JSON))
+			return json.Marshal(body)
+
 		case EXT_DATA:
 			// Stream events are typed — top-level EXT_DATA is merged
 			// into the next event if any, but for simplicity we skip
@@ -7,9 +7,16 @@ import (
 // ─── Google GenAI Emitter ────────────────────────────────────────────────────
 
 // GoogleGenAIEmitter converts an AIL Program into Google GenAI JSON.
-type GoogleGenAIEmitter struct{}
+type GoogleGenAIEmitter struct {
+	// AcceptExt lists foreign EXT_DATA namespaces whose extensions are
+	// applied in addition to StyleGoogleGenAI's own. Untagged extensions are
+	// always applied.
+	AcceptExt []Style
+}
 
 func (e *GoogleGenAIEmitter) EmitRequest(prog *Program) ([]byte, error) {
+	// Gemini matches results to calls by function name, not ID.
+	callNames := toolCallNames(prog)
 	result := make(map[string]any)
 	ec := NewExtrasCollector()
 	var contents []map[string]any
@@ -166,9 +173,13 @@ func (e *GoogleGenAIEmitter) EmitRequest(prog *Program) ([]byte, error) {
 			ec.Pop()
 
 		case RESULT_START:
+			name := inst.Str
+			if n, ok := callNames[inst.Str]; ok {
+				name = n
+			}
 			parts = append(parts, map[string]any{
 				"functionResponse": map[string]any{
-					"name": inst.Str,
+					"name": name,
 				},
 			})
 
@@ -248,7 +259,9 @@ func (e *GoogleGenAIEmitter) EmitRequest(prog *Program) ([]byte, error) {
 
 		// Extensions
 		case EXT_DATA:
-			ec.AddJSON(inst.Key, inst.JSON)
+			if acceptsExt(inst.NS, StyleGoogleGenAI, e.AcceptExt) {
+				ec.AddJSON(inst.Key, inst.JSON)
+			}
 		}
 	}
 
@@ -24,18 +24,7 @@ func (e *GoogleGenAIEmitter) EmitResponse(prog *Program) ([]byte, error) {
 			result["modelVersion"] = inst.Str
 
 		case USAGE:
-			var usage struct {
-				PromptTokens     int `json:"prompt_tokens"`
-				CompletionTokens int `json:"completion_tokens"`
-				TotalTokens      int `json:"total_tokens"`
-			}
-			if json.Unmarshal(inst.JSON, &usage) == nil {
-				result["usageMetadata"] = map[string]int{
-					"promptTokenCount":     usage.PromptTokens,
-					"candidatesTokenCount": usage.CompletionTokens,
-					"totalTokenCount":      usage.TotalTokens,
-				}
-			}
+			result["usageMetadata"] = decodeUsage(inst.JSON).gemini()
 
 		case MSG_START:
 			ec.Push()
@@ -104,17 +93,12 @@ func (e *GoogleGenAIEmitter) EmitResponse(prog *Program) ([]byte, error) {
 			ec.Pop()
 
 		case RESP_DONE:
-			switch inst.Str {
-			case "stop":
-				finishReason = "STOP"
-			case "length":
-				finishReason = "MAX_TOKENS"
-			default:
-				finishReason = inst.Str
-			}
+			finishReason = finishFor(inst, StyleGoogleGenAI)
 
 		case EXT_DATA:
-			ec.AddJSON(inst.Key, inst.JSON)
+			if acceptsExt(inst.NS, StyleGoogleGenAI, e.AcceptExt) {
+				ec.AddJSON(inst.Key, inst.JSON)
+			}
 
 		case SET_META:
 			if inst.Key != "media_type" {
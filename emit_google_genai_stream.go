@@ -5,6 +5,11 @@ import (
 )
 
 func (e *GoogleGenAIEmitter) EmitStreamChunk(prog *Program) ([]byte, error) {
+	if se := prog.StreamError(); se != nil {
+		body, _ := geminiErrorBody(se)
+		return json.Marshal(body)
+	}
+
 	result := make(map[string]any)
 	ec := NewExtrasCollector()
 
@@ -22,6 +27,17 @@ func (e *GoogleGenAIEmitter) EmitStreamChunk(prog *Program) ([]byte, error) {
 		case STREAM_THINK_DELTA:
 			parts = append(parts, map[string]any{"thought": true, "text": inst.Str})
 
+		case STREAM_THINK_SIG:
+			// The signature goes on the thought part it closes, or on an
+			// empty thought part of its own.
+			if n := len(parts); n > 0 {
+				if p := parts[n-1].(map[string]any); p["thought"] == true {
+					p["thoughtSignature"] = inst.Str
+					break
+				}
+			}
+			parts = append(parts, map[string]any{"thought": true, "text": "", "thoughtSignature": inst.Str})
+
 		case STREAM_TOOL_DELTA:
 			var td map[string]any
 			if json.Unmarshal(inst.JSON, &td) == nil {
@@ -29,38 +45,24 @@ func (e *GoogleGenAIEmitter) EmitStreamChunk(prog *Program) ([]byte, error) {
 				if name, ok := td["name"]; ok {
 					fc["name"] = name
 				}
-				if args, ok := td["arguments"]; ok {
-					fc["args"] = json.RawMessage(args.(string))
+				if args, ok := td["arguments"].(string); ok {
+					// Arguments cut short (an interrupted stream) are
+					// still written as valid JSON.
+					fc["args"] = toolArgsJSON([]byte(args))
 				}
 				parts = append(parts, map[string]any{"functionCall": fc})
 			}
 
 		case RESP_DONE:
-			switch inst.Str {
-			case "stop":
-				finishReason = "STOP"
-			case "length":
-				finishReason = "MAX_TOKENS"
-			default:
-				finishReason = inst.Str
-			}
+			finishReason = finishFor(inst, StyleGoogleGenAI)
 
 		case USAGE:
-			var usage struct {
-				PromptTokens     int `json:"prompt_tokens"`
-				CompletionTokens int `json:"completion_tokens"`
-				TotalTokens      int `json:"total_tokens"`
-			}
-			if json.Unmarshal(inst.JSON, &usage) == nil {
-				result["usageMetadata"] = map[string]int{
-					"promptTokenCount":     usage.PromptTokens,
-					"candidatesTokenCount": usage.CompletionTokens,
-					"totalTokenCount":      usage.TotalTokens,
-				}
-			}
+			result["usageMetadata"] = decodeUsage(inst.JSON).gemini()
 
 		case EXT_DATA:
-			ec.AddJSON(inst.Key, inst.JSON)
+			if acceptsExt(inst.NS, StyleGoogleGenAI, e.AcceptExt) {
+				ec.AddJSON(inst.Key, inst.JSON)
+			}
 
 		case SET_META:
 			if inst.Key != "media_type" {
@@ -7,9 +7,26 @@ import (
 // ─── OpenAI Chat Completions Emitter ─────────────────────────────────────────
 
 // ChatCompletionsEmitter converts an AIL Program into OpenAI Chat Completions JSON.
-type ChatCompletionsEmitter struct{}
+type ChatCompletionsEmitter struct {
+	// AcceptExt lists foreign EXT_DATA namespaces whose extensions are
+	// applied in addition to StyleChatCompletions's own. Untagged extensions are
+	// always applied.
+	AcceptExt []Style
+
+	// ToolIDs names tool calls that arrive without an ID (Google GenAI);
+	// nil uses DefaultToolIDs. See Program.AssignToolIDs.
+	ToolIDs ToolIDFunc
+}
+
+func (e *ChatCompletionsEmitter) toolIDs() ToolIDFunc {
+	if e.ToolIDs != nil {
+		return e.ToolIDs
+	}
+	return DefaultToolIDs(StyleChatCompletions)
+}
 
 func (e *ChatCompletionsEmitter) EmitRequest(prog *Program) ([]byte, error) {
+	prog = prog.AssignToolIDs(e.toolIDs())
 	result := make(map[string]any)
 	ec := NewExtrasCollector()
 	var messages []map[string]any
@@ -33,6 +50,7 @@ func (e *ChatCompletionsEmitter) EmitRequest(prog *Program) ([]byte, error) {
 
 	// Tool result state
 	var currentToolCallID string
+	var toolResults []map[string]any // results of the current tool message
 
 	// Stop sequences
 	var stopSeqs []string
@@ -71,6 +89,7 @@ func (e *ChatCompletionsEmitter) EmitRequest(prog *Program) ([]byte, error) {
 			isMultimodal = false
 			toolCalls = nil
 			currentToolCallID = ""
+			toolResults = nil
 			reasoningContent = ""
 			inThinking = false
 
@@ -189,10 +208,20 @@ func (e *ChatCompletionsEmitter) EmitRequest(prog *Program) ([]byte, error) {
 			textContent = inst.Str
 
 		case RESULT_END:
-			// will be finalized in MSG_END
+			// The last result is finalized in MSG_END.
+			toolResults = append(toolResults, map[string]any{
+				"role":         "tool",
+				"tool_call_id": currentToolCallID,
+				"content":      textContent,
+			})
 
 		case MSG_END:
 			if currentMsg != nil {
+				// Chat has one tool message per result; a message
+				// answering several calls (Gemini) is split.
+				if currentRole == "tool" && len(toolResults) > 1 {
+					messages = append(messages, toolResults[:len(toolResults)-1]...)
+				}
 				currentMsg["role"] = currentRole
 
 				if currentRole == "tool" && currentToolCallID != "" {
@@ -275,7 +304,9 @@ func (e *ChatCompletionsEmitter) EmitRequest(prog *Program) ([]byte, error) {
 			}
 
 		case EXT_DATA:
-			ec.AddJSON(inst.Key, inst.JSON)
+			if acceptsExt(inst.NS, StyleChatCompletions, e.AcceptExt) {
+				ec.AddJSON(inst.Key, inst.JSON)
+			}
 		}
 	}
 
@@ -5,6 +5,7 @@ import (
 )
 
 func (e *ChatCompletionsEmitter) EmitResponse(prog *Program) ([]byte, error) {
+	prog = prog.AssignToolIDs(e.toolIDs())
 	result := map[string]any{
 		"object": "chat.completion",
 	}
@@ -28,7 +29,7 @@ func (e *ChatCompletionsEmitter) EmitResponse(prog *Program) ([]byte, error) {
 		case RESP_MODEL:
 			result["model"] = inst.Str
 		case USAGE:
-			result["usage"] = json.RawMessage(inst.JSON)
+			result["usage"] = decodeUsage(inst.JSON).openAI()
 
 		case MSG_START:
 			ec.Push()
@@ -102,11 +103,13 @@ func (e *ChatCompletionsEmitter) EmitResponse(prog *Program) ([]byte, error) {
 
 		case RESP_DONE:
 			if currentChoice != nil {
-				currentChoice["finish_reason"] = inst.Str
+				currentChoice["finish_reason"] = finishFor(inst, StyleChatCompletions)
 			}
 
 		case EXT_DATA:
-			ec.AddJSON(inst.Key, inst.JSON)
+			if acceptsExt(inst.NS, StyleChatCompletions, e.AcceptExt) {
+				ec.AddJSON(inst.Key, inst.JSON)
+			}
 
 		case SET_META:
 			if inst.Key != "media_type" {
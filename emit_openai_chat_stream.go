@@ -5,6 +5,11 @@ import (
 )
 
 func (e *ChatCompletionsEmitter) EmitStreamChunk(prog *Program) ([]byte, error) {
+	if se := prog.StreamError(); se != nil {
+		body, _ := openAIErrorBody(se)
+		return json.Marshal(body)
+	}
+
 	result := map[string]any{
 		"object": "chat.completion.chunk",
 	}
@@ -20,7 +25,7 @@ func (e *ChatCompletionsEmitter) EmitStreamChunk(prog *Program) ([]byte, error)
 		case RESP_MODEL:
 			result["model"] = inst.Str
 		case USAGE:
-			result["usage"] = json.RawMessage(inst.JSON)
+			result["usage"] = decodeUsage(inst.JSON).openAI()
 
 		case STREAM_START:
 			delta = make(map[string]any)
@@ -77,19 +82,22 @@ func (e *ChatCompletionsEmitter) EmitStreamChunk(prog *Program) ([]byte, error)
 				if len(fn) > 0 {
 					tc["function"] = fn
 				}
-				delta["tool_calls"] = []any{tc}
+				calls, _ := delta["tool_calls"].([]any)
+				delta["tool_calls"] = append(calls, tc)
 			}
 
 		case RESP_DONE:
 			choice := map[string]any{
 				"index":         0,
 				"delta":         map[string]any{},
-				"finish_reason": inst.Str,
+				"finish_reason": finishFor(inst, StyleChatCompletions),
 			}
 			choices = append(choices, choice)
 
 		case EXT_DATA:
-			ec.AddJSON(inst.Key, inst.JSON)
+			if acceptsExt(inst.NS, StyleChatCompletions, e.AcceptExt) {
+				ec.AddJSON(inst.Key, inst.JSON)
+			}
 
 		case SET_META:
 			if inst.Key != "media_type" {
@@ -7,7 +7,16 @@ import (
 // ─── OpenAI Responses API Emitter ────────────────────────────────────────────
 
 // ResponsesEmitter converts an AIL Program into OpenAI Responses API JSON.
-type ResponsesEmitter struct{}
+//
+// Tool calls and results are not written yet (no function_call or
+// function_call_output input items), so unlike the Anthropic and Chat
+// Completions emitters it needs no tool call IDs and has no ToolIDs field.
+type ResponsesEmitter struct {
+	// AcceptExt lists foreign EXT_DATA namespaces whose extensions are
+	// applied in addition to StyleResponses's own. Untagged extensions are
+	// always applied.
+	AcceptExt []Style
+}
 
 func (e *ResponsesEmitter) EmitRequest(prog *Program) ([]byte, error) {
 	result := make(map[string]any)
@@ -132,7 +141,9 @@ func (e *ResponsesEmitter) EmitRequest(prog *Program) ([]byte, error) {
 			}
 
 		case EXT_DATA:
-			ec.AddJSON(inst.Key, inst.JSON)
+			if acceptsExt(inst.NS, StyleResponses, e.AcceptExt) {
+				ec.AddJSON(inst.Key, inst.JSON)
+			}
 		}
 	}
 
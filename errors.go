@@ -0,0 +1,486 @@
+package ail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ─── Provider errors ─────────────────────────────────────────────────────────
+
+// ErrorKind is the provider-neutral category of an API error.
+type ErrorKind string
+
+const (
+	ErrorRateLimit      ErrorKind = "rate_limit"      // too many requests or tokens (429)
+	ErrorOverloaded     ErrorKind = "overloaded"      // provider temporarily overloaded (503, 529)
+	ErrorInvalidRequest ErrorKind = "invalid_request" // malformed or unsupported request (4xx)
+	ErrorAuth           ErrorKind = "auth"            // missing, invalid or insufficient credentials (401, 403)
+	ErrorContextLength  ErrorKind = "context_length"  // prompt exceeds the model's context window
+	ErrorContentFilter  ErrorKind = "content_filter"  // request or output blocked by a safety filter
+	ErrorServer         ErrorKind = "server"          // any other provider failure (5xx)
+)
+
+// ProviderError is an error reported by a provider, either as a
+// non-streaming error body (RESP_ERROR) or in the middle of a stream
+// (STREAM_ERROR). Both instructions carry it as JSON.
+//
+// Type and Code are the provider's own vocabulary ("overloaded_error",
+// "RESOURCE_EXHAUSTED", "context_length_exceeded"); Kind is the normalized
+// category emitters use to pick the target's vocabulary.
+type ProviderError struct {
+	Kind    ErrorKind `json:"kind"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	Status  int       `json:"status,omitempty"` // HTTP status
+	Code    string    `json:"code,omitempty"`   // provider error code, if any
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("ail: provider error: %s (%s, %d): %s", e.Kind, e.Type, e.Status, e.Message)
+}
+
+// ResponseError returns the RESP_ERROR of the program, or nil.
+func (p *Program) ResponseError() *ProviderError {
+	for _, inst := range p.Code {
+		if inst.Op == RESP_ERROR {
+			return decodeProviderError(inst.JSON)
+		}
+	}
+	return nil
+}
+
+// emit appends e to prog as op (RESP_ERROR or STREAM_ERROR).
+func (e *ProviderError) emit(prog *Program, op Opcode) {
+	j, _ := json.Marshal(e)
+	prog.EmitJSON(op, j)
+}
+
+func decodeProviderError(j json.RawMessage) *ProviderError {
+	var e ProviderError
+	if json.Unmarshal(j, &e) != nil {
+		e = ProviderError{Type: "api_error", Message: string(j)}
+	}
+	if e.Status == 0 {
+		e.Status = http.StatusInternalServerError
+	}
+	if e.Kind == "" {
+		e.Kind = classifyError(&e)
+	}
+	return &e
+}
+
+// classifyError derives the ErrorKind of e from its status, type, code and
+// message.
+func classifyError(e *ProviderError) ErrorKind {
+	s := strings.ToLower(e.Type + " " + e.Code + " " + e.Message)
+	switch {
+	case containsAny(s, "context_length", "context length", "context window", "maximum context",
+		"prompt is too long", "input is too long", "exceeds the maximum number of tokens"):
+		return ErrorContextLength
+	case containsAny(s, "content_filter", "content filter", "content_policy", "content management policy",
+		"safety settings", "prohibited_content"):
+		return ErrorContentFilter
+	case e.Status == 529 || e.Status == http.StatusServiceUnavailable ||
+		containsAny(s, "overloaded", "unavailable"):
+		return ErrorOverloaded
+	case e.Status == http.StatusTooManyRequests:
+		return ErrorRateLimit
+	case e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden:
+		return ErrorAuth
+	case e.Status >= 400 && e.Status < 500:
+		return ErrorInvalidRequest
+	}
+	return ErrorServer
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// ─── Provider error vocabularies ─────────────────────────────────────────────
+
+// errorVocab describes one provider's error vocabulary.
+type errorVocab struct {
+	types map[string]int            // native error type → HTTP status
+	kinds map[ErrorKind]nativeError // how each kind is reported
+}
+
+type nativeError struct {
+	Type   string
+	Status int
+	Code   string
+}
+
+// translate returns the target type, code and HTTP status for e. A type
+// the target already knows is kept; anything else goes through e.Kind.
+func (v errorVocab) translate(e *ProviderError) nativeError {
+	kind := e.Kind
+	if kind == "" {
+		kind = classifyError(e)
+	}
+	byKind, ok := v.kinds[kind]
+	if !ok {
+		byKind = v.kinds[ErrorServer]
+	}
+	if status, ok := v.types[e.Type]; ok {
+		if e.Status != 0 {
+			status = e.Status
+		}
+		code := e.Code
+		if code == "" {
+			code = byKind.Code
+		}
+		return nativeError{Type: e.Type, Status: status, Code: code}
+	}
+	if e.Code != "" {
+		byKind.Code = e.Code
+	}
+	return byKind
+}
+
+var anthropicErrors = errorVocab{
+	types: map[string]int{
+		"invalid_request_error": 400,
+		"authentication_error":  401,
+		"billing_error":         402,
+		"permission_error":      403,
+		"not_found_error":       404,
+		"request_too_large":     413,
+		"rate_limit_error":      429,
+		"api_error":             500,
+		"timeout_error":         504,
+		"overloaded_error":      529,
+	},
+	kinds: map[ErrorKind]nativeError{
+		ErrorRateLimit:      {"rate_limit_error", 429, ""},
+		ErrorOverloaded:     {"overloaded_error", 529, ""},
+		ErrorInvalidRequest: {"invalid_request_error", 400, ""},
+		ErrorAuth:           {"authentication_error", 401, ""},
+		ErrorContextLength:  {"invalid_request_error", 400, ""},
+		ErrorContentFilter:  {"invalid_request_error", 400, ""},
+		ErrorServer:         {"api_error", 500, ""},
+	},
+}
+
+// openAIErrors covers Chat Completions and Responses, which share the
+// OpenAI error object.
+var openAIErrors = errorVocab{
+	types: map[string]int{
+		"invalid_request_error": 400,
+		"authentication_error":  401,
+		"permission_error":      403,
+		"not_found_error":       404,
+		"rate_limit_error":      429,
+		"server_error":          500,
+	},
+	kinds: map[ErrorKind]nativeError{
+		ErrorRateLimit:      {"rate_limit_error", 429, "rate_limit_exceeded"},
+		ErrorOverloaded:     {"server_error", 503, ""},
+		ErrorInvalidRequest: {"invalid_request_error", 400, ""},
+		ErrorAuth:           {"authentication_error", 401, "invalid_api_key"},
+		ErrorContextLength:  {"invalid_request_error", 400, "context_length_exceeded"},
+		ErrorContentFilter:  {"invalid_request_error", 400, "content_policy_violation"},
+		ErrorServer:         {"server_error", 500, ""},
+	},
+}
+
+// openAIErrorCodes gives the HTTP status of OpenAI error codes, which are
+// more specific than the types.
+var openAIErrorCodes = map[string]int{
+	"context_length_exceeded":  400,
+	"content_policy_violation": 400,
+	"content_filter":           400,
+	"invalid_api_key":          401,
+	"rate_limit_exceeded":      429,
+	"insufficient_quota":       429,
+}
+
+var geminiErrors = errorVocab{
+	types: map[string]int{
+		"INVALID_ARGUMENT":    400,
+		"FAILED_PRECONDITION": 400,
+		"OUT_OF_RANGE":        400,
+		"UNAUTHENTICATED":     401,
+		"PERMISSION_DENIED":   403,
+		"NOT_FOUND":           404,
+		"RESOURCE_EXHAUSTED":  429,
+		"CANCELLED":           499,
+		"INTERNAL":            500,
+		"UNKNOWN":             500,
+		"UNAVAILABLE":         503,
+		"DEADLINE_EXCEEDED":   504,
+	},
+	kinds: map[ErrorKind]nativeError{
+		ErrorRateLimit:      {"RESOURCE_EXHAUSTED", 429, ""},
+		ErrorOverloaded:     {"UNAVAILABLE", 503, ""},
+		ErrorInvalidRequest: {"INVALID_ARGUMENT", 400, ""},
+		ErrorAuth:           {"UNAUTHENTICATED", 401, ""},
+		ErrorContextLength:  {"INVALID_ARGUMENT", 400, ""},
+		ErrorContentFilter:  {"INVALID_ARGUMENT", 400, ""},
+		ErrorServer:         {"INTERNAL", 500, ""},
+	},
+}
+
+// ─── Parsing ─────────────────────────────────────────────────────────────────
+
+// The parse helpers read a provider's error object. status is the HTTP
+// status of the response, or 0 in a stream, where it is inferred.
+
+// parseAnthropicError reads the "error" object of an Anthropic error body
+// or stream event.
+func parseAnthropicError(raw json.RawMessage, status int) *ProviderError {
+	var e ProviderError
+	json.Unmarshal(raw, &e)
+	return finishProviderError(&e, status, anthropicErrors.types[e.Type])
+}
+
+// parseOpenAIError reads an OpenAI error object, used by Chat Completions
+// and Responses. The code may be a string or a number.
+func parseOpenAIError(raw json.RawMessage, status int) *ProviderError {
+	var o struct {
+		Type    string          `json:"type"`
+		Message string          `json:"message"`
+		Code    json.RawMessage `json:"code"`
+	}
+	json.Unmarshal(raw, &o)
+	e := &ProviderError{Type: o.Type, Message: o.Message, Code: rawCode(o.Code)}
+	if e.Type == "" {
+		e.Type = e.Code
+	}
+	inferred, ok := openAIErrorCodes[e.Code]
+	if !ok {
+		inferred = openAIErrors.types[e.Type]
+	}
+	return finishProviderError(e, status, inferred)
+}
+
+// parseGeminiError reads a Google RPC error object.
+func parseGeminiError(raw json.RawMessage, status int) *ProviderError {
+	var g struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	}
+	json.Unmarshal(raw, &g)
+	e := &ProviderError{Type: g.Status, Message: g.Message}
+	if status == 0 {
+		status = g.Code
+	}
+	e = finishProviderError(e, status, geminiErrors.types[e.Type])
+	if e.Type == "" {
+		e.Type = geminiErrors.translate(e).Type
+	}
+	return e
+}
+
+// finishProviderError fills in the status (the response's, else the one
+// inferred from the provider type, else 500) and the kind.
+func finishProviderError(e *ProviderError, status, inferred int) *ProviderError {
+	switch {
+	case status != 0:
+		e.Status = status
+	case inferred != 0:
+		e.Status = inferred
+	default:
+		e.Status = http.StatusInternalServerError
+	}
+	e.Kind = classifyError(e)
+	return e
+}
+
+// plainProviderError wraps a body that is not a provider error object
+// (e.g. an HTML page from a gateway).
+func plainProviderError(body []byte, status int) *ProviderError {
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+	return finishProviderError(&ProviderError{Message: msg}, status, 0)
+}
+
+// rawCode renders a JSON string or number code as a string.
+func rawCode(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// errorObject returns the "error" member of an error body. A JSON array
+// (Gemini REST errors are sometimes wrapped in one) yields its first
+// element's.
+func errorObject(body []byte) (json.RawMessage, bool) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var arr []json.RawMessage
+		if json.Unmarshal(body, &arr) != nil || len(arr) == 0 {
+			return nil, false
+		}
+		body = arr[0]
+	}
+	var raw map[string]json.RawMessage
+	if json.Unmarshal(body, &raw) != nil {
+		return nil, false
+	}
+	obj, ok := raw["error"]
+	return obj, ok && len(obj) > 0 && obj[0] == '{'
+}
+
+// ─── Emission ────────────────────────────────────────────────────────────────
+
+// anthropicErrorBody renders e as an Anthropic error body (also the shape
+// of the "error" stream event).
+func anthropicErrorBody(e *ProviderError) (map[string]any, int) {
+	n := anthropicErrors.translate(e)
+	return map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    n.Type,
+			"message": e.Message,
+		},
+	}, n.Status
+}
+
+// openAIErrorBody renders e as an OpenAI error body.
+func openAIErrorBody(e *ProviderError) (map[string]any, int) {
+	n := openAIErrors.translate(e)
+	obj := map[string]any{
+		"type":    n.Type,
+		"message": e.Message,
+		"param":   nil,
+		"code":    nil,
+	}
+	if n.Code != "" {
+		obj["code"] = n.Code
+	}
+	return map[string]any{"error": obj}, n.Status
+}
+
+// geminiErrorBody renders e as a Google RPC error body.
+func geminiErrorBody(e *ProviderError) (map[string]any, int) {
+	n := geminiErrors.translate(e)
+	return map[string]any{
+		"error": map[string]any{
+			"code":    n.Status,
+			"message": e.Message,
+			"status":  n.Type,
+		},
+	}, n.Status
+}
+
+// ─── Error bodies ────────────────────────────────────────────────────────────
+
+// errorFormat is how one style reads and writes its error objects.
+type errorFormat struct {
+	parse  func(raw json.RawMessage, status int) *ProviderError
+	render func(e *ProviderError) (map[string]any, int)
+}
+
+var errorFormats = map[Style]errorFormat{
+	StyleChatCompletions: {parseOpenAIError, openAIErrorBody},
+	StyleResponses:       {parseOpenAIError, openAIErrorBody},
+	StyleAnthropic:       {parseAnthropicError, anthropicErrorBody},
+	StyleGoogleGenAI:     {parseGeminiError, geminiErrorBody},
+}
+
+// parseErrorBody converts an error body of the given style into a
+// RESP_ERROR program.
+func parseErrorBody(style Style, body []byte, status int) (*Program, error) {
+	prog := NewProgram()
+	if obj, ok := errorObject(body); ok {
+		errorFormats[style].parse(obj, status).emit(prog, RESP_ERROR)
+	} else {
+		plainProviderError(body, status).emit(prog, RESP_ERROR)
+	}
+	return prog, nil
+}
+
+// emitErrorBody renders the RESP_ERROR of prog as an error body of the
+// given style.
+func emitErrorBody(style Style, prog *Program) ([]byte, int, error) {
+	e := prog.ResponseError()
+	if e == nil {
+		return nil, 0, fmt.Errorf("ail: emit error: program has no RESP_ERROR")
+	}
+	body, status := errorFormats[style].render(e)
+	out, err := encodeJSONValue(body) // messages often quote HTML or code
+	return out, status, err
+}
+
+// ParseError converts a Chat Completions error body into a RESP_ERROR program.
+func (p *ChatCompletionsParser) ParseError(body []byte, status int) (*Program, error) {
+	return parseErrorBody(StyleChatCompletions, body, status)
+}
+
+// ParseError converts a Responses error body into a RESP_ERROR program.
+func (p *ResponsesParser) ParseError(body []byte, status int) (*Program, error) {
+	return parseErrorBody(StyleResponses, body, status)
+}
+
+// ParseError converts an Anthropic error body into a RESP_ERROR program.
+func (p *AnthropicParser) ParseError(body []byte, status int) (*Program, error) {
+	return parseErrorBody(StyleAnthropic, body, status)
+}
+
+// ParseError converts a Google GenAI error body into a RESP_ERROR program.
+func (p *GoogleGenAIParser) ParseError(body []byte, status int) (*Program, error) {
+	return parseErrorBody(StyleGoogleGenAI, body, status)
+}
+
+// EmitError converts a RESP_ERROR program into a Chat Completions error body.
+func (e *ChatCompletionsEmitter) EmitError(prog *Program) ([]byte, int, error) {
+	return emitErrorBody(StyleChatCompletions, prog)
+}
+
+// EmitError converts a RESP_ERROR program into a Responses error body.
+func (e *ResponsesEmitter) EmitError(prog *Program) ([]byte, int, error) {
+	return emitErrorBody(StyleResponses, prog)
+}
+
+// EmitError converts a RESP_ERROR program into an Anthropic error body.
+func (e *AnthropicEmitter) EmitError(prog *Program) ([]byte, int, error) {
+	return emitErrorBody(StyleAnthropic, prog)
+}
+
+// EmitError converts a RESP_ERROR program into a Google GenAI error body.
+func (e *GoogleGenAIEmitter) EmitError(prog *Program) ([]byte, int, error) {
+	return emitErrorBody(StyleGoogleGenAI, prog)
+}
+
+// ─── Conversion ──────────────────────────────────────────────────────────────
+
+// ConvertError converts a provider's non-streaming error body (with the
+// HTTP status it came with) into the target provider's error body. It also
+// returns the HTTP status to answer with, which may differ from the
+// source's (Anthropic reports overload as 529, Gemini as 503).
+//
+// Bodies that are not error objects (e.g. a gateway's HTML page) are kept
+// as the message and classified by status.
+func ConvertError(body []byte, status int, from, to Style) ([]byte, int, error) {
+	parser, err := GetErrorParser(from)
+	if err != nil {
+		return nil, 0, err
+	}
+	prog, err := parser.ParseError(body, status)
+	if err != nil {
+		return nil, 0, err
+	}
+	emitter, err := GetErrorEmitter(to)
+	if err != nil {
+		return nil, 0, err
+	}
+	return emitter.EmitError(prog)
+}
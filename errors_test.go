@@ -0,0 +1,103 @@
+package ail
+
+import (
+	"testing"
+)
+
+func TestConvertError(t *testing.T) {
+	tests := []struct {
+		name       string
+		from, to   Style
+		body       string
+		status     int
+		want       string
+		wantStatus int
+	}{
+		{
+			"openai context length to anthropic", StyleChatCompletions, StyleAnthropic,
+			`{"error":{"message":"This model's maximum context length is 8192 tokens.","type":"invalid_request_error","param":"messages","code":"context_length_exceeded"}}`, 400,
+			`{"error":{"message":"This model's maximum context length is 8192 tokens.","type":"invalid_request_error"},"type":"error"}`, 400,
+		},
+		{
+			"anthropic overloaded to openai", StyleAnthropic, StyleChatCompletions,
+			`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, 529,
+			`{"error":{"code":null,"message":"Overloaded","param":null,"type":"server_error"}}`, 503,
+		},
+		{
+			"anthropic overloaded to gemini", StyleAnthropic, StyleGoogleGenAI,
+			`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, 529,
+			`{"error":{"code":503,"message":"Overloaded","status":"UNAVAILABLE"}}`, 503,
+		},
+		{
+			"gemini quota to responses", StyleGoogleGenAI, StyleResponses,
+			`[{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}]`, 429,
+			`{"error":{"code":"rate_limit_exceeded","message":"Quota exceeded","param":null,"type":"rate_limit_error"}}`, 429,
+		},
+		{
+			"gemini context length to openai", StyleGoogleGenAI, StyleChatCompletions,
+			`{"error":{"code":400,"message":"The input token count exceeds the maximum number of tokens allowed.","status":"INVALID_ARGUMENT"}}`, 400,
+			`{"error":{"code":"context_length_exceeded","message":"The input token count exceeds the maximum number of tokens allowed.","param":null,"type":"invalid_request_error"}}`, 400,
+		},
+		{
+			"anthropic auth to gemini", StyleAnthropic, StyleGoogleGenAI,
+			`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`, 401,
+			`{"error":{"code":401,"message":"invalid x-api-key","status":"UNAUTHENTICATED"}}`, 401,
+		},
+		{
+			"gateway page to anthropic", StyleChatCompletions, StyleAnthropic,
+			"<html>Bad Gateway</html>\n", 502,
+			`{"error":{"message":"<html>Bad Gateway</html>","type":"api_error"},"type":"error"}`, 500,
+		},
+		{
+			"same style keeps type and status", StyleAnthropic, StyleAnthropic,
+			`{"type":"error","error":{"type":"permission_error","message":"No access"}}`, 403,
+			`{"error":{"message":"No access","type":"permission_error"},"type":"error"}`, 403,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, status, err := ConvertError([]byte(tt.body), tt.status, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want || status != tt.wantStatus {
+				t.Errorf("got %d %s\nwant %d %s", status, got, tt.wantStatus, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrorKinds(t *testing.T) {
+	tests := []struct {
+		style  Style
+		body   string
+		status int
+		want   ErrorKind
+	}{
+		{StyleChatCompletions, `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`, 429, ErrorRateLimit},
+		{StyleChatCompletions, `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`, 401, ErrorAuth},
+		{StyleChatCompletions, `{"error":{"message":"The response was filtered","type":null,"code":"content_filter"}}`, 400, ErrorContentFilter},
+		{StyleAnthropic, `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`, 400, ErrorContextLength},
+		{StyleAnthropic, `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: field required"}}`, 0, ErrorInvalidRequest},
+		{StyleAnthropic, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, 0, ErrorOverloaded},
+		{StyleGoogleGenAI, `{"error":{"code":500,"message":"An internal error has occurred.","status":"INTERNAL"}}`, 500, ErrorServer},
+	}
+	for _, tt := range tests {
+		parser, err := GetErrorParser(tt.style)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog, err := parser.ParseError([]byte(tt.body), tt.status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := prog.ResponseError()
+		if e == nil || e.Kind != tt.want {
+			t.Errorf("%s %s: kind = %+v, want %s", tt.style, tt.body, e, tt.want)
+		}
+	}
+
+	if _, _, err := (&AnthropicEmitter{}).EmitError(NewProgram()); err == nil {
+		t.Error("expected error for a program without RESP_ERROR")
+	}
+}
@@ -65,3 +65,21 @@ func (ec *ExtrasCollector) MergeInto(obj map[string]any) {
 func (ec *ExtrasCollector) Depth() int {
 	return len(ec.levels) - 1
 }
+
+// ─── Extension namespaces ────────────────────────────────────────────────────
+
+// acceptsExt reports whether an emitter for style own should apply an
+// EXT_DATA instruction tagged with namespace ns. Untagged extensions
+// (ns == "") are always applied; tagged ones only when ns is the emitter's
+// own style or is listed in accept.
+func acceptsExt(ns, own Style, accept []Style) bool {
+	if ns == "" || ns == own {
+		return true
+	}
+	for _, a := range accept {
+		if a == ns {
+			return true
+		}
+	}
+	return false
+}
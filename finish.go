@@ -0,0 +1,226 @@
+package ail
+
+// ─── Finish reasons ──────────────────────────────────────────────────────────
+
+// FinishReason is the provider-neutral reason a response ended. RESP_DONE
+// carries it as its string argument; the provider's own value is kept next
+// to it (see NativeFinish) so that a same-provider round trip is lossless.
+type FinishReason string
+
+const (
+	FinishStop          FinishReason = "stop"           // natural end of turn or a stop sequence
+	FinishLength        FinishReason = "length"         // output token limit reached
+	FinishToolCalls     FinishReason = "tool_calls"     // the model called one or more tools
+	FinishContentFilter FinishReason = "content_filter" // output blocked by a safety or recitation filter
+	FinishRefusal       FinishReason = "refusal"        // the model declined to answer
+	FinishPause         FinishReason = "pause"          // long-running turn paused; resend to continue
+	FinishError         FinishReason = "error"          // the model produced an invalid tool call
+	FinishOther         FinishReason = "other"          // anything else
+	FinishInterrupted   FinishReason = "interrupted"    // the stream was cut off by a deadline (see StreamPipe.RunContext)
+)
+
+// NativeFinish is a provider's own finish value ("end_turn", "SAFETY",
+// "max_output_tokens") and the style it came from.
+type NativeFinish struct {
+	NS    Style
+	Value string
+}
+
+// finishVocab is one provider's finish vocabulary. parse maps native values
+// to canonical reasons; emit maps canonical reasons back. Native values not
+// in parse become FinishOther.
+type finishVocab struct {
+	parse map[string]FinishReason
+	emit  map[FinishReason]string
+}
+
+// The mapping tables, native → canonical:
+//
+//	Anthropic   end_turn, stop_sequence → stop; max_tokens,
+//	            model_context_window_exceeded → length; tool_use → tool_calls;
+//	            refusal → refusal; pause_turn → pause
+//	Chat        stop → stop; length → length; tool_calls, function_call →
+//	            tool_calls; content_filter → content_filter
+//	Responses   incomplete_details.reason: max_output_tokens → length;
+//	            content_filter → content_filter
+//	Gemini      STOP → stop (tool_calls when the candidate calls a function);
+//	            MAX_TOKENS → length; SAFETY, RECITATION, BLOCKLIST,
+//	            PROHIBITED_CONTENT, SPII, IMAGE_SAFETY → content_filter;
+//	            MALFORMED_FUNCTION_CALL, UNEXPECTED_TOOL_CALL → error;
+//	            LANGUAGE, OTHER → other
+//
+// Canonical reasons a target cannot express fall back to its closest value:
+// refusal and content_filter share a value everywhere but Anthropic, pause
+// becomes a plain stop, and error and other become the target's generic end.
+// No provider reports interrupted; it is written as the target's truncation
+// value so that clients treat the output as incomplete.
+var (
+	anthropicFinish = finishVocab{
+		parse: map[string]FinishReason{
+			"end_turn":                      FinishStop,
+			"stop_sequence":                 FinishStop,
+			"max_tokens":                    FinishLength,
+			"model_context_window_exceeded": FinishLength,
+			"tool_use":                      FinishToolCalls,
+			"refusal":                       FinishRefusal,
+			"pause_turn":                    FinishPause,
+		},
+		emit: map[FinishReason]string{
+			FinishStop:          "end_turn",
+			FinishLength:        "max_tokens",
+			FinishToolCalls:     "tool_use",
+			FinishContentFilter: "refusal",
+			FinishRefusal:       "refusal",
+			FinishPause:         "pause_turn",
+			FinishError:         "end_turn",
+			FinishOther:         "end_turn",
+			FinishInterrupted:   "max_tokens",
+		},
+	}
+
+	chatFinish = finishVocab{
+		parse: map[string]FinishReason{
+			"stop":           FinishStop,
+			"length":         FinishLength,
+			"tool_calls":     FinishToolCalls,
+			"function_call":  FinishToolCalls,
+			"content_filter": FinishContentFilter,
+		},
+		emit: map[FinishReason]string{
+			FinishStop:          "stop",
+			FinishLength:        "length",
+			FinishToolCalls:     "tool_calls",
+			FinishContentFilter: "content_filter",
+			FinishRefusal:       "content_filter",
+			FinishPause:         "stop",
+			FinishError:         "stop",
+			FinishOther:         "stop",
+			FinishInterrupted:   "length",
+		},
+	}
+
+	// Responses reports no value for completed output, only the reason an
+	// incomplete response stopped.
+	responsesFinish = finishVocab{
+		parse: map[string]FinishReason{
+			"max_output_tokens": FinishLength,
+			"content_filter":    FinishContentFilter,
+		},
+		emit: map[FinishReason]string{
+			FinishLength:        "max_output_tokens",
+			FinishContentFilter: "content_filter",
+			FinishRefusal:       "content_filter",
+			FinishInterrupted:   "max_output_tokens",
+		},
+	}
+
+	geminiFinish = finishVocab{
+		parse: map[string]FinishReason{
+			"STOP":                    FinishStop,
+			"MAX_TOKENS":              FinishLength,
+			"SAFETY":                  FinishContentFilter,
+			"RECITATION":              FinishContentFilter,
+			"BLOCKLIST":               FinishContentFilter,
+			"PROHIBITED_CONTENT":      FinishContentFilter,
+			"SPII":                    FinishContentFilter,
+			"IMAGE_SAFETY":            FinishContentFilter,
+			"MALFORMED_FUNCTION_CALL": FinishError,
+			"UNEXPECTED_TOOL_CALL":    FinishError,
+			"LANGUAGE":                FinishOther,
+			"OTHER":                   FinishOther,
+		},
+		emit: map[FinishReason]string{
+			FinishStop:          "STOP",
+			FinishLength:        "MAX_TOKENS",
+			FinishToolCalls:     "STOP",
+			FinishContentFilter: "SAFETY",
+			FinishRefusal:       "SAFETY",
+			FinishPause:         "STOP",
+			FinishError:         "OTHER",
+			FinishOther:         "OTHER",
+			FinishInterrupted:   "MAX_TOKENS",
+		},
+	}
+)
+
+var canonicalFinish = map[FinishReason]bool{
+	FinishStop: true, FinishLength: true, FinishToolCalls: true, FinishContentFilter: true,
+	FinishRefusal: true, FinishPause: true, FinishError: true, FinishOther: true, FinishInterrupted: true,
+}
+
+func finishVocabFor(style Style) (finishVocab, bool) {
+	switch style {
+	case StyleAnthropic:
+		return anthropicFinish, true
+	case StyleChatCompletions:
+		return chatFinish, true
+	case StyleResponses:
+		return responsesFinish, true
+	case StyleGoogleGenAI:
+		return geminiFinish, true
+	}
+	return finishVocab{}, false
+}
+
+// ParseFinishReason maps a native finish value of style to its canonical
+// reason. Unknown values map to FinishOther; an empty value maps to "".
+func ParseFinishReason(style Style, native string) FinishReason {
+	if native == "" {
+		return ""
+	}
+	v, _ := finishVocabFor(style)
+	if r, ok := v.parse[native]; ok {
+		return r
+	}
+	return FinishOther
+}
+
+// NativeFinishReason returns the value style uses for reason. Reasons that
+// are not canonical are returned unchanged.
+func NativeFinishReason(style Style, reason FinishReason) string {
+	v, _ := finishVocabFor(style)
+	if native, ok := v.emit[reason]; ok {
+		return native
+	}
+	if canonicalFinish[reason] {
+		return ""
+	}
+	return string(reason)
+}
+
+// finishInst builds the RESP_DONE for a native value of style. A turn that
+// called tools reports tool_calls even when the provider says it simply
+// stopped (Gemini always does).
+func finishInst(style Style, native string, calledTools bool) Instruction {
+	reason := ParseFinishReason(style, native)
+	if calledTools && reason == FinishStop {
+		reason = FinishToolCalls
+	}
+	return Instruction{Op: RESP_DONE, Str: string(reason), Key: native, NS: style}
+}
+
+// emitFinish appends the RESP_DONE for a native value of style.
+func (p *Program) emitFinish(style Style, native string, calledTools bool) {
+	p.Code = append(p.Code, finishInst(style, native, calledTools))
+}
+
+// finishFor returns the finish value to write for a RESP_DONE in style: the
+// native value when the instruction came from style, else the mapped
+// canonical reason.
+func finishFor(inst Instruction, style Style) string {
+	if inst.NS == style && inst.Key != "" {
+		return inst.Key
+	}
+	return NativeFinishReason(style, FinishReason(inst.Str))
+}
+
+// FinishReason returns the canonical reason of the last RESP_DONE in the
+// program, or "" when there is none.
+func (p *Program) FinishReason() FinishReason {
+	for i := len(p.Code) - 1; i >= 0; i-- {
+		if p.Code[i].Op == RESP_DONE {
+			return FinishReason(p.Code[i].Str)
+		}
+	}
+	return ""
+}
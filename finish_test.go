@@ -0,0 +1,198 @@
+package ail
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFinishReasonConversion(t *testing.T) {
+	anthropic := func(reason string) string {
+		return `{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[{"type":"text","text":"Hi"}],"stop_reason":"` + reason + `"}`
+	}
+	gemini := func(reason string) string {
+		return `{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"}]},"finishReason":"` + reason + `"}]}`
+	}
+	chat := func(reason string) string {
+		return `{"id":"c1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"` + reason + `"}]}`
+	}
+	finishOf := func(t *testing.T, style Style, body []byte) string {
+		var out struct {
+			StopReason string `json:"stop_reason"`
+			Candidates []struct {
+				FinishReason string `json:"finishReason"`
+			} `json:"candidates"`
+			Choices []struct {
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(body, &out); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case style == StyleAnthropic:
+			return out.StopReason
+		case style == StyleGoogleGenAI && len(out.Candidates) > 0:
+			return out.Candidates[0].FinishReason
+		case len(out.Choices) > 0:
+			return out.Choices[0].FinishReason
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name     string
+		from, to Style
+		body     string
+		want     string
+	}{
+		{"anthropic pause_turn round trip", StyleAnthropic, StyleAnthropic, anthropic("pause_turn"), "pause_turn"},
+		{"anthropic stop_sequence round trip", StyleAnthropic, StyleAnthropic, anthropic("stop_sequence"), "stop_sequence"},
+		{"anthropic stop_sequence to chat", StyleAnthropic, StyleChatCompletions, anthropic("stop_sequence"), "stop"},
+		{"anthropic refusal to chat", StyleAnthropic, StyleChatCompletions, anthropic("refusal"), "content_filter"},
+		{"anthropic refusal to gemini", StyleAnthropic, StyleGoogleGenAI, anthropic("refusal"), "SAFETY"},
+		{"anthropic pause_turn to gemini", StyleAnthropic, StyleGoogleGenAI, anthropic("pause_turn"), "STOP"},
+		{"gemini recitation round trip", StyleGoogleGenAI, StyleGoogleGenAI, gemini("RECITATION"), "RECITATION"},
+		{"gemini safety to anthropic", StyleGoogleGenAI, StyleAnthropic, gemini("SAFETY"), "refusal"},
+		{"gemini recitation to chat", StyleGoogleGenAI, StyleChatCompletions, gemini("RECITATION"), "content_filter"},
+		{"gemini malformed call to anthropic", StyleGoogleGenAI, StyleAnthropic, gemini("MALFORMED_FUNCTION_CALL"), "end_turn"},
+		{"gemini max tokens to anthropic", StyleGoogleGenAI, StyleAnthropic, gemini("MAX_TOKENS"), "max_tokens"},
+		{"chat unknown value round trip", StyleChatCompletions, StyleChatCompletions, chat("eos"), "eos"},
+		{"chat unknown value to anthropic", StyleChatCompletions, StyleAnthropic, chat("eos"), "end_turn"},
+		{"chat length to gemini", StyleChatCompletions, StyleGoogleGenAI, chat("length"), "MAX_TOKENS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ConvertResponse([]byte(tt.body), tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := finishOf(t, tt.to, out); got != tt.want {
+				t.Errorf("finish = %q, want %q\n%s", got, tt.want, out)
+			}
+		})
+	}
+}
+
+func TestFinishReasonParse(t *testing.T) {
+	tests := []struct {
+		style  Style
+		native string
+		want   FinishReason
+	}{
+		{StyleAnthropic, "end_turn", FinishStop},
+		{StyleAnthropic, "tool_use", FinishToolCalls},
+		{StyleAnthropic, "refusal", FinishRefusal},
+		{StyleAnthropic, "pause_turn", FinishPause},
+		{StyleChatCompletions, "function_call", FinishToolCalls},
+		{StyleResponses, "max_output_tokens", FinishLength},
+		{StyleGoogleGenAI, "PROHIBITED_CONTENT", FinishContentFilter},
+		{StyleGoogleGenAI, "MALFORMED_FUNCTION_CALL", FinishError},
+		{StyleGoogleGenAI, "FINISH_REASON_UNSPECIFIED", FinishOther},
+		{StyleGoogleGenAI, "", ""},
+	}
+	for _, tt := range tests {
+		if got := ParseFinishReason(tt.style, tt.native); got != tt.want {
+			t.Errorf("ParseFinishReason(%s, %q) = %q, want %q", tt.style, tt.native, got, tt.want)
+		}
+	}
+	if got := NativeFinishReason(StyleResponses, FinishStop); got != "" {
+		t.Errorf("NativeFinishReason(responses, stop) = %q, want empty", got)
+	}
+}
+
+func TestFinishReasonGeminiToolCalls(t *testing.T) {
+	body := `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},"finishReason":"STOP"}]}`
+	prog, err := (&GoogleGenAIParser{}).ParseResponse([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prog.FinishReason(); got != FinishToolCalls {
+		t.Errorf("FinishReason() = %q, want tool_calls", got)
+	}
+
+	// Gemini streams may send STOP in a later chunk than the call.
+	conv, err := NewStreamConverter(StyleGoogleGenAI, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last []byte
+	for _, chunk := range []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{}}}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"STOP"}]}`,
+	} {
+		outs, err := conv.Push([]byte(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, out := range outs {
+			var ev struct {
+				Type string `json:"type"`
+			}
+			if json.Unmarshal(out, &ev) == nil && ev.Type == "message_delta" {
+				last = out
+			}
+		}
+	}
+	if want := `{"delta":{"stop_reason":"tool_use"},"type":"message_delta"}`; string(last) != want {
+		t.Errorf("message_delta = %s, want %s", last, want)
+	}
+}
+
+func TestFinishReasonEncodings(t *testing.T) {
+	same := func(a, b []Instruction) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i].Op != b[i].Op || a[i].Str != b[i].Str || a[i].Key != b[i].Key || a[i].NS != b[i].NS {
+				return false
+			}
+		}
+		return true
+	}
+	prog := NewProgram()
+	prog.emitFinish(StyleAnthropic, "pause_turn", false)
+	prog.EmitString(RESP_DONE, "stop")
+
+	asm := prog.Disasm()
+	if want := "RESP_DONE pause @anthropic-messages pause_turn\nRESP_DONE stop\n"; asm != want {
+		t.Errorf("Disasm:\n%s\nwant:\n%s", asm, want)
+	}
+	back, err := Asm(asm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same(back.Code, prog.Code) {
+		t.Errorf("Asm round trip: %+v", back.Code)
+	}
+
+	j, err := json.Marshal(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON Program
+	if err := json.Unmarshal(j, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if !same(fromJSON.Code, prog.Code) {
+		t.Errorf("JSON round trip: %s", j)
+	}
+
+	resp := NewProgram()
+	resp.Emit(MSG_START)
+	resp.Emit(ROLE_AST)
+	resp.EmitString(TXT_CHUNK, "Hi")
+	resp.emitFinish(StyleGoogleGenAI, "RECITATION", false)
+	resp.Emit(MSG_END)
+	conv, err := resp.Decompile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := conv.Messages[0]
+	if m.FinishReason != "content_filter" || m.FinishNative != (NativeFinish{NS: StyleGoogleGenAI, Value: "RECITATION"}) {
+		t.Errorf("Decompile: %q %+v", m.FinishReason, m.FinishNative)
+	}
+	if !same(Compile(conv).Code, resp.Code) {
+		t.Errorf("Compile:\n%s", Compile(conv).Disasm())
+	}
+}
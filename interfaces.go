@@ -26,6 +26,20 @@ type ResponseEmitter interface {
 	EmitResponse(prog *Program) ([]byte, error)
 }
 
+// ErrorParser converts a provider-specific error body into an AIL Program
+// holding a single RESP_ERROR.
+type ErrorParser interface {
+	// ParseError converts a raw error body and its HTTP status into an AIL program.
+	ParseError(body []byte, status int) (*Program, error)
+}
+
+// ErrorEmitter converts a RESP_ERROR program into a provider-specific error body.
+type ErrorEmitter interface {
+	// EmitError converts an AIL program into a raw error body and the HTTP
+	// status to send it with.
+	EmitError(prog *Program) ([]byte, int, error)
+}
+
 // StreamChunkParser converts a provider-specific streaming chunk into AIL instructions.
 type StreamChunkParser interface {
 	// ParseStreamChunk converts a streaming chunk into an AIL program (partial).
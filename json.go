@@ -0,0 +1,265 @@
+package ail
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonVersion is the version written in the "version" field of the JSON
+// encoding. UnmarshalJSON rejects newer versions.
+const jsonVersion = 1
+
+//go:embed schema/program.schema.json
+var programSchema []byte
+
+// JSONSchema returns the JSON Schema (draft 2020-12) describing the JSON
+// encoding produced by Program.MarshalJSON.
+func JSONSchema() []byte {
+	out := make([]byte, len(programSchema))
+	copy(out, programSchema)
+	return out
+}
+
+// ─── JSON encoding ───────────────────────────────────────────────────────────
+//
+// A program is encoded as:
+//
+//	{
+//	  "version": 1,
+//	  "buffers": [{"data": "<base64>"}, {"uri": "s3://bucket/blob"}],
+//	  "code": [
+//	    {"op": "SET_MODEL", "str": "gpt-4o"},
+//	    {"op": "SET_TEMP", "num": 0.7},
+//	    {"op": "IMG_REF", "ref": 0},
+//	    {"op": "EXT_DATA", "key": "cache_control", "ns": "anthropic-messages", "json": {"type": "ephemeral"}}
+//	  ]
+//	}
+//
+// Each instruction carries only the fields its opcode uses, named after the
+// Instruction fields: str, num, int, json (an inline JSON value), key, ref
+// and ns. A JSON argument that is not valid JSON (e.g. truncated tool-call
+// arguments) is written as the string field raw instead of json. JSON values
+// are compacted. The layout is described by JSONSchema.
+
+// JSONOptions controls how buffers are written and read by MarshalJSONWith
+// and UnmarshalProgramJSON.
+type JSONOptions struct {
+	// ExternalizeBuffer, if set, is called for each buffer when marshaling.
+	// Returning a non-empty URI writes {"uri": uri} instead of the inline
+	// base64 payload (e.g. after uploading the blob to object storage).
+	ExternalizeBuffer func(index int, data []byte) (uri string, err error)
+
+	// ResolveBuffer loads the payload of a {"uri": …} buffer when
+	// unmarshaling. Without it, external buffers are an error.
+	ResolveBuffer func(uri string) ([]byte, error)
+}
+
+type programJSON struct {
+	Version int           `json:"version"`
+	Buffers []bufferJSON  `json:"buffers"`
+	Code    []Instruction `json:"code"`
+}
+
+type bufferJSON struct {
+	Data *string `json:"data,omitempty"`
+	URI  string  `json:"uri,omitempty"`
+}
+
+type instructionJSON struct {
+	Op   string          `json:"op"`
+	Str  *string         `json:"str,omitempty"`
+	Num  *float64        `json:"num,omitempty"`
+	Int  *int32          `json:"int,omitempty"`
+	JSON json.RawMessage `json:"json,omitempty"`
+	Raw  *string         `json:"raw,omitempty"`
+	Key  *string         `json:"key,omitempty"`
+	Ref  *uint32         `json:"ref,omitempty"`
+	NS   Style           `json:"ns,omitempty"`
+}
+
+// MarshalJSON encodes the program with all buffers inline as base64.
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return p.MarshalJSONWith(JSONOptions{})
+}
+
+// MarshalJSONWith encodes the program, consulting opts.ExternalizeBuffer to
+// decide which buffers are written as external references.
+func (p *Program) MarshalJSONWith(opts JSONOptions) ([]byte, error) {
+	out := programJSON{
+		Version: jsonVersion,
+		Buffers: make([]bufferJSON, len(p.Buffers)),
+		Code:    p.Code,
+	}
+	if out.Code == nil {
+		out.Code = []Instruction{}
+	}
+	for i, buf := range p.Buffers {
+		if opts.ExternalizeBuffer != nil {
+			uri, err := opts.ExternalizeBuffer(i, buf)
+			if err != nil {
+				return nil, fmt.Errorf("ail.MarshalJSON: externalize buffer %d: %w", i, err)
+			}
+			if uri != "" {
+				out.Buffers[i] = bufferJSON{URI: uri}
+				continue
+			}
+		}
+		data := base64.StdEncoding.EncodeToString(buf)
+		out.Buffers[i] = bufferJSON{Data: &data}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a program from its JSON encoding. Buffers given as
+// external references cannot be resolved and cause an error; use
+// UnmarshalProgramJSON with a resolver instead.
+func (p *Program) UnmarshalJSON(data []byte) error {
+	prog, err := UnmarshalProgramJSON(data, JSONOptions{})
+	if err != nil {
+		return err
+	}
+	*p = *prog
+	return nil
+}
+
+// UnmarshalProgramJSON decodes a program from its JSON encoding, resolving
+// external buffer references through opts.ResolveBuffer.
+func UnmarshalProgramJSON(data []byte, opts JSONOptions) (*Program, error) {
+	var in programJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, fmt.Errorf("ail.UnmarshalJSON: %w", err)
+	}
+	if in.Version < 1 || in.Version > jsonVersion {
+		return nil, fmt.Errorf("ail.UnmarshalJSON: unsupported version %d (want <= %d)", in.Version, jsonVersion)
+	}
+
+	prog := NewProgram()
+	for i, b := range in.Buffers {
+		switch {
+		case b.Data != nil && b.URI != "":
+			return nil, fmt.Errorf("ail.UnmarshalJSON: buffer %d has both data and uri", i)
+		case b.Data != nil:
+			buf, err := base64.StdEncoding.DecodeString(*b.Data)
+			if err != nil {
+				return nil, fmt.Errorf("ail.UnmarshalJSON: buffer %d: %w", i, err)
+			}
+			prog.Buffers = append(prog.Buffers, buf)
+		case b.URI != "":
+			if opts.ResolveBuffer == nil {
+				return nil, fmt.Errorf("ail.UnmarshalJSON: buffer %d: external uri %q needs a resolver", i, b.URI)
+			}
+			buf, err := opts.ResolveBuffer(b.URI)
+			if err != nil {
+				return nil, fmt.Errorf("ail.UnmarshalJSON: resolve buffer %d (%s): %w", i, b.URI, err)
+			}
+			prog.Buffers = append(prog.Buffers, buf)
+		default:
+			return nil, fmt.Errorf("ail.UnmarshalJSON: buffer %d has neither data nor uri", i)
+		}
+	}
+	for i, inst := range in.Code {
+		if refArgOps[inst.Op] && int(inst.Ref) >= len(prog.Buffers) {
+			return nil, fmt.Errorf("ail.UnmarshalJSON: instruction %d (%s): ref %d out of range", i, inst.Op, inst.Ref)
+		}
+	}
+	prog.Code = append(prog.Code, in.Code...)
+	return prog, nil
+}
+
+// MarshalJSON encodes the instruction as {"op": NAME, …} with only the fields
+// its opcode uses.
+func (inst Instruction) MarshalJSON() ([]byte, error) {
+	name, ok := opcodeNames[inst.Op]
+	if !ok {
+		return nil, fmt.Errorf("ail.MarshalJSON: unknown opcode 0x%02X", byte(inst.Op))
+	}
+	out := instructionJSON{Op: name}
+	switch {
+	case stringArgOps[inst.Op]:
+		out.Str = &inst.Str
+	case floatArgOps[inst.Op]:
+		out.Num = &inst.Num
+	case intArgOps[inst.Op]:
+		out.Int = &inst.Int
+	case jsonArgOps[inst.Op]:
+		out.JSON, out.Raw = splitJSONArg(inst.JSON)
+	case refArgOps[inst.Op]:
+		out.Ref = &inst.Ref
+	case inst.Op == SET_META:
+		out.Key, out.Str = &inst.Key, &inst.Str
+	case inst.Op == RESP_DONE:
+		out.Str = &inst.Str
+		if inst.Key != "" {
+			out.Key, out.NS = &inst.Key, inst.NS
+		}
+	case inst.Op == EXT_DATA:
+		out.Key, out.NS = &inst.Key, inst.NS
+		out.JSON, out.Raw = splitJSONArg(inst.JSON)
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes an instruction from {"op": NAME, …}. Fields the
+// opcode does not use are ignored; missing fields take their zero value.
+func (inst *Instruction) UnmarshalJSON(data []byte) error {
+	var in instructionJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	op, ok := nameToOpcode[in.Op]
+	if !ok {
+		return fmt.Errorf("ail.UnmarshalJSON: unknown opcode %q", in.Op)
+	}
+	*inst = Instruction{Op: op}
+	switch {
+	case stringArgOps[op]:
+		inst.Str = deref(in.Str)
+	case floatArgOps[op]:
+		inst.Num = deref(in.Num)
+	case intArgOps[op]:
+		inst.Int = deref(in.Int)
+	case jsonArgOps[op]:
+		inst.JSON = joinJSONArg(in.JSON, in.Raw)
+	case refArgOps[op]:
+		inst.Ref = deref(in.Ref)
+	case op == SET_META:
+		inst.Key, inst.Str = deref(in.Key), deref(in.Str)
+	case op == RESP_DONE:
+		inst.Str, inst.Key, inst.NS = deref(in.Str), deref(in.Key), in.NS
+	case op == EXT_DATA:
+		inst.Key, inst.NS = deref(in.Key), in.NS
+		inst.JSON = joinJSONArg(in.JSON, in.Raw)
+	}
+	return nil
+}
+
+// splitJSONArg places a JSON argument in the json field when it is valid
+// JSON, or in the raw string field otherwise. Empty arguments are omitted.
+func splitJSONArg(j json.RawMessage) (json.RawMessage, *string) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	if json.Valid(j) {
+		return j, nil
+	}
+	s := string(j)
+	return nil, &s
+}
+
+// joinJSONArg is the inverse of splitJSONArg.
+func joinJSONArg(j json.RawMessage, raw *string) json.RawMessage {
+	if raw != nil {
+		return json.RawMessage(*raw)
+	}
+	return cloneRaw(j)
+}
+
+func deref[T any](v *T) T {
+	var zero T
+	if v == nil {
+		return zero
+	}
+	return *v
+}
@@ -0,0 +1,183 @@
+package ail
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestProgramJSONRoundTrip(t *testing.T) {
+	orig := Build().
+		Model("claude-3").
+		Temperature(0.5).
+		MaxTokens(4096).
+		Stream().
+		Meta("user", "u1").
+		ExtFor(StyleAnthropic, "cache_control", map[string]string{"type": "ephemeral"}).
+		Tools(Func("get_weather", "Get weather", json.RawMessage(`{"type":"object"}`))).
+		User(Text("Hello"), Image([]byte("aW1n"), "image/png")).
+		Assistant(Thinking("hmm", "sig"), ToolCall("call_1", "get_weather", json.RawMessage(`{"city":"NYC"}`))).
+		Tool(Result("call_1", "72F")).
+		MustProgram()
+	// Truncated arguments are not valid JSON and must survive as text.
+	orig.EmitJSON(STREAM_TOOL_DELTA, json.RawMessage(`{"index":0,"arguments":"{\"ci`))
+	orig.EmitJSON(CALL_ARGS, json.RawMessage(`{"ci`))
+
+	data, err := json.Marshal(orig)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded Program
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(orig.Code, decoded.Code) {
+		t.Fatalf("code mismatch:\n got %s\nwant %s", decoded.Disasm(), orig.Disasm())
+	}
+	if !reflect.DeepEqual(orig.Buffers, decoded.Buffers) {
+		t.Fatalf("buffers mismatch: %q vs %q", decoded.Buffers, orig.Buffers)
+	}
+}
+
+func TestProgramJSONShape(t *testing.T) {
+	p := NewProgram()
+	p.EmitString(SET_MODEL, "gpt-4o")
+	p.EmitExt(StyleAnthropic, "cache_control", json.RawMessage(`{"type":"ephemeral"}`))
+	p.EmitRef(IMG_REF, p.AddBuffer([]byte("hi")))
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"version":1,"buffers":[{"data":"aGk="}],"code":[` +
+		`{"op":"SET_MODEL","str":"gpt-4o"},` +
+		`{"op":"EXT_DATA","json":{"type":"ephemeral"},"key":"cache_control","ns":"anthropic-messages"},` +
+		`{"op":"IMG_REF","ref":0}]}`
+	if string(data) != want {
+		t.Fatalf("got  %s\nwant %s", data, want)
+	}
+}
+
+func TestProgramJSONExternalBuffers(t *testing.T) {
+	p := NewProgram()
+	p.EmitRef(IMG_REF, p.AddBuffer([]byte("big-image")))
+	p.EmitRef(TXT_REF, p.AddBuffer([]byte("small")))
+
+	store := map[string][]byte{}
+	data, err := p.MarshalJSONWith(JSONOptions{
+		ExternalizeBuffer: func(i int, b []byte) (string, error) {
+			if len(b) < 8 {
+				return "", nil
+			}
+			uri := fmt.Sprintf("mem://%d", i)
+			store[uri] = b
+			return uri, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `{"uri":"mem://0"}`) || !strings.Contains(string(data), `{"data":"c21hbGw="}`) {
+		t.Fatalf("unexpected buffers: %s", data)
+	}
+
+	var plain Program
+	if err := json.Unmarshal(data, &plain); err == nil {
+		t.Fatal("expected error for unresolved external buffer")
+	}
+
+	got, err := UnmarshalProgramJSON(data, JSONOptions{
+		ResolveBuffer: func(uri string) ([]byte, error) {
+			b, ok := store[uri]
+			if !ok {
+				return nil, fmt.Errorf("not found")
+			}
+			return b, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if string(got.Buffers[0]) != "big-image" || string(got.Buffers[1]) != "small" {
+		t.Fatalf("buffers = %q", got.Buffers)
+	}
+}
+
+func TestProgramJSONErrors(t *testing.T) {
+	cases := map[string]string{
+		"version":     `{"version":99,"buffers":[],"code":[]}`,
+		"opcode":      `{"version":1,"buffers":[],"code":[{"op":"NOPE"}]}`,
+		"ref range":   `{"version":1,"buffers":[],"code":[{"op":"IMG_REF","ref":2}]}`,
+		"empty buf":   `{"version":1,"buffers":[{}],"code":[]}`,
+		"bad base64":  `{"version":1,"buffers":[{"data":"!!"}],"code":[]}`,
+		"not an obj":  `[]`,
+		"both fields": `{"version":1,"buffers":[{"data":"","uri":"x"}],"code":[]}`,
+	}
+	for name, in := range cases {
+		t.Run(name, func(t *testing.T) {
+			var p Program
+			if err := json.Unmarshal([]byte(in), &p); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+// TestJSONSchemaCoversOpcodes keeps the schema's opcode enums in sync with
+// the argument-type tables used by the encoders.
+func TestJSONSchemaCoversOpcodes(t *testing.T) {
+	var schema struct {
+		Defs map[string]struct {
+			Properties struct {
+				Op struct {
+					Enum  []string `json:"enum"`
+					Const string   `json:"const"`
+				} `json:"op"`
+			} `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(JSONSchema(), &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	names := func(m map[Opcode]bool) []string {
+		var out []string
+		for op := range m {
+			out = append(out, op.Name())
+		}
+		return out
+	}
+	var noArg []string
+	for op, name := range opcodeNames {
+		if !stringArgOps[op] && !floatArgOps[op] && !intArgOps[op] && !jsonArgOps[op] &&
+			!refArgOps[op] && op != SET_META && op != RESP_DONE && op != EXT_DATA {
+			noArg = append(noArg, name)
+		}
+	}
+	groups := map[string][]string{
+		"noArg":     noArg,
+		"stringArg": names(stringArgOps),
+		"floatArg":  names(floatArgOps),
+		"intArg":    names(intArgOps),
+		"jsonArgOp": names(jsonArgOps),
+		"refArg":    names(refArgOps),
+		"meta":      {"SET_META"},
+		"finish":    {"RESP_DONE"},
+		"ext":       {"EXT_DATA"},
+	}
+	for def, want := range groups {
+		op := schema.Defs[def].Properties.Op
+		got := op.Enum
+		if op.Const != "" {
+			got = []string{op.Const}
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("$defs/%s ops = %v, want %v", def, got, want)
+		}
+	}
+}
@@ -63,8 +63,9 @@ const (
 const (
 	RESP_ID    Opcode = 0x50 // arg: String — response ID
 	RESP_MODEL Opcode = 0x51 // arg: String — model that generated response
-	RESP_DONE  Opcode = 0x52 // arg: String — finish reason
+	RESP_DONE  Opcode = 0x52 // arg: FinishReason + native value and namespace
 	USAGE      Opcode = 0x53 // arg: JSON — usage statistics
+	RESP_ERROR Opcode = 0x54 // arg: JSON — provider error ({kind, type, message, status, code})
 )
 
 // ─── Stream Events (0x60-0x6F) ───────────────────────────────────────────────
@@ -74,6 +75,10 @@ const (
 	STREAM_TOOL_DELTA  Opcode = 0x62 // arg: JSON — tool call delta
 	STREAM_END         Opcode = 0x63 // End streaming response
 	STREAM_THINK_DELTA Opcode = 0x64 // arg: String — thinking/reasoning text delta
+	STREAM_BLOCK_START Opcode = 0x65 // arg: JSON — content block opened ({index, type})
+	STREAM_BLOCK_END   Opcode = 0x66 // arg: JSON — content block closed ({index})
+	STREAM_THINK_SIG   Opcode = 0x67 // arg: String — opaque signature of the thinking block
+	STREAM_ERROR       Opcode = 0x68 // arg: JSON — provider error ({kind, type, message, status, code})
 )
 
 // ─── Configuration (0xF0-0xFF) ───────────────────────────────────────────────
@@ -99,10 +104,11 @@ var opcodeNames = map[Opcode]string{
 	DEF_START: "DEF_START", DEF_NAME: "DEF_NAME", DEF_DESC: "DEF_DESC", DEF_SCHEMA: "DEF_SCHEMA", DEF_END: "DEF_END",
 	CALL_START: "CALL_START", CALL_NAME: "CALL_NAME", CALL_ARGS: "CALL_ARGS", CALL_END: "CALL_END",
 	RESULT_START: "RESULT_START", RESULT_DATA: "RESULT_DATA", RESULT_END: "RESULT_END",
-	RESP_ID: "RESP_ID", RESP_MODEL: "RESP_MODEL", RESP_DONE: "RESP_DONE", USAGE: "USAGE",
+	RESP_ID: "RESP_ID", RESP_MODEL: "RESP_MODEL", RESP_DONE: "RESP_DONE", USAGE: "USAGE", RESP_ERROR: "RESP_ERROR",
 	STREAM_START: "STREAM_START", STREAM_DELTA: "STREAM_DELTA", STREAM_TOOL_DELTA: "STREAM_TOOL_DELTA", STREAM_END: "STREAM_END",
-	STREAM_THINK_DELTA: "STREAM_THINK_DELTA",
-	SET_MODEL:          "SET_MODEL", SET_TEMP: "SET_TEMP", SET_TOPP: "SET_TOPP", SET_STOP: "SET_STOP",
+	STREAM_THINK_DELTA: "STREAM_THINK_DELTA", STREAM_BLOCK_START: "STREAM_BLOCK_START", STREAM_BLOCK_END: "STREAM_BLOCK_END",
+	STREAM_THINK_SIG: "STREAM_THINK_SIG", STREAM_ERROR: "STREAM_ERROR",
+	SET_MODEL: "SET_MODEL", SET_TEMP: "SET_TEMP", SET_TOPP: "SET_TOPP", SET_STOP: "SET_STOP",
 	SET_MAX: "SET_MAX", SET_STREAM: "SET_STREAM", SET_THINK: "SET_THINK", SET_FMT: "SET_FMT",
 	EXT_DATA: "EXT_DATA", SET_META: "SET_META",
 }
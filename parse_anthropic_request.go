@@ -124,7 +124,7 @@ func (p *AnthropicParser) ParseRequest(body []byte) (*Program, error) {
 
 				// Remaining fields as EXT_DATA (e.g., cache_control)
 				for key, val := range toolMap {
-					prog.EmitKeyJSON(EXT_DATA, key, val)
+					prog.EmitExt(StyleAnthropic, key, val)
 				}
 			}
 			prog.Emit(DEF_END)
@@ -239,7 +239,7 @@ func (p *AnthropicParser) ParseRequest(body []byte) (*Program, error) {
 									// Remaining block-level fields as EXT_DATA
 									delete(blockMap, "type")
 									for key, val := range blockMap {
-										prog.EmitKeyJSON(EXT_DATA, key, val)
+										prog.EmitExt(StyleAnthropic, key, val)
 									}
 									prog.Emit(CALL_END)
 									continue // skip common tail
@@ -260,7 +260,7 @@ func (p *AnthropicParser) ParseRequest(body []byte) (*Program, error) {
 									// Remaining block-level fields as EXT_DATA
 									delete(blockMap, "type")
 									for key, val := range blockMap {
-										prog.EmitKeyJSON(EXT_DATA, key, val)
+										prog.EmitExt(StyleAnthropic, key, val)
 									}
 									prog.Emit(RESULT_END)
 									continue // skip common tail
@@ -269,7 +269,7 @@ func (p *AnthropicParser) ParseRequest(body []byte) (*Program, error) {
 								delete(blockMap, "type")
 								delete(blockMap, "text")
 								for key, val := range blockMap {
-									prog.EmitKeyJSON(EXT_DATA, key, val)
+									prog.EmitExt(StyleAnthropic, key, val)
 								}
 							}
 						}
@@ -279,7 +279,7 @@ func (p *AnthropicParser) ParseRequest(body []byte) (*Program, error) {
 
 				// Remaining per-message fields as EXT_DATA
 				for key, val := range msgMap {
-					prog.EmitKeyJSON(EXT_DATA, key, val)
+					prog.EmitExt(StyleAnthropic, key, val)
 				}
 
 				prog.Emit(MSG_END)
@@ -290,7 +290,7 @@ func (p *AnthropicParser) ParseRequest(body []byte) (*Program, error) {
 
 	// Remaining fields as EXT_DATA
 	for key, val := range raw {
-		prog.EmitKeyJSON(EXT_DATA, key, val)
+		prog.EmitExt(StyleAnthropic, key, val)
 	}
 
 	return prog, nil
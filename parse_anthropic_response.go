@@ -33,17 +33,9 @@ func (p *AnthropicParser) ParseResponse(body []byte) (*Program, error) {
 
 	// Usage
 	if usageRaw, ok := raw["usage"]; ok {
-		var u struct {
-			InputTokens  int `json:"input_tokens"`
-			OutputTokens int `json:"output_tokens"`
-		}
-		if json.Unmarshal(usageRaw, &u) == nil {
-			stdUsage, _ := json.Marshal(map[string]int{
-				"prompt_tokens":     u.InputTokens,
-				"completion_tokens": u.OutputTokens,
-				"total_tokens":      u.InputTokens + u.OutputTokens,
-			})
-			prog.EmitJSON(USAGE, stdUsage)
+		if u, ok := parseAnthropicUsage(usageRaw); ok {
+			u.TotalTokens = u.Total()
+			u.emit(prog)
 		}
 		delete(raw, "usage")
 	}
@@ -111,7 +103,7 @@ func (p *AnthropicParser) ParseResponse(body []byte) (*Program, error) {
 					// Remaining block-level fields as EXT_DATA
 					delete(blockMap, "type")
 					for key, val := range blockMap {
-						prog.EmitKeyJSON(EXT_DATA, key, val)
+						prog.EmitExt(StyleAnthropic, key, val)
 					}
 					prog.Emit(CALL_END)
 				}
@@ -122,17 +114,8 @@ func (p *AnthropicParser) ParseResponse(body []byte) (*Program, error) {
 	// Stop reason → finish reason
 	if srRaw, ok := raw["stop_reason"]; ok {
 		var sr string
-		if json.Unmarshal(srRaw, &sr) == nil {
-			switch sr {
-			case "end_turn":
-				prog.EmitString(RESP_DONE, "stop")
-			case "tool_use":
-				prog.EmitString(RESP_DONE, "tool_calls")
-			case "max_tokens":
-				prog.EmitString(RESP_DONE, "length")
-			default:
-				prog.EmitString(RESP_DONE, sr)
-			}
+		if json.Unmarshal(srRaw, &sr) == nil && sr != "" {
+			prog.emitFinish(StyleAnthropic, sr, false)
 		}
 	}
 
@@ -145,7 +128,7 @@ func (p *AnthropicParser) ParseResponse(body []byte) (*Program, error) {
 
 	// Passthrough remaining fields as EXT_DATA
 	for key, val := range raw {
-		prog.EmitKeyJSON(EXT_DATA, key, val)
+		prog.EmitExt(StyleAnthropic, key, val)
 	}
 
 	return prog, nil
@@ -23,8 +23,9 @@ func (p *AnthropicParser) ParseStreamChunk(body []byte) (*Program, error) {
 		prog.Emit(STREAM_START)
 		if msgRaw, ok := raw["message"]; ok {
 			var msg struct {
-				ID    string `json:"id"`
-				Model string `json:"model"`
+				ID    string          `json:"id"`
+				Model string          `json:"model"`
+				Usage json.RawMessage `json:"usage"`
 			}
 			if json.Unmarshal(msgRaw, &msg) == nil {
 				if msg.ID != "" {
@@ -33,6 +34,13 @@ func (p *AnthropicParser) ParseStreamChunk(body []byte) (*Program, error) {
 				if msg.Model != "" {
 					prog.EmitString(RESP_MODEL, msg.Model)
 				}
+				// Input and cache tokens arrive here; output tokens
+				// follow in message_delta.
+				if len(msg.Usage) > 0 {
+					if u, ok := parseAnthropicUsage(msg.Usage); ok {
+						u.emit(prog)
+					}
+				}
 			}
 		}
 
@@ -46,25 +54,27 @@ func (p *AnthropicParser) ParseStreamChunk(body []byte) (*Program, error) {
 			if json.Unmarshal(cbRaw, &cb) == nil {
 				switch cb.Type {
 				case "tool_use":
-					idx := 0
-					if idxRaw, ok := raw["index"]; ok {
-						json.Unmarshal(idxRaw, &idx)
-					}
-					td := map[string]any{"index": idx, "id": cb.ID, "name": cb.Name}
+					td := map[string]any{"index": anthropicEventIndex(raw), "id": cb.ID, "name": cb.Name}
 					j, _ := json.Marshal(td)
 					prog.EmitJSON(STREAM_TOOL_DELTA, j)
-				case "thinking":
-					// Thinking block started — emit nothing, deltas carry content
+				case "text", "thinking":
+					j, _ := json.Marshal(map[string]any{"index": anthropicEventIndex(raw), "type": cb.Type})
+					prog.EmitJSON(STREAM_BLOCK_START, j)
 				}
 			}
 		}
 
+	case "content_block_stop":
+		j, _ := json.Marshal(map[string]any{"index": anthropicEventIndex(raw)})
+		prog.EmitJSON(STREAM_BLOCK_END, j)
+
 	case "content_block_delta":
 		if deltaRaw, ok := raw["delta"]; ok {
 			var delta struct {
 				Type        string `json:"type"`
 				Text        string `json:"text,omitempty"`
 				PartialJSON string `json:"partial_json,omitempty"`
+				Signature   string `json:"signature,omitempty"`
 			}
 			if json.Unmarshal(deltaRaw, &delta) == nil {
 				switch delta.Type {
@@ -77,12 +87,12 @@ func (p *AnthropicParser) ParseStreamChunk(body []byte) (*Program, error) {
 					if json.Unmarshal(deltaRaw, &thinkDelta) == nil && thinkDelta.Thinking != "" {
 						prog.EmitString(STREAM_THINK_DELTA, thinkDelta.Thinking)
 					}
-				case "input_json_delta":
-					idx := 0
-					if idxRaw, ok := raw["index"]; ok {
-						json.Unmarshal(idxRaw, &idx)
+				case "signature_delta":
+					if delta.Signature != "" {
+						prog.EmitString(STREAM_THINK_SIG, delta.Signature)
 					}
-					td := map[string]any{"index": idx, "arguments": delta.PartialJSON}
+				case "input_json_delta":
+					td := map[string]any{"index": anthropicEventIndex(raw), "arguments": delta.PartialJSON}
 					j, _ := json.Marshal(td)
 					prog.EmitJSON(STREAM_TOOL_DELTA, j)
 				}
@@ -95,33 +105,32 @@ func (p *AnthropicParser) ParseStreamChunk(body []byte) (*Program, error) {
 				StopReason string `json:"stop_reason,omitempty"`
 			}
 			if json.Unmarshal(deltaRaw, &delta) == nil && delta.StopReason != "" {
-				switch delta.StopReason {
-				case "end_turn":
-					prog.EmitString(RESP_DONE, "stop")
-				case "tool_use":
-					prog.EmitString(RESP_DONE, "tool_calls")
-				case "max_tokens":
-					prog.EmitString(RESP_DONE, "length")
-				default:
-					prog.EmitString(RESP_DONE, delta.StopReason)
-				}
+				prog.emitFinish(StyleAnthropic, delta.StopReason, false)
 			}
 		}
 		if usageRaw, ok := raw["usage"]; ok {
-			var u struct {
-				OutputTokens int `json:"output_tokens"`
-			}
-			if json.Unmarshal(usageRaw, &u) == nil {
-				stdUsage, _ := json.Marshal(map[string]int{
-					"completion_tokens": u.OutputTokens,
-				})
-				prog.EmitJSON(USAGE, stdUsage)
+			if u, ok := parseAnthropicUsage(usageRaw); ok {
+				u.emit(prog)
 			}
 		}
 
 	case "message_stop":
 		prog.Emit(STREAM_END)
+
+	case "error":
+		if errRaw, ok := raw["error"]; ok {
+			parseAnthropicError(errRaw, 0).emit(prog, STREAM_ERROR)
+		}
 	}
 
 	return prog, nil
 }
+
+// anthropicEventIndex returns the content-block index of a stream event.
+func anthropicEventIndex(raw map[string]json.RawMessage) int {
+	idx := 0
+	if idxRaw, ok := raw["index"]; ok {
+		json.Unmarshal(idxRaw, &idx)
+	}
+	return idx
+}
@@ -121,7 +121,7 @@ func (p *GoogleGenAIParser) ParseRequest(body []byte) (*Program, error) {
 
 					// Remaining per-declaration fields as EXT_DATA
 					for key, val := range fdMap {
-						prog.EmitKeyJSON(EXT_DATA, key, val)
+						prog.EmitExt(StyleGoogleGenAI, key, val)
 					}
 				}
 			}
@@ -139,10 +139,12 @@ func (p *GoogleGenAIParser) ParseRequest(body []byte) (*Program, error) {
 				Thought          *bool  `json:"thought,omitempty"`
 				ThoughtSignature string `json:"thoughtSignature,omitempty"`
 				FunctionCall     *struct {
+					ID   string          `json:"id,omitempty"`
 					Name string          `json:"name"`
 					Args json.RawMessage `json:"args"`
 				} `json:"functionCall,omitempty"`
 				FunctionResponse *struct {
+					ID       string          `json:"id,omitempty"`
 					Name     string          `json:"name"`
 					Response json.RawMessage `json:"response"`
 				} `json:"functionResponse,omitempty"`
@@ -156,12 +158,23 @@ func (p *GoogleGenAIParser) ParseRequest(body []byte) (*Program, error) {
 			for _, content := range contents {
 				prog.Emit(MSG_START)
 
-				switch content.Role {
-				case "user":
+				// Current clients send function results as a "user" turn;
+				// a turn of nothing but functionResponse parts is a tool
+				// message all the same.
+				results := len(content.Parts) > 0
+				for _, part := range content.Parts {
+					if part.FunctionResponse == nil {
+						results = false
+					}
+				}
+				switch {
+				case content.Role == "user" && results:
+					prog.Emit(ROLE_TOOL)
+				case content.Role == "user":
 					prog.Emit(ROLE_USR)
-				case "model":
+				case content.Role == "model":
 					prog.Emit(ROLE_AST)
-				case "function":
+				case content.Role == "function":
 					prog.Emit(ROLE_TOOL)
 				}
 
@@ -181,7 +194,9 @@ func (p *GoogleGenAIParser) ParseRequest(body []byte) (*Program, error) {
 						prog.EmitString(TXT_CHUNK, part.Text)
 					}
 					if part.FunctionCall != nil {
-						prog.EmitString(CALL_START, "")
+						// Calls usually have no ID; emitters that need one
+						// synthesize it (see Program.AssignToolIDs).
+						prog.EmitString(CALL_START, part.FunctionCall.ID)
 						prog.EmitString(CALL_NAME, part.FunctionCall.Name)
 						if len(part.FunctionCall.Args) > 0 {
 							prog.EmitJSON(CALL_ARGS, part.FunctionCall.Args)
@@ -189,7 +204,13 @@ func (p *GoogleGenAIParser) ParseRequest(body []byte) (*Program, error) {
 						prog.Emit(CALL_END)
 					}
 					if part.FunctionResponse != nil {
-						prog.EmitString(RESULT_START, part.FunctionResponse.Name)
+						// Results name their function; an ID, when
+						// present, identifies the call exactly.
+						ref := part.FunctionResponse.ID
+						if ref == "" {
+							ref = part.FunctionResponse.Name
+						}
+						prog.EmitString(RESULT_START, ref)
 						prog.EmitString(RESULT_DATA, string(part.FunctionResponse.Response))
 						prog.Emit(RESULT_END)
 					}
@@ -205,6 +226,11 @@ func (p *GoogleGenAIParser) ParseRequest(body []byte) (*Program, error) {
 						}
 					}
 				}
+				if content.Role == "user" && results {
+					// Keep the role for Gemini targets, which write
+					// "function" for tool messages.
+					prog.EmitExt(StyleGoogleGenAI, "role", json.RawMessage(`"user"`))
+				}
 
 				prog.Emit(MSG_END)
 			}
@@ -214,7 +240,7 @@ func (p *GoogleGenAIParser) ParseRequest(body []byte) (*Program, error) {
 
 	// Remaining fields as EXT_DATA
 	for key, val := range raw {
-		prog.EmitKeyJSON(EXT_DATA, key, val)
+		prog.EmitExt(StyleGoogleGenAI, key, val)
 	}
 
 	return prog, nil
@@ -24,18 +24,8 @@ func (p *GoogleGenAIParser) ParseResponse(body []byte) (*Program, error) {
 
 	// Usage metadata
 	if usageRaw, ok := raw["usageMetadata"]; ok {
-		var u struct {
-			PromptTokenCount     int `json:"promptTokenCount"`
-			CandidatesTokenCount int `json:"candidatesTokenCount"`
-			TotalTokenCount      int `json:"totalTokenCount"`
-		}
-		if json.Unmarshal(usageRaw, &u) == nil {
-			stdUsage, _ := json.Marshal(map[string]int{
-				"prompt_tokens":     u.PromptTokenCount,
-				"completion_tokens": u.CandidatesTokenCount,
-				"total_tokens":      u.TotalTokenCount,
-			})
-			prog.EmitJSON(USAGE, stdUsage)
+		if u, ok := parseGeminiUsage(usageRaw); ok {
+			u.emit(prog)
 		}
 		delete(raw, "usageMetadata")
 	}
@@ -52,6 +42,7 @@ func (p *GoogleGenAIParser) ParseResponse(body []byte) (*Program, error) {
 
 				prog.Emit(MSG_START)
 				prog.Emit(ROLE_AST)
+				calledTools := false
 
 				if contentRaw, ok := candMap["content"]; ok {
 					var content struct {
@@ -60,6 +51,7 @@ func (p *GoogleGenAIParser) ParseResponse(body []byte) (*Program, error) {
 							Thought          *bool  `json:"thought,omitempty"`
 							ThoughtSignature string `json:"thoughtSignature,omitempty"`
 							FunctionCall     *struct {
+								ID   string          `json:"id,omitempty"`
 								Name string          `json:"name"`
 								Args json.RawMessage `json:"args"`
 							} `json:"functionCall,omitempty"`
@@ -81,7 +73,8 @@ func (p *GoogleGenAIParser) ParseResponse(body []byte) (*Program, error) {
 								prog.EmitString(TXT_CHUNK, part.Text)
 							}
 							if part.FunctionCall != nil {
-								prog.EmitString(CALL_START, "")
+								calledTools = true
+								prog.EmitString(CALL_START, part.FunctionCall.ID)
 								prog.EmitString(CALL_NAME, part.FunctionCall.Name)
 								if len(part.FunctionCall.Args) > 0 {
 									prog.EmitJSON(CALL_ARGS, part.FunctionCall.Args)
@@ -96,14 +89,7 @@ func (p *GoogleGenAIParser) ParseResponse(body []byte) (*Program, error) {
 				if frRaw, ok := candMap["finishReason"]; ok {
 					var fr string
 					if json.Unmarshal(frRaw, &fr) == nil && fr != "" {
-						switch fr {
-						case "STOP":
-							prog.EmitString(RESP_DONE, "stop")
-						case "MAX_TOKENS":
-							prog.EmitString(RESP_DONE, "length")
-						default:
-							prog.EmitString(RESP_DONE, fr)
-						}
+						prog.emitFinish(StyleGoogleGenAI, fr, calledTools)
 					}
 					delete(candMap, "finishReason")
 				}
@@ -114,7 +100,7 @@ func (p *GoogleGenAIParser) ParseResponse(body []byte) (*Program, error) {
 				// Passthrough remaining candidate-level fields as EXT_DATA
 				// inside the MSG block (e.g. safetyRatings, citationMetadata).
 				for key, val := range candMap {
-					prog.EmitKeyJSON(EXT_DATA, key, val)
+					prog.EmitExt(StyleGoogleGenAI, key, val)
 				}
 
 				prog.Emit(MSG_END)
@@ -125,7 +111,7 @@ func (p *GoogleGenAIParser) ParseResponse(body []byte) (*Program, error) {
 
 	// Passthrough remaining fields as EXT_DATA
 	for key, val := range raw {
-		prog.EmitKeyJSON(EXT_DATA, key, val)
+		prog.EmitExt(StyleGoogleGenAI, key, val)
 	}
 
 	return prog, nil
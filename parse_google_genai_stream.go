@@ -13,6 +13,12 @@ func (p *GoogleGenAIParser) ParseStreamChunk(body []byte) (*Program, error) {
 
 	prog := NewProgram()
 
+	// A failure mid-stream arrives as a Google RPC error object.
+	if errRaw, ok := raw["error"]; ok {
+		parseGeminiError(errRaw, 0).emit(prog, STREAM_ERROR)
+		return prog, nil
+	}
+
 	// Model version
 	if modelRaw, ok := raw["modelVersion"]; ok {
 		var model string
@@ -26,9 +32,11 @@ func (p *GoogleGenAIParser) ParseStreamChunk(body []byte) (*Program, error) {
 		var candidates []struct {
 			Content *struct {
 				Parts []struct {
-					Text         string `json:"text,omitempty"`
-					Thought      *bool  `json:"thought,omitempty"`
-					FunctionCall *struct {
+					Text             string `json:"text,omitempty"`
+					Thought          *bool  `json:"thought,omitempty"`
+					ThoughtSignature string `json:"thoughtSignature,omitempty"`
+					FunctionCall     *struct {
+						ID   string          `json:"id,omitempty"`
 						Name string          `json:"name"`
 						Args json.RawMessage `json:"args"`
 					} `json:"functionCall,omitempty"`
@@ -38,20 +46,41 @@ func (p *GoogleGenAIParser) ParseStreamChunk(body []byte) (*Program, error) {
 		}
 		if json.Unmarshal(candidatesRaw, &candidates) == nil {
 			for _, cand := range candidates {
+				calledTools := false
+				calls := 0
 				if cand.Content != nil {
 					for _, part := range cand.Content.Parts {
 						if part.Thought != nil && *part.Thought {
 							if part.Text != "" {
 								prog.EmitString(STREAM_THINK_DELTA, part.Text)
 							}
-						} else if part.Text != "" {
+							if part.ThoughtSignature != "" {
+								prog.EmitString(STREAM_THINK_SIG, part.ThoughtSignature)
+							}
+							continue
+						}
+						// Gemini also puts the signature of the preceding
+						// reasoning on the next content part (typically
+						// the function call); it precedes that content.
+						if part.ThoughtSignature != "" {
+							prog.EmitString(STREAM_THINK_SIG, part.ThoughtSignature)
+						}
+						if part.Text != "" {
 							prog.EmitString(STREAM_DELTA, part.Text)
 						}
 						if part.FunctionCall != nil {
+							// Each part is a whole call; the index counts
+							// calls within the chunk (a StreamConverter
+							// numbers them across chunks).
+							calledTools = true
 							td := map[string]any{
-								"index": 0,
+								"index": calls,
 								"name":  part.FunctionCall.Name,
 							}
+							if part.FunctionCall.ID != "" {
+								td["id"] = part.FunctionCall.ID
+							}
+							calls++
 							if len(part.FunctionCall.Args) > 0 {
 								td["arguments"] = string(part.FunctionCall.Args)
 							}
@@ -61,14 +90,7 @@ func (p *GoogleGenAIParser) ParseStreamChunk(body []byte) (*Program, error) {
 					}
 				}
 				if cand.FinishReason != "" {
-					switch cand.FinishReason {
-					case "STOP":
-						prog.EmitString(RESP_DONE, "stop")
-					case "MAX_TOKENS":
-						prog.EmitString(RESP_DONE, "length")
-					default:
-						prog.EmitString(RESP_DONE, cand.FinishReason)
-					}
+					prog.emitFinish(StyleGoogleGenAI, cand.FinishReason, calledTools)
 					prog.Emit(STREAM_END)
 				}
 			}
@@ -77,18 +99,8 @@ func (p *GoogleGenAIParser) ParseStreamChunk(body []byte) (*Program, error) {
 
 	// Usage in final chunk
 	if usageRaw, ok := raw["usageMetadata"]; ok {
-		var u struct {
-			PromptTokenCount     int `json:"promptTokenCount"`
-			CandidatesTokenCount int `json:"candidatesTokenCount"`
-			TotalTokenCount      int `json:"totalTokenCount"`
-		}
-		if json.Unmarshal(usageRaw, &u) == nil {
-			stdUsage, _ := json.Marshal(map[string]int{
-				"prompt_tokens":     u.PromptTokenCount,
-				"completion_tokens": u.CandidatesTokenCount,
-				"total_tokens":      u.TotalTokenCount,
-			})
-			prog.EmitJSON(USAGE, stdUsage)
+		if u, ok := parseGeminiUsage(usageRaw); ok {
+			u.emit(prog)
 		}
 		delete(raw, "usageMetadata")
 	}
@@ -97,7 +109,7 @@ func (p *GoogleGenAIParser) ParseStreamChunk(body []byte) (*Program, error) {
 
 	// Passthrough remaining fields as EXT_DATA
 	for key, val := range raw {
-		prog.EmitKeyJSON(EXT_DATA, key, val)
+		prog.EmitExt(StyleGoogleGenAI, key, val)
 	}
 
 	return prog, nil
@@ -145,11 +145,11 @@ func (p *ChatCompletionsParser) ParseRequest(body []byte) (*Program, error) {
 
 				// Remaining function-level fields as EXT_DATA (e.g., strict)
 				for key, val := range funcMap {
-					prog.EmitKeyJSON(EXT_DATA, key, val)
+					prog.EmitExt(StyleChatCompletions, key, val)
 				}
 				// Remaining outer tool-level fields as EXT_DATA
 				for key, val := range toolMap {
-					prog.EmitKeyJSON(EXT_DATA, key, val)
+					prog.EmitExt(StyleChatCompletions, key, val)
 				}
 			}
 			prog.Emit(DEF_END)
@@ -302,7 +302,7 @@ func (p *ChatCompletionsParser) ParseRequest(body []byte) (*Program, error) {
 
 			// Remaining per-message fields as EXT_DATA (e.g., name, refusal)
 			for key, val := range msgMap {
-				prog.EmitKeyJSON(EXT_DATA, key, val)
+				prog.EmitExt(StyleChatCompletions, key, val)
 			}
 
 			prog.Emit(MSG_END)
@@ -313,7 +313,7 @@ func (p *ChatCompletionsParser) ParseRequest(body []byte) (*Program, error) {
 	// Passthrough remaining fields as EXT_DATA
 	delete(raw, "stream_options") // handled implicitly by SET_STREAM
 	for key, val := range raw {
-		prog.EmitKeyJSON(EXT_DATA, key, val)
+		prog.EmitExt(StyleChatCompletions, key, val)
 	}
 
 	return prog, nil
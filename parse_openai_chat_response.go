@@ -33,7 +33,9 @@ func (p *ChatCompletionsParser) ParseResponse(body []byte) (*Program, error) {
 
 	// Usage
 	if usageRaw, ok := raw["usage"]; ok {
-		prog.EmitJSON(USAGE, usageRaw)
+		if u, ok := parseOpenAIUsage(usageRaw); ok {
+			u.emit(prog)
+		}
 		delete(raw, "usage")
 	}
 
@@ -100,7 +102,7 @@ func (p *ChatCompletionsParser) ParseResponse(body []byte) (*Program, error) {
 				if frRaw, ok := choiceMap["finish_reason"]; ok {
 					var fr string
 					if json.Unmarshal(frRaw, &fr) == nil && fr != "" {
-						prog.EmitString(RESP_DONE, fr)
+						prog.emitFinish(StyleChatCompletions, fr, false)
 					}
 					delete(choiceMap, "finish_reason")
 				}
@@ -111,7 +113,7 @@ func (p *ChatCompletionsParser) ParseResponse(body []byte) (*Program, error) {
 				// Passthrough remaining choice-level fields as EXT_DATA
 				// inside the MSG block (e.g. logprobs, content_filter_results).
 				for key, val := range choiceMap {
-					prog.EmitKeyJSON(EXT_DATA, key, val)
+					prog.EmitExt(StyleChatCompletions, key, val)
 				}
 
 				prog.Emit(MSG_END)
@@ -122,7 +124,7 @@ func (p *ChatCompletionsParser) ParseResponse(body []byte) (*Program, error) {
 
 	// Passthrough remaining fields as EXT_DATA
 	for key, val := range raw {
-		prog.EmitKeyJSON(EXT_DATA, key, val)
+		prog.EmitExt(StyleChatCompletions, key, val)
 	}
 	return prog, nil
 }
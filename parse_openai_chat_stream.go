@@ -13,6 +13,12 @@ func (p *ChatCompletionsParser) ParseStreamChunk(body []byte) (*Program, error)
 
 	prog := NewProgram()
 
+	// A failure mid-stream arrives as an error object instead of a chunk.
+	if errRaw, ok := raw["error"]; ok {
+		parseOpenAIError(errRaw, 0).emit(prog, STREAM_ERROR)
+		return prog, nil
+	}
+
 	// Response ID
 	if idRaw, ok := raw["id"]; ok {
 		var id string
@@ -33,7 +39,9 @@ func (p *ChatCompletionsParser) ParseStreamChunk(body []byte) (*Program, error)
 
 	// Usage (may appear in final chunk with stream_options)
 	if usageRaw, ok := raw["usage"]; ok {
-		prog.EmitJSON(USAGE, usageRaw)
+		if u, ok := parseOpenAIUsage(usageRaw); ok {
+			u.emit(prog)
+		}
 		delete(raw, "usage")
 	}
 
@@ -95,7 +103,7 @@ func (p *ChatCompletionsParser) ParseStreamChunk(body []byte) (*Program, error)
 					}
 				}
 				if choice.FinishReason != "" {
-					prog.EmitString(RESP_DONE, choice.FinishReason)
+					prog.emitFinish(StyleChatCompletions, choice.FinishReason, false)
 					prog.Emit(STREAM_END)
 				}
 			}
@@ -105,7 +113,7 @@ func (p *ChatCompletionsParser) ParseStreamChunk(body []byte) (*Program, error)
 
 	// Passthrough remaining fields as EXT_DATA
 	for key, val := range raw {
-		prog.EmitKeyJSON(EXT_DATA, key, val)
+		prog.EmitExt(StyleChatCompletions, key, val)
 	}
 
 	return prog, nil
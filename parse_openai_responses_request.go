@@ -79,7 +79,7 @@ func (p *ResponsesParser) ParseRequest(body []byte) (*Program, error) {
 			}
 			// If text had other fields, keep them as EXT_DATA
 			for key, val := range textObj {
-				prog.EmitKeyJSON(EXT_DATA, "text."+key, val)
+				prog.EmitExt(StyleResponses, "text."+key, val)
 			}
 		}
 		delete(raw, "text")
@@ -135,7 +135,7 @@ func (p *ResponsesParser) ParseRequest(body []byte) (*Program, error) {
 
 				// Remaining tool-level fields as EXT_DATA (e.g., strict)
 				for key, val := range toolMap {
-					prog.EmitKeyJSON(EXT_DATA, key, val)
+					prog.EmitExt(StyleResponses, key, val)
 				}
 			}
 			prog.Emit(DEF_END)
@@ -189,7 +189,7 @@ func (p *ResponsesParser) ParseRequest(body []byte) (*Program, error) {
 
 					// Remaining per-message fields as EXT_DATA
 					for key, val := range msgMap {
-						prog.EmitKeyJSON(EXT_DATA, key, val)
+						prog.EmitExt(StyleResponses, key, val)
 					}
 
 					prog.Emit(MSG_END)
@@ -201,7 +201,7 @@ func (p *ResponsesParser) ParseRequest(body []byte) (*Program, error) {
 
 	// Remaining fields as EXT_DATA
 	for key, val := range raw {
-		prog.EmitKeyJSON(EXT_DATA, key, val)
+		prog.EmitExt(StyleResponses, key, val)
 	}
 
 	return prog, nil
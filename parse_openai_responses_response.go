@@ -33,24 +33,24 @@ func (p *ResponsesParser) ParseResponse(body []byte) (*Program, error) {
 
 	// Usage
 	if usageRaw, ok := raw["usage"]; ok {
-		// Responses API usage has input_tokens/output_tokens/total_tokens
-		// Convert to standard format
-		var respUsage struct {
-			InputTokens  int `json:"input_tokens"`
-			OutputTokens int `json:"output_tokens"`
-			TotalTokens  int `json:"total_tokens"`
-		}
-		if json.Unmarshal(usageRaw, &respUsage) == nil {
-			stdUsage, _ := json.Marshal(map[string]int{
-				"prompt_tokens":     respUsage.InputTokens,
-				"completion_tokens": respUsage.OutputTokens,
-				"total_tokens":      respUsage.TotalTokens,
-			})
-			prog.EmitJSON(USAGE, stdUsage)
+		if u, ok := parseResponsesUsage(usageRaw); ok {
+			u.emit(prog)
 		}
 		delete(raw, "usage")
 	}
 
+	// An incomplete response says why it stopped; its unfinished message
+	// items finish with that reason.
+	var incomplete string
+	if idRaw, ok := raw["incomplete_details"]; ok {
+		var details struct {
+			Reason string `json:"reason"`
+		}
+		if json.Unmarshal(idRaw, &details) == nil {
+			incomplete = details.Reason
+		}
+	}
+
 	// Output items → messages
 	if outputRaw, ok := raw["output"]; ok {
 		var rawItems []json.RawMessage
@@ -89,7 +89,7 @@ func (p *ResponsesParser) ParseResponse(body []byte) (*Program, error) {
 					delete(itemMap, "type")
 					delete(itemMap, "id")
 					for key, val := range itemMap {
-						prog.EmitKeyJSON(EXT_DATA, key, val)
+						prog.EmitExt(StyleResponses, key, val)
 					}
 
 				case "message":
@@ -110,13 +110,21 @@ func (p *ResponsesParser) ParseResponse(body []byte) (*Program, error) {
 						}
 						delete(itemMap, "content")
 					}
-					prog.EmitString(RESP_DONE, "stop")
+					var status string
+					if statusRaw, ok := itemMap["status"]; ok {
+						json.Unmarshal(statusRaw, &status)
+					}
+					if status == "incomplete" && incomplete != "" {
+						prog.emitFinish(StyleResponses, incomplete, false)
+					} else {
+						prog.EmitString(RESP_DONE, "stop")
+					}
 					// Remaining item-level fields as EXT_DATA
 					delete(itemMap, "type")
 					delete(itemMap, "role")
 					delete(itemMap, "status")
 					for key, val := range itemMap {
-						prog.EmitKeyJSON(EXT_DATA, key, val)
+						prog.EmitExt(StyleResponses, key, val)
 					}
 					prog.Emit(MSG_END)
 
@@ -146,7 +154,7 @@ func (p *ResponsesParser) ParseResponse(body []byte) (*Program, error) {
 					delete(itemMap, "status")
 					delete(itemMap, "id")
 					for key, val := range itemMap {
-						prog.EmitKeyJSON(EXT_DATA, key, val)
+						prog.EmitExt(StyleResponses, key, val)
 					}
 					prog.Emit(CALL_END)
 					prog.EmitString(RESP_DONE, "tool_calls")
@@ -159,7 +167,7 @@ func (p *ResponsesParser) ParseResponse(body []byte) (*Program, error) {
 
 	// Passthrough remaining fields as EXT_DATA
 	for key, val := range raw {
-		prog.EmitKeyJSON(EXT_DATA, key, val)
+		prog.EmitExt(StyleResponses, key, val)
 	}
 
 	return prog, nil
@@ -114,25 +114,41 @@ func (p *ResponsesParser) ParseStreamChunk(body []byte) (*Program, error) {
 			}
 		}
 
-	case "response.completed", "response.done":
+	case "response.completed", "response.done", "response.incomplete":
 		if respRaw, ok := raw["response"]; ok {
 			var resp struct {
-				Usage *struct {
-					InputTokens  int `json:"input_tokens"`
-					OutputTokens int `json:"output_tokens"`
-					TotalTokens  int `json:"total_tokens"`
-				} `json:"usage,omitempty"`
+				IncompleteDetails *struct {
+					Reason string `json:"reason"`
+				} `json:"incomplete_details,omitempty"`
+				Usage json.RawMessage `json:"usage,omitempty"`
 			}
-			if json.Unmarshal(respRaw, &resp) == nil && resp.Usage != nil {
-				stdUsage, _ := json.Marshal(map[string]int{
-					"prompt_tokens":     resp.Usage.InputTokens,
-					"completion_tokens": resp.Usage.OutputTokens,
-					"total_tokens":      resp.Usage.TotalTokens,
-				})
-				prog.EmitJSON(USAGE, stdUsage)
+			if json.Unmarshal(respRaw, &resp) == nil {
+				if resp.IncompleteDetails != nil && resp.IncompleteDetails.Reason != "" {
+					prog.emitFinish(StyleResponses, resp.IncompleteDetails.Reason, false)
+				}
+				if len(resp.Usage) > 0 {
+					if u, ok := parseResponsesUsage(resp.Usage); ok {
+						u.emit(prog)
+					}
+				}
 			}
 		}
 		prog.Emit(STREAM_END)
+
+	case "error":
+		// Error events carry code and message at the top level.
+		j, _ := json.Marshal(map[string]json.RawMessage{"code": raw["code"], "message": raw["message"]})
+		parseOpenAIError(j, 0).emit(prog, STREAM_ERROR)
+
+	case "response.failed":
+		if respRaw, ok := raw["response"]; ok {
+			var resp struct {
+				Error json.RawMessage `json:"error"`
+			}
+			if json.Unmarshal(respRaw, &resp) == nil && len(resp.Error) > 0 {
+				parseOpenAIError(resp.Error, 0).emit(prog, STREAM_ERROR)
+			}
+		}
 	}
 
 	return prog, nil
@@ -0,0 +1,224 @@
+package ail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ─── Passes ──────────────────────────────────────────────────────────────────
+
+// ProgramKind tells a pass what kind of program it is looking at. Kinds are
+// bit flags so a pass can declare several at once.
+type ProgramKind uint8
+
+const (
+	KindRequest     ProgramKind = 1 << iota // a full request program
+	KindResponse                            // a full (non-streaming) response program
+	KindStreamChunk                         // a partial program parsed from one stream chunk
+
+	KindAll = KindRequest | KindResponse | KindStreamChunk
+)
+
+func (k ProgramKind) String() string {
+	var names []string
+	for _, kn := range []struct {
+		k    ProgramKind
+		name string
+	}{{KindRequest, "request"}, {KindResponse, "response"}, {KindStreamChunk, "stream"}} {
+		if k&kn.k != 0 {
+			names = append(names, kn.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// Pass is one transformation step in a Pipeline.
+//
+// Apply may modify p in place or return a different program. Returning a nil
+// program from a KindStreamChunk pass drops the chunk. A pass is
+// "stream-safe" if Applies(KindStreamChunk) is true: it must then cope with
+// partial programs that contain only stream opcodes.
+type Pass interface {
+	Name() string
+	Applies(kind ProgramKind) bool
+	Apply(ctx context.Context, kind ProgramKind, p *Program) (*Program, error)
+}
+
+// PassFunc adapts a function into a Pass that runs for the given kinds.
+func PassFunc(name string, kinds ProgramKind, fn func(ctx context.Context, kind ProgramKind, p *Program) (*Program, error)) Pass {
+	return &funcPass{name: name, kinds: kinds, fn: fn}
+}
+
+type funcPass struct {
+	name  string
+	kinds ProgramKind
+	fn    func(context.Context, ProgramKind, *Program) (*Program, error)
+}
+
+func (f *funcPass) Name() string                  { return f.name }
+func (f *funcPass) Applies(kind ProgramKind) bool { return f.kinds&kind != 0 }
+func (f *funcPass) Apply(ctx context.Context, kind ProgramKind, p *Program) (*Program, error) {
+	return f.fn(ctx, kind, p)
+}
+
+// PassError attributes a pipeline failure to the pass that caused it.
+type PassError struct {
+	Pass string
+	Kind ProgramKind
+	Err  error
+}
+
+func (e *PassError) Error() string {
+	return fmt.Sprintf("ail: pass %q (%s): %v", e.Pass, e.Kind, e.Err)
+}
+
+func (e *PassError) Unwrap() error { return e.Err }
+
+// PassStats reports one pass execution to Pipeline.OnPass.
+type PassStats struct {
+	Pass     string
+	Kind     ProgramKind
+	Duration time.Duration
+	Err      error
+}
+
+// ─── Pipeline ────────────────────────────────────────────────────────────────
+
+// Pipeline runs an ordered list of passes over programs. A pass only runs on
+// the kinds it Applies to. The zero value is an empty pipeline.
+//
+//	pl := ail.NewPipeline(
+//	    ail.ModelMapPass(map[string]string{"gpt-4o": "claude-sonnet-4"}),
+//	    ail.SystemPromptPass("Be brief."),
+//	)
+//	out, err := pl.ConvertRequest(ctx, body, ail.StyleChatCompletions, ail.StyleAnthropic)
+type Pipeline struct {
+	passes []Pass
+
+	// OnPass, if set, is called after every pass execution with its timing
+	// and outcome. It must be safe for concurrent use if the pipeline is.
+	OnPass func(PassStats)
+}
+
+// NewPipeline creates a pipeline running passes in order.
+func NewPipeline(passes ...Pass) *Pipeline {
+	return &Pipeline{passes: passes}
+}
+
+// Use appends passes to the pipeline and returns it.
+func (pl *Pipeline) Use(passes ...Pass) *Pipeline {
+	pl.passes = append(pl.passes, passes...)
+	return pl
+}
+
+// Passes returns the pipeline's passes in order.
+func (pl *Pipeline) Passes() []Pass {
+	return append([]Pass(nil), pl.passes...)
+}
+
+// Run applies every pass that applies to kind, in order. The first failing
+// pass stops the pipeline and is reported as a *PassError. A stream chunk
+// dropped by a pass (nil program) ends the run with a nil program.
+func (pl *Pipeline) Run(ctx context.Context, kind ProgramKind, p *Program) (*Program, error) {
+	if pl == nil {
+		return p, nil
+	}
+	for _, pass := range pl.passes {
+		if p == nil {
+			return nil, nil
+		}
+		if !pass.Applies(kind) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, &PassError{Pass: pass.Name(), Kind: kind, Err: err}
+		}
+		start := time.Now()
+		out, err := pass.Apply(ctx, kind, p)
+		if pl.OnPass != nil {
+			pl.OnPass(PassStats{Pass: pass.Name(), Kind: kind, Duration: time.Since(start), Err: err})
+		}
+		if err != nil {
+			return nil, &PassError{Pass: pass.Name(), Kind: kind, Err: err}
+		}
+		if out == nil && kind != KindStreamChunk {
+			return nil, &PassError{Pass: pass.Name(), Kind: kind, Err: fmt.Errorf("returned nil program")}
+		}
+		p = out
+	}
+	return p, nil
+}
+
+// ConvertRequest parses body as from, runs the request passes and emits it
+// as to.
+func (pl *Pipeline) ConvertRequest(ctx context.Context, body []byte, from, to Style) ([]byte, error) {
+	parser, err := GetParser(from)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := parser.ParseRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	prog, err = pl.Run(ctx, KindRequest, prog)
+	if err != nil {
+		return nil, err
+	}
+	emitter, err := GetEmitter(to)
+	if err != nil {
+		return nil, err
+	}
+	return emitter.EmitRequest(prog)
+}
+
+// ConvertResponse parses body as from, runs the response passes and emits
+// it as to.
+func (pl *Pipeline) ConvertResponse(ctx context.Context, body []byte, from, to Style) ([]byte, error) {
+	parser, err := GetResponseParser(from)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := parser.ParseResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	prog, err = pl.Run(ctx, KindResponse, prog)
+	if err != nil {
+		return nil, err
+	}
+	emitter, err := GetResponseEmitter(to)
+	if err != nil {
+		return nil, err
+	}
+	return emitter.EmitResponse(prog)
+}
+
+// ─── Built-in passes ─────────────────────────────────────────────────────────
+
+// ModelMapPass rewrites SET_MODEL in requests according to models. Models
+// not in the map are left alone.
+func ModelMapPass(models map[string]string) Pass {
+	return PassFunc("model-map", KindRequest, func(_ context.Context, _ ProgramKind, p *Program) (*Program, error) {
+		for i, inst := range p.Code {
+			if inst.Op != SET_MODEL {
+				continue
+			}
+			if to, ok := models[inst.Str]; ok {
+				p = p.ReplaceRange(i, i, Instruction{Op: SET_MODEL, Str: to})
+			}
+		}
+		return p, nil
+	})
+}
+
+// SystemPromptPass prepends a system message to requests.
+func SystemPromptPass(text string) Pass {
+	return PassFunc("system-prompt", KindRequest, func(_ context.Context, _ ProgramKind, p *Program) (*Program, error) {
+		return p.PrependSystemPrompt(text), nil
+	})
+}
@@ -0,0 +1,89 @@
+package ail
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPipelineRequest(t *testing.T) {
+	var stats []PassStats
+	pl := NewPipeline(
+		ModelMapPass(map[string]string{"gpt-4o": "claude-sonnet-4"}),
+		SystemPromptPass("Be brief."),
+		PassFunc("response-only", KindResponse, func(context.Context, ProgramKind, *Program) (*Program, error) {
+			t.Error("response pass ran on a request")
+			return nil, nil
+		}),
+	)
+	pl.OnPass = func(s PassStats) { stats = append(stats, s) }
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	out, err := pl.ConvertRequest(context.Background(), []byte(body), StyleChatCompletions, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONField(t, out, "model", "claude-sonnet-4")
+	assertJSONField(t, out, "system", "Be brief.")
+
+	if len(stats) != 2 || stats[0].Pass != "model-map" || stats[1].Pass != "system-prompt" || stats[0].Kind != KindRequest {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPipelineErrorAttribution(t *testing.T) {
+	boom := errors.New("boom")
+	pl := NewPipeline(
+		PassFunc("ok", KindAll, func(_ context.Context, _ ProgramKind, p *Program) (*Program, error) { return p, nil }),
+		PassFunc("bad", KindResponse, func(context.Context, ProgramKind, *Program) (*Program, error) { return nil, boom }),
+	)
+	_, err := pl.Run(context.Background(), KindResponse, Build().Assistant(Text("x")).MustProgram())
+	var pe *PassError
+	if !errors.As(err, &pe) || pe.Pass != "bad" || pe.Kind != KindResponse || !errors.Is(err, boom) {
+		t.Fatalf("err = %v", err)
+	}
+	if !strings.Contains(err.Error(), `"bad"`) {
+		t.Errorf("error text = %q", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pl.Run(ctx, KindRequest, NewProgram()); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled run err = %v", err)
+	}
+}
+
+func TestStreamConverterPipeline(t *testing.T) {
+	conv, err := NewStreamConverter(StyleAnthropic, StyleChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.SetPipeline(NewPipeline(
+		// Request-only passes must not run on chunks.
+		SystemPromptPass("ignored"),
+		PassFunc("upper", KindStreamChunk, func(_ context.Context, _ ProgramKind, p *Program) (*Program, error) {
+			for i := range p.Code {
+				if p.Code[i].Op == STREAM_DELTA {
+					p.Code[i].Str = strings.ToUpper(p.Code[i].Str)
+				}
+			}
+			return p, nil
+		}),
+		PassFunc("drop-pings", KindStreamChunk, func(_ context.Context, _ ProgramKind, p *Program) (*Program, error) {
+			if p.HasOpcode(STREAM_DELTA) && strings.TrimSpace(p.Code[p.FindAll(STREAM_DELTA)[0]].Str) == "" {
+				return nil, nil
+			}
+			return p, nil
+		}),
+	))
+
+	out, err := conv.Push([]byte(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hello"}}`))
+	if err != nil || len(out) != 1 || !strings.Contains(string(out[0]), `"HELLO"`) {
+		t.Fatalf("out = %s, err = %v", out, err)
+	}
+	out, err = conv.Push([]byte(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" "}}`))
+	if err != nil || len(out) != 0 {
+		t.Fatalf("dropped chunk produced %s, err = %v", out, err)
+	}
+}
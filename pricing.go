@@ -0,0 +1,326 @@
+package ail
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ─── Pricing ─────────────────────────────────────────────────────────────────
+
+// ModelPrice is what one model costs, in currency units (normally USD) per
+// million tokens, except Image which is per image.
+//
+// A zero CachedRead or CacheWrite rate bills those tokens at Input, and a
+// zero Reasoning rate bills reasoning tokens at Output, which is how most
+// providers price them. Image is charged per generated image on top of the
+// tokens; leave it zero for providers that bill images as output tokens.
+type ModelPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CachedRead float64 `json:"cached_read,omitempty"`
+	CacheWrite float64 `json:"cache_write,omitempty"`
+	Reasoning  float64 `json:"reasoning,omitempty"`
+	Image      float64 `json:"image,omitempty"`
+}
+
+// Pricing maps model names to prices. Keys are exact model names or glob
+// patterns, where * matches any run of characters (including "/") and ?
+// matches one character:
+//
+//	{
+//	  "gpt-4o":           {"input": 2.5, "output": 10, "cached_read": 1.25},
+//	  "gpt-4o-mini*":     {"input": 0.15, "output": 0.6},
+//	  "claude-sonnet-4*": {"input": 3, "output": 15, "cached_read": 0.3, "cache_write": 3.75}
+//	}
+//
+// An exact key wins over any pattern; among matching patterns the longest
+// (most specific) wins.
+type Pricing map[string]ModelPrice
+
+// ParsePricing reads a pricing table from JSON or YAML. The YAML form is a
+// two-level mapping of model to rates:
+//
+//	# USD per million tokens
+//	"gpt-4o*":
+//	  input: 2.5
+//	  output: 10
+//
+// Only that subset of YAML (block mappings, scalar numbers, quoted or bare
+// keys and # comments) is accepted.
+func ParsePricing(data []byte) (Pricing, error) {
+	var raw map[string]ModelPrice
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, fmt.Errorf("ail: parse pricing: %w", err)
+		}
+	} else {
+		var err error
+		if raw, err = parsePricingYAML(data); err != nil {
+			return nil, fmt.Errorf("ail: parse pricing: %w", err)
+		}
+	}
+	return Pricing(raw), nil
+}
+
+// LoadPricing reads a pricing table (JSON or YAML) from disk.
+func LoadPricing(path string) (Pricing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ail: open pricing: %w", err)
+	}
+	return ParsePricing(data)
+}
+
+// parsePricingYAML parses the YAML subset described at ParsePricing.
+func parsePricingYAML(data []byte) (map[string]ModelPrice, error) {
+	out := make(map[string]ModelPrice)
+	var (
+		model   string
+		price   ModelPrice
+		started bool
+	)
+	flush := func() {
+		if started {
+			out[model] = price
+		}
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := stripYAMLComment(sc.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+		key, val, ok := cutYAMLKey(strings.TrimSpace(line))
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+
+		if !indented {
+			if val != "" {
+				return nil, fmt.Errorf("line %d: model %q must be followed by indented rates", n, key)
+			}
+			flush()
+			model, price, started = key, ModelPrice{}, true
+			continue
+		}
+		if !started {
+			return nil, fmt.Errorf("line %d: rate %q outside a model", n, key)
+		}
+		rate, err := strconv.ParseFloat(unquoteYAML(val), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n, key, err)
+		}
+		if !price.set(key, rate) {
+			return nil, fmt.Errorf("line %d: unknown rate %q", n, key)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return out, nil
+}
+
+// set assigns the rate named by its JSON name.
+func (m *ModelPrice) set(name string, rate float64) bool {
+	switch name {
+	case "input":
+		m.Input = rate
+	case "output":
+		m.Output = rate
+	case "cached_read":
+		m.CachedRead = rate
+	case "cache_write":
+		m.CacheWrite = rate
+	case "reasoning":
+		m.Reasoning = rate
+	case "image":
+		m.Image = rate
+	default:
+		return false
+	}
+	return true
+}
+
+// stripYAMLComment removes a # comment that is not inside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// cutYAMLKey splits a "key: value" line. The separator is the first colon
+// after a quoted key's closing quote, or else the first colon followed by a
+// space or the end of the line, so model IDs such as
+// "anthropic.claude-3-sonnet-20240229-v1:0" or llama3:8b keep their colons.
+func cutYAMLKey(line string) (key, val string, ok bool) {
+	start := 0
+	if len(line) > 0 && (line[0] == '"' || line[0] == '\'') {
+		end := strings.IndexByte(line[1:], line[0])
+		if end < 0 {
+			return "", "", false
+		}
+		start = end + 2
+	}
+	for i := start; i < len(line); i++ {
+		if line[i] == ':' && (i+1 == len(line) || line[i+1] == ' ' || line[i+1] == '\t') {
+			return unquoteYAML(strings.TrimSpace(line[:i])), strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func unquoteYAML(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Lookup returns the price for model and the key it was found under.
+func (p Pricing) Lookup(model string) (ModelPrice, string, bool) {
+	if price, ok := p[model]; ok {
+		return price, model, true
+	}
+	var keys []string
+	for k := range p {
+		if strings.ContainsAny(k, "*?") && globMatch(k, model) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ModelPrice{}, "", false
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return p[keys[0]], keys[0], true
+}
+
+// globMatch reports whether name matches pattern, where * matches any run
+// of characters and ? matches exactly one.
+func globMatch(pattern, name string) bool {
+	px, nx := 0, 0
+	star, retry := -1, 0
+	for nx < len(name) {
+		switch {
+		case px < len(pattern) && (pattern[px] == '?' || pattern[px] == name[nx]):
+			px++
+			nx++
+		case px < len(pattern) && pattern[px] == '*':
+			star, retry = px, nx
+			px++
+		case star >= 0:
+			retry++
+			px, nx = star+1, retry
+		default:
+			return false
+		}
+	}
+	for px < len(pattern) && pattern[px] == '*' {
+		px++
+	}
+	return px == len(pattern)
+}
+
+// ─── Cost ────────────────────────────────────────────────────────────────────
+
+// Cost is the price of one response, broken down by token category. Each
+// category is billed once: Input covers only prompt tokens that were neither
+// read from nor written to a cache, and Output only completion tokens that
+// were not reasoning.
+type Cost struct {
+	Model   string // model the response reported
+	Pattern string // Pricing key that priced it
+
+	Input      float64
+	CachedRead float64
+	CacheWrite float64
+	Output     float64
+	Reasoning  float64
+	Images     float64
+	Total      float64
+}
+
+// CostOf prices a response program: one from ParseResponse, or an
+// accumulated stream (Accumulator.Program, or all of a stream's chunk
+// programs appended together). The model comes from RESP_MODEL, falling
+// back to SET_MODEL, and the token counts from Usage. Images are the
+// IMG_REF instructions in the program, i.e. generated images.
+//
+// An error is returned when the program names no model, has no usage, or
+// the model is not in pricing.
+func CostOf(prog *Program, pricing Pricing) (*Cost, error) {
+	model := costModel(prog)
+	if model == "" {
+		return nil, fmt.Errorf("ail: cost: program has no RESP_MODEL or SET_MODEL")
+	}
+	price, pattern, ok := pricing.Lookup(model)
+	if !ok {
+		return nil, fmt.Errorf("ail: cost: no price for model %q", model)
+	}
+	u := prog.Usage()
+	if u == nil {
+		return nil, fmt.Errorf("ail: cost: program has no USAGE")
+	}
+
+	cachedRate := orRate(price.CachedRead, price.Input)
+	writeRate := orRate(price.CacheWrite, price.Input)
+	reasoningRate := orRate(price.Reasoning, price.Output)
+	perToken := func(n int, rate float64) float64 { return float64(n) * rate / 1e6 }
+
+	c := &Cost{
+		Model:      model,
+		Pattern:    pattern,
+		Input:      perToken(max(u.PromptTokens-u.CachedTokens-u.CacheWriteTokens, 0), price.Input),
+		CachedRead: perToken(u.CachedTokens, cachedRate),
+		CacheWrite: perToken(u.CacheWriteTokens, writeRate),
+		Output:     perToken(max(u.CompletionTokens-u.ReasoningTokens, 0), price.Output),
+		Reasoning:  perToken(u.ReasoningTokens, reasoningRate),
+		Images:     float64(len(prog.FindAll(IMG_REF))) * price.Image,
+	}
+	c.Total = c.Input + c.CachedRead + c.CacheWrite + c.Output + c.Reasoning + c.Images
+	return c, nil
+}
+
+func costModel(prog *Program) string {
+	var model string
+	for _, inst := range prog.Code {
+		switch {
+		case inst.Op == RESP_MODEL && inst.Str != "":
+			return inst.Str
+		case inst.Op == SET_MODEL && model == "":
+			model = inst.Str
+		}
+	}
+	return model
+}
+
+func orRate(rate, fallback float64) float64 {
+	if rate != 0 {
+		return rate
+	}
+	return fallback
+}
@@ -0,0 +1,185 @@
+package ail
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePricing(t *testing.T) {
+	want := Pricing{
+		"gpt-4o*":         {Input: 2.5, Output: 10, CachedRead: 1.25},
+		"claude-sonnet-4": {Input: 3, Output: 15, CachedRead: 0.3, CacheWrite: 3.75},
+	}
+	yaml := `
+# USD per million tokens
+"gpt-4o*":
+  input: 2.5   # list price
+  output: 10
+  cached_read: 1.25
+
+claude-sonnet-4:
+  input: 3
+  output: 15
+  cached_read: 0.3
+  cache_write: 3.75
+`
+	json := `{
+  "gpt-4o*": {"input": 2.5, "output": 10, "cached_read": 1.25},
+  "claude-sonnet-4": {"input": 3, "output": 15, "cached_read": 0.3, "cache_write": 3.75}
+}`
+	for name, src := range map[string]string{"yaml": yaml, "json": json} {
+		got, err := ParsePricing([]byte(src))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d models, want %d", name, len(got), len(want))
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("%s: %s = %+v, want %+v", name, k, got[k], v)
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "pricing.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := LoadPricing(path); err != nil || len(p) != 2 {
+		t.Errorf("LoadPricing = %v, %v", p, err)
+	}
+
+	colons, err := ParsePricing([]byte(`
+"anthropic.claude-3-sonnet-20240229-v1:0":
+  input: 3
+  output: 15
+'gemini-*:generateContent':
+  input: 1.25
+  output: 10
+llama3:8b:
+  input: 0.1
+  output: 0.1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"anthropic.claude-3-sonnet-20240229-v1:0", "gemini-*:generateContent", "llama3:8b"} {
+		if _, ok := colons[k]; !ok {
+			t.Errorf("key %q missing from %v", k, colons)
+		}
+	}
+
+	for _, bad := range []string{
+		"gpt-4o: 2.5\n",
+		"\"gpt-4o:\n  input: 2.5\n",
+		"  input: 2.5\n",
+		"gpt-4o:\n  input: cheap\n",
+		"gpt-4o:\n  inptu: 2.5\n",
+	} {
+		if _, err := ParsePricing([]byte(bad)); err == nil {
+			t.Errorf("ParsePricing(%q): expected error", bad)
+		}
+	}
+}
+
+func TestPricingLookup(t *testing.T) {
+	p := Pricing{
+		"gpt-4o":            {Input: 1},
+		"gpt-4o*":           {Input: 2},
+		"gpt-4o-mini*":      {Input: 3},
+		"*/gemini-2.5-pro*": {Input: 4},
+	}
+	tests := []struct {
+		model, key string
+	}{
+		{"gpt-4o", "gpt-4o"},
+		{"gpt-4o-2024-08-06", "gpt-4o*"},
+		{"gpt-4o-mini-2024-07-18", "gpt-4o-mini*"},
+		{"models/gemini-2.5-pro-preview", "*/gemini-2.5-pro*"},
+		{"gpt-5", ""},
+	}
+	for _, tt := range tests {
+		_, key, ok := p.Lookup(tt.model)
+		if key != tt.key || ok != (tt.key != "") {
+			t.Errorf("Lookup(%q) = %q, %v, want %q", tt.model, key, ok, tt.key)
+		}
+	}
+}
+
+func TestCostOf(t *testing.T) {
+	pricing := Pricing{
+		"claude-sonnet-4*": {Input: 3, Output: 15, CachedRead: 0.3, CacheWrite: 3.75},
+		"o3*":              {Input: 2, Output: 8},
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-12 }
+
+	resp, err := (&AnthropicParser{}).ParseResponse([]byte(`{"id":"m","type":"message","role":"assistant",
+		"model":"claude-sonnet-4-20250514","content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn",
+		"usage":{"input_tokens":1000,"output_tokens":2000,"cache_read_input_tokens":10000,"cache_creation_input_tokens":4000}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := CostOf(resp, pricing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Cost{
+		Model: "claude-sonnet-4-20250514", Pattern: "claude-sonnet-4*",
+		Input: 0.003, CachedRead: 0.003, CacheWrite: 0.015, Output: 0.03, Total: 0.051,
+	}
+	if c.Model != want.Model || c.Pattern != want.Pattern || !near(c.Input, want.Input) ||
+		!near(c.CachedRead, want.CachedRead) || !near(c.CacheWrite, want.CacheWrite) ||
+		!near(c.Output, want.Output) || c.Reasoning != 0 || !near(c.Total, want.Total) {
+		t.Errorf("CostOf = %+v, want %+v", *c, want)
+	}
+
+	// An accumulated Chat stream; reasoning falls back to the output rate.
+	acc := NewAccumulator()
+	for _, chunk := range []string{
+		`{"id":"c","model":"o3-2025-04-16","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+		`{"id":"c","model":"o3-2025-04-16","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`{"id":"c","model":"o3-2025-04-16","choices":[],"usage":{"prompt_tokens":500,"completion_tokens":1500,"total_tokens":2000,
+		  "completion_tokens_details":{"reasoning_tokens":1000}}}`,
+	} {
+		p, err := (&ChatCompletionsParser{}).ParseStreamChunk([]byte(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		acc.Add(p)
+	}
+	c, err = CostOf(acc.Program(), pricing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(c.Input, 0.001) || !near(c.Output, 0.004) || !near(c.Reasoning, 0.008) || !near(c.Total, 0.013) {
+		t.Errorf("stream CostOf = %+v", *c)
+	}
+
+	if _, err := CostOf(resp, Pricing{"gpt-4o": {Input: 1}}); err == nil {
+		t.Error("expected error for unpriced model")
+	}
+	if _, err := CostOf(NewProgram(), pricing); err == nil {
+		t.Error("expected error for program without model")
+	}
+}
+
+func TestCostOfImages(t *testing.T) {
+	prog := NewProgram()
+	prog.EmitString(RESP_MODEL, "gemini-2.5-flash-image")
+	Usage{PromptTokens: 10, CompletionTokens: 1290}.emit(prog)
+	prog.Emit(MSG_START)
+	prog.Emit(ROLE_AST)
+	prog.EmitRef(IMG_REF, prog.AddBuffer([]byte("png")))
+	prog.Emit(MSG_END)
+
+	c, err := CostOf(prog, Pricing{"gemini-*-image": {Input: 0.3, Output: 30, Image: 0.039}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(c.Images-0.039) > 1e-12 || math.Abs(c.Total-(0.000003+0.0387+0.039)) > 1e-12 {
+		t.Errorf("CostOf = %+v", *c)
+	}
+}
@@ -30,6 +30,7 @@ type Instruction struct {
 	JSON json.RawMessage // used by DEF_SCHEMA, CALL_ARGS, USAGE, EXT_DATA, STREAM_TOOL_DELTA
 	Key  string          // used by SET_META, EXT_DATA (the key part)
 	Ref  uint32          // used by IMG_REF, AUD_REF, TXT_REF
+	NS   Style           // used by EXT_DATA (originating namespace, "" = untagged)
 }
 
 // Program is an ordered list of instructions plus a side-buffer for large blobs.
@@ -83,6 +84,13 @@ func (p *Program) EmitKeyJSON(op Opcode, key string, j json.RawMessage) {
 	p.Code = append(p.Code, Instruction{Op: op, Key: key, JSON: j})
 }
 
+// EmitExt appends an EXT_DATA instruction tagged with the namespace of the
+// provider style it originated from. Emitters apply tagged extensions only
+// when the namespace matches their own style or one they explicitly accept.
+func (p *Program) EmitExt(ns Style, key string, j json.RawMessage) {
+	p.Code = append(p.Code, Instruction{Op: EXT_DATA, Key: key, JSON: j, NS: ns})
+}
+
 // EmitRef appends an opcode with a buffer reference.
 func (p *Program) EmitRef(op Opcode, ref uint32) {
 	p.Code = append(p.Code, Instruction{Op: op, Ref: ref})
@@ -146,13 +154,20 @@ func (p *Program) Clone() *Program {
 	for i, inst := range p.Code {
 		result.Code[i] = cloneInstruction(inst)
 	}
-	result.Buffers = make([][]byte, len(p.Buffers))
-	for i, b := range p.Buffers {
+	result.Buffers = cloneBuffers(p.Buffers)
+	return result
+}
+
+// cloneBuffers returns a deep copy of a program's side-buffers, for derived
+// programs that keep the buffer numbering of their source.
+func cloneBuffers(bufs [][]byte) [][]byte {
+	out := make([][]byte, len(bufs))
+	for i, b := range bufs {
 		buf := make([]byte, len(b))
 		copy(buf, b)
-		result.Buffers[i] = buf
+		out[i] = buf
 	}
-	return result
+	return out
 }
 
 // Len returns the number of instructions.
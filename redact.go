@@ -0,0 +1,493 @@
+package ail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ─── Detectors ───────────────────────────────────────────────────────────────
+
+// Detector finds sensitive substrings in text.
+type Detector interface {
+	// Name is the label used in placeholders, e.g. "EMAIL" → [EMAIL_1].
+	Name() string
+	// Detect returns the [start, end) byte ranges of sensitive data in s.
+	Detect(s string) [][2]int
+}
+
+// RegexpDetector is a Detector driven by a regular expression, with an
+// optional validation step for each match (e.g. a checksum).
+type RegexpDetector struct {
+	Label   string
+	Pattern *regexp.Regexp
+	Valid   func(match string) bool
+}
+
+func (d *RegexpDetector) Name() string { return d.Label }
+
+func (d *RegexpDetector) Detect(s string) [][2]int {
+	var out [][2]int
+	for _, m := range d.Pattern.FindAllStringIndex(s, -1) {
+		if d.Valid == nil || d.Valid(s[m[0]:m[1]]) {
+			out = append(out, [2]int{m[0], m[1]})
+		}
+	}
+	return out
+}
+
+// EmailDetector finds e-mail addresses.
+func EmailDetector() Detector {
+	return &RegexpDetector{
+		Label:   "EMAIL",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	}
+}
+
+// PhoneDetector finds phone numbers written with separators or a leading
+// country code. A match needs 10–15 digits (8 with a "+" prefix).
+func PhoneDetector() Detector {
+	return &RegexpDetector{
+		Label:   "PHONE",
+		Pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\d{2,4}(?:[ .-]\d{2,4}){1,4}\b`),
+		Valid: func(m string) bool {
+			n := countDigits(m)
+			if strings.HasPrefix(m, "+") {
+				return n >= 8 && n <= 15
+			}
+			return n >= 10 && n <= 15
+		},
+	}
+}
+
+// CardDetector finds payment card numbers (13–19 digits, optionally grouped
+// by spaces or dashes) that pass the Luhn checksum.
+func CardDetector() Detector {
+	return &RegexpDetector{
+		Label:   "CARD",
+		Pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Valid:   luhnValid,
+	}
+}
+
+// APIKeyDetector finds common API key and token formats (OpenAI/Anthropic
+// "sk-" keys, AWS access key IDs, Google API keys, GitHub and Slack tokens).
+func APIKeyDetector() Detector {
+	return &RegexpDetector{
+		Label: "API_KEY",
+		Pattern: regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_-]{35}|` +
+			`gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,})`),
+	}
+}
+
+// DefaultDetectors returns the built-in detectors. API keys come first so a
+// key that happens to contain a digit run is not reported as a phone number.
+func DefaultDetectors() []Detector {
+	return []Detector{APIKeyDetector(), EmailDetector(), CardDetector(), PhoneDetector()}
+}
+
+func countDigits(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// ─── Redactor ────────────────────────────────────────────────────────────────
+
+// Redaction is an audit record for one redacted value. The original value is
+// deliberately not included.
+type Redaction struct {
+	Detector    string `json:"detector"`
+	Placeholder string `json:"placeholder"`
+	Op          Opcode `json:"op"`
+	Index       int    `json:"index"`          // instruction index in the redacted program
+	Path        string `json:"path,omitempty"` // JSON path inside CALL_ARGS
+}
+
+// Redactor replaces sensitive data with placeholders such as [EMAIL_1] and
+// remembers the mapping so responses can be restored. The same value always
+// gets the same placeholder. A Redactor is safe for concurrent use; its vault
+// grows with every distinct value, so scope one to a conversation or tenant.
+type Redactor struct {
+	Detectors []Detector
+
+	// OnAudit, if set, receives the records of every Redact call made by
+	// the redactor's passes.
+	OnAudit func([]Redaction)
+
+	mu       sync.Mutex
+	byValue  map[string]string // original → placeholder
+	byHolder map[string]string // placeholder → original
+	counters map[string]int
+}
+
+// NewRedactor creates a redactor using detectors, or DefaultDetectors if
+// none are given.
+func NewRedactor(detectors ...Detector) *Redactor {
+	if len(detectors) == 0 {
+		detectors = DefaultDetectors()
+	}
+	return &Redactor{
+		Detectors: detectors,
+		byValue:   make(map[string]string),
+		byHolder:  make(map[string]string),
+		counters:  make(map[string]int),
+	}
+}
+
+var placeholderRe = regexp.MustCompile(`\[[A-Z][A-Z0-9_]*_[0-9]+\]`)
+
+// placeholder returns the placeholder for value, allocating one if needed.
+func (r *Redactor) placeholder(label, value string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ph, ok := r.byValue[value]; ok {
+		return ph
+	}
+	r.counters[label]++
+	ph := "[" + label + "_" + strconv.Itoa(r.counters[label]) + "]"
+	r.byValue[value] = ph
+	r.byHolder[ph] = value
+	return ph
+}
+
+// RedactString replaces every detected value in s and returns the new
+// string plus the detector label and placeholder of each replacement.
+func (r *Redactor) RedactString(s string) (string, [][2]string) {
+	type hit struct {
+		start, end int
+		label      string
+	}
+	var hits []hit
+	for _, d := range r.Detectors {
+		for _, m := range d.Detect(s) {
+			hits = append(hits, hit{m[0], m[1], d.Name()})
+		}
+	}
+	if len(hits) == 0 {
+		return s, nil
+	}
+	// Earlier detectors win ties; overlapping later hits are dropped.
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].start < hits[j].start })
+
+	var b strings.Builder
+	var found [][2]string
+	pos := 0
+	for _, h := range hits {
+		if h.start < pos {
+			continue
+		}
+		ph := r.placeholder(h.label, s[h.start:h.end])
+		b.WriteString(s[pos:h.start])
+		b.WriteString(ph)
+		found = append(found, [2]string{h.label, ph})
+		pos = h.end
+	}
+	b.WriteString(s[pos:])
+	return b.String(), found
+}
+
+// Restore replaces known placeholders in s with their original values.
+// Unknown placeholder-like text is left alone.
+func (r *Redactor) Restore(s string) string {
+	return r.restore(s, false)
+}
+
+func (r *Redactor) restore(s string, jsonEscape bool) string {
+	if !strings.Contains(s, "[") {
+		return s
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return placeholderRe.ReplaceAllStringFunc(s, func(ph string) string {
+		orig, ok := r.byHolder[ph]
+		if !ok {
+			return ph
+		}
+		if jsonEscape {
+			q, _ := json.Marshal(orig)
+			return string(q[1 : len(q)-1])
+		}
+		return orig
+	})
+}
+
+// Redact returns a copy of p with sensitive data in TXT_CHUNK, RESULT_DATA,
+// THINK_CHUNK and CALL_ARGS replaced by placeholders. CALL_ARGS is redacted
+// value-by-value when it is valid JSON, so the result stays valid JSON.
+func (r *Redactor) Redact(p *Program) (*Program, []Redaction) {
+	out := p.Clone()
+	var audit []Redaction
+	record := func(i int, path string, found [][2]string) {
+		for _, f := range found {
+			audit = append(audit, Redaction{Detector: f[0], Placeholder: f[1], Op: out.Code[i].Op, Index: i, Path: path})
+		}
+	}
+	for i := range out.Code {
+		inst := &out.Code[i]
+		switch inst.Op {
+		case TXT_CHUNK, RESULT_DATA, THINK_CHUNK:
+			s, found := r.RedactString(inst.Str)
+			inst.Str = s
+			record(i, "", found)
+		case CALL_ARGS:
+			var v any
+			dec := json.NewDecoder(bytes.NewReader(inst.JSON))
+			dec.UseNumber()
+			if dec.Decode(&v) != nil {
+				s, found := r.RedactString(string(inst.JSON))
+				inst.JSON = json.RawMessage(s)
+				record(i, "", found)
+				continue
+			}
+			changed := false
+			v = r.redactValue(v, "", func(path string, found [][2]string) {
+				changed = true
+				record(i, path, found)
+			})
+			if changed {
+				if j, err := encodeJSONValue(v); err == nil {
+					inst.JSON = j
+				}
+			}
+		}
+	}
+	return out, audit
+}
+
+// redactValue redacts every string inside a decoded JSON value.
+func (r *Redactor) redactValue(v any, path string, report func(string, [][2]string)) any {
+	switch t := v.(type) {
+	case string:
+		s, found := r.RedactString(t)
+		if len(found) > 0 {
+			report(path, found)
+		}
+		return s
+	case map[string]any:
+		for k, e := range t {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			t[k] = r.redactValue(e, p, report)
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = r.redactValue(e, fmt.Sprintf("%s[%d]", path, i), report)
+		}
+	}
+	return v
+}
+
+// RestoreProgram returns a copy of p with placeholders in TXT_CHUNK,
+// RESULT_DATA, THINK_CHUNK and CALL_ARGS restored.
+func (r *Redactor) RestoreProgram(p *Program) *Program {
+	out := p.Clone()
+	for i := range out.Code {
+		inst := &out.Code[i]
+		switch inst.Op {
+		case TXT_CHUNK, RESULT_DATA, THINK_CHUNK:
+			inst.Str = r.restore(inst.Str, false)
+		case CALL_ARGS:
+			inst.JSON = json.RawMessage(r.restore(string(inst.JSON), true))
+		}
+	}
+	return out
+}
+
+// Pass returns a pass that redacts requests and restores responses. Use
+// StreamPass for streamed responses.
+func (r *Redactor) Pass() Pass {
+	return PassFunc("redact", KindRequest|KindResponse, func(_ context.Context, kind ProgramKind, p *Program) (*Program, error) {
+		if kind == KindResponse {
+			return r.RestoreProgram(p), nil
+		}
+		out, audit := r.Redact(p)
+		if r.OnAudit != nil && len(audit) > 0 {
+			r.OnAudit(audit)
+		}
+		return out, nil
+	})
+}
+
+// ─── Stream restoration ──────────────────────────────────────────────────────
+
+// maxPlaceholderLen bounds how much text a StreamRestorer holds back while
+// waiting for the rest of a possible placeholder.
+const maxPlaceholderLen = 48
+
+// StreamRestorer restores placeholders in streamed text, where a placeholder
+// may be split across deltas. Text that could be the start of a placeholder
+// is held back until it is complete or ruled out. Each stream needs its own
+// StreamRestorer; channels separate interleaved text, thinking and
+// per-tool argument deltas. On channels named "tool:…", which carry the
+// JSON text of tool-call arguments, restored values are JSON-escaped.
+type StreamRestorer struct {
+	r       *Redactor
+	pending map[string]string
+	order   []string
+}
+
+// NewStreamRestorer creates a restorer for one stream.
+func (r *Redactor) NewStreamRestorer() *StreamRestorer {
+	return &StreamRestorer{r: r, pending: make(map[string]string)}
+}
+
+// Push adds a delta on channel and returns the text that can be emitted.
+func (s *StreamRestorer) Push(channel, delta string) string {
+	return s.push(channel, delta, isToolChannel(channel))
+}
+
+func (s *StreamRestorer) push(channel, delta string, jsonEscape bool) string {
+	if _, ok := s.pending[channel]; !ok {
+		s.order = append(s.order, channel)
+	}
+	text := s.pending[channel] + delta
+	hold := holdback(text)
+	s.pending[channel] = text[hold:]
+	return s.r.restore(text[:hold], jsonEscape)
+}
+
+// Flush returns whatever is held back on channel.
+func (s *StreamRestorer) Flush(channel string) string {
+	text := s.pending[channel]
+	s.pending[channel] = ""
+	return s.r.restore(text, isToolChannel(channel))
+}
+
+// isToolChannel reports whether channel carries tool-call arguments.
+func isToolChannel(channel string) bool {
+	return strings.HasPrefix(channel, "tool:")
+}
+
+// holdback returns the index from which text may be an incomplete
+// placeholder, or len(text).
+func holdback(text string) int {
+	i := strings.LastIndexByte(text, '[')
+	if i < 0 || len(text)-i >= maxPlaceholderLen {
+		return len(text)
+	}
+	for _, c := range text[i+1:] {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return len(text)
+		}
+	}
+	return i
+}
+
+// StreamPass returns a pass that restores placeholders in STREAM_DELTA,
+// STREAM_THINK_DELTA and STREAM_TOOL_DELTA arguments. The pass holds state
+// for a single stream: create one per StreamConverter.
+//
+// Held-back text is released before STREAM_BLOCK_END, RESP_DONE or
+// STREAM_END. Chunks left with no content are dropped.
+func (r *Redactor) StreamPass() Pass {
+	rs := r.NewStreamRestorer()
+	var mu sync.Mutex
+	return PassFunc("redact-restore", KindStreamChunk, func(_ context.Context, _ ProgramKind, p *Program) (*Program, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return rs.restoreChunk(p), nil
+	})
+}
+
+func (s *StreamRestorer) restoreChunk(p *Program) *Program {
+	out := &Program{Buffers: p.Buffers}
+	removed, content := false, false
+	for _, inst := range p.Code {
+		switch inst.Op {
+		case STREAM_DELTA, STREAM_THINK_DELTA:
+			inst.Str = s.push(inst.Op.Name(), inst.Str, false)
+			if inst.Str == "" {
+				removed = true
+				continue
+			}
+		case STREAM_TOOL_DELTA:
+			var td map[string]json.RawMessage
+			var args string
+			if json.Unmarshal(inst.JSON, &td) != nil || json.Unmarshal(td["arguments"], &args) != nil {
+				break
+			}
+			args = s.push("tool:"+string(td["index"]), args, true)
+			if args == "" && len(td) <= 2 {
+				removed = true
+				continue
+			}
+			if args == "" {
+				delete(td, "arguments")
+			} else {
+				td["arguments"], _ = json.Marshal(args)
+			}
+			inst.JSON, _ = json.Marshal(td)
+		case STREAM_BLOCK_END, RESP_DONE, STREAM_END:
+			out.Code = append(out.Code, s.flushAll()...)
+		}
+		switch inst.Op {
+		case RESP_ID, RESP_MODEL, EXT_DATA, SET_META:
+		default:
+			content = true
+		}
+		out.Code = append(out.Code, inst)
+	}
+	if removed && !content {
+		return nil
+	}
+	return out
+}
+
+// flushAll releases held-back text on every channel as stream deltas.
+func (s *StreamRestorer) flushAll() []Instruction {
+	var out []Instruction
+	for _, ch := range s.order {
+		text := s.pending[ch]
+		if text == "" {
+			continue
+		}
+		s.pending[ch] = ""
+		if idx, ok := strings.CutPrefix(ch, "tool:"); ok {
+			td := map[string]any{"arguments": s.r.restore(text, true)}
+			if idx != "" {
+				td["index"] = json.RawMessage(idx)
+			}
+			j, _ := json.Marshal(td)
+			out = append(out, Instruction{Op: STREAM_TOOL_DELTA, JSON: j})
+			continue
+		}
+		op := STREAM_DELTA
+		if ch == STREAM_THINK_DELTA.Name() {
+			op = STREAM_THINK_DELTA
+		}
+		out = append(out, Instruction{Op: op, Str: s.r.Restore(text)})
+	}
+	return out
+}
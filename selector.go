@@ -0,0 +1,591 @@
+package ail
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ─── Selectors ───────────────────────────────────────────────────────────────
+//
+// A selector picks instruction spans out of a program with a CSS-like
+// syntax, so routing and policy rules can be written in configuration:
+//
+//	msg[role=user]:last > txt        text chunks of the last user message
+//	call[name=~"^db_"]               tool calls whose name starts with db_
+//	def[name=search] schema          the schema of the "search" tool
+//	msg[role!=system], ext[ns=anthropic-messages]
+//
+// Element types:
+//
+//	msg      MSG_START…MSG_END          role, text
+//	txt      TXT_CHUNK                  text
+//	img/aud  IMG_REF/AUD_REF            media_type, ref
+//	txtref   TXT_REF                    ref
+//	think    THINK_START…THINK_END      text
+//	call     CALL_START…CALL_END        id, name, args
+//	result   RESULT_START…RESULT_END    id, text
+//	def      one tool definition        name, desc, schema
+//	name     DEF_NAME / CALL_NAME       text
+//	desc     DEF_DESC                   text
+//	schema   DEF_SCHEMA                 text
+//	args     CALL_ARGS                  text
+//	data     RESULT_DATA                text
+//	meta     SET_META                   key, value
+//	ext      EXT_DATA                   key, ns, value
+//	config   SET_* configuration        value
+//	*        any element
+//
+// Every element also matches its lower-case opcode mnemonic (txt_chunk,
+// set_model, stream_delta, …) and has an "op" attribute holding the
+// mnemonic (op=SET_MODEL).
+//
+// Attribute tests are [attr=value], [attr!=value], [attr=~regexp] and
+// [attr!~regexp]; [attr] tests presence. Values may be bare or
+// double-quoted. Pseudo-classes :first, :last and :nth(n) (1-based;
+// negative counts from the end) pick among the matches of a compound within
+// each parent. "a > b" selects b elements that are children of a; "a b"
+// selects descendants. Comma separates alternatives.
+
+// Match is an element selected by a Selector.
+type Match struct {
+	Type  string // element type, e.g. "msg", "call"
+	Start int    // first instruction index
+	End   int    // last instruction index (inclusive)
+}
+
+// Selector is a compiled selector expression.
+type Selector struct {
+	src  string
+	alts [][]selStep
+}
+
+type selStep struct {
+	child  bool   // ">" combinator (otherwise descendant)
+	typ    string // "" or "*" matches any
+	attrs  []selAttr
+	pseudo []selPseudo
+}
+
+type selAttr struct {
+	name string
+	op   string // "", "=", "!=", "=~", "!~"
+	val  string
+	re   *regexp.Regexp
+}
+
+type selPseudo struct {
+	kind string // "first", "last", "nth"
+	n    int
+}
+
+// CompileSelector parses a selector expression.
+func CompileSelector(src string) (*Selector, error) {
+	sp := &selParser{src: src}
+	alts, err := sp.parse()
+	if err != nil {
+		return nil, fmt.Errorf("ail: selector %q: %w", src, err)
+	}
+	return &Selector{src: src, alts: alts}, nil
+}
+
+// MustCompileSelector is like CompileSelector but panics on error.
+func MustCompileSelector(src string) *Selector {
+	s, err := CompileSelector(src)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// String returns the source expression.
+func (s *Selector) String() string { return s.src }
+
+// Select compiles selector and returns its matches in p.
+func (p *Program) Select(selector string) ([]Match, error) {
+	s, err := CompileSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	return s.Select(p), nil
+}
+
+// Select returns the elements of p matched by s, in instruction order and
+// without duplicates.
+func (s *Selector) Select(p *Program) []Match {
+	root := buildSelTree(p)
+	seen := map[*selElem]bool{}
+	var out []*selElem
+	for _, alt := range s.alts {
+		ctx := []*selElem{root}
+		for _, step := range alt {
+			var next []*selElem
+			inNext := map[*selElem]bool{}
+			for _, c := range ctx {
+				var cands []*selElem
+				if step.child {
+					cands = c.kids
+				} else {
+					cands = c.descendants(nil)
+				}
+				for _, e := range step.filter(cands) {
+					if !inNext[e] {
+						inNext[e] = true
+						next = append(next, e)
+					}
+				}
+			}
+			ctx = next
+		}
+		for _, e := range ctx {
+			if !seen[e] {
+				seen[e] = true
+				out = append(out, e)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].start != out[j].start {
+			return out[i].start < out[j].start
+		}
+		return out[i].end > out[j].end // outer element first
+	})
+	matches := make([]Match, len(out))
+	for i, e := range out {
+		matches[i] = Match{Type: e.typ, Start: e.start, End: e.end}
+	}
+	return matches
+}
+
+func (st selStep) filter(cands []*selElem) []*selElem {
+	var out []*selElem
+	for _, e := range cands {
+		if st.matches(e) {
+			out = append(out, e)
+		}
+	}
+	for _, ps := range st.pseudo {
+		if len(out) == 0 {
+			break
+		}
+		switch ps.kind {
+		case "first":
+			out = out[:1]
+		case "last":
+			out = out[len(out)-1:]
+		case "nth":
+			i := ps.n - 1
+			if ps.n < 0 {
+				i = len(out) + ps.n
+			}
+			if i < 0 || i >= len(out) {
+				return nil
+			}
+			out = out[i : i+1]
+		}
+	}
+	return out
+}
+
+func (st selStep) matches(e *selElem) bool {
+	if st.typ != "" && st.typ != "*" && st.typ != e.typ && st.typ != strings.ToLower(e.attrs["op"]) {
+		return false
+	}
+	for _, a := range st.attrs {
+		v, ok := e.attrs[a.name]
+		switch a.op {
+		case "":
+			if !ok {
+				return false
+			}
+		case "=":
+			if !ok || v != a.val {
+				return false
+			}
+		case "!=":
+			if ok && v == a.val {
+				return false
+			}
+		case "=~":
+			if !ok || !a.re.MatchString(v) {
+				return false
+			}
+		case "!~":
+			if ok && a.re.MatchString(v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ─── Element tree ────────────────────────────────────────────────────────────
+
+type selElem struct {
+	typ        string
+	start, end int
+	attrs      map[string]string
+	kids       []*selElem
+}
+
+func (e *selElem) descendants(out []*selElem) []*selElem {
+	for _, k := range e.kids {
+		out = append(out, k)
+		out = k.descendants(out)
+	}
+	return out
+}
+
+var selRoleNames = map[Opcode]string{
+	ROLE_SYS: "system", ROLE_USR: "user", ROLE_AST: "assistant", ROLE_TOOL: "tool",
+}
+
+// selLeaf returns the element for a single instruction.
+func selLeaf(p *Program, i int) *selElem {
+	inst := p.Code[i]
+	e := &selElem{start: i, end: i, attrs: map[string]string{"op": inst.Op.Name()}}
+	e.typ = strings.ToLower(inst.Op.Name())
+	switch inst.Op {
+	case TXT_CHUNK:
+		e.typ, e.attrs["text"] = "txt", inst.Str
+	case IMG_REF, AUD_REF, TXT_REF:
+		e.typ = map[Opcode]string{IMG_REF: "img", AUD_REF: "aud", TXT_REF: "txtref"}[inst.Op]
+		e.attrs["ref"] = strconv.Itoa(int(inst.Ref))
+		if i > 0 && p.Code[i-1].Op == SET_META && p.Code[i-1].Key == "media_type" {
+			e.attrs["media_type"] = p.Code[i-1].Str
+		}
+	case DEF_NAME, CALL_NAME:
+		e.typ, e.attrs["text"] = "name", inst.Str
+	case DEF_DESC:
+		e.typ, e.attrs["text"] = "desc", inst.Str
+	case DEF_SCHEMA:
+		e.typ, e.attrs["text"] = "schema", string(inst.JSON)
+	case CALL_ARGS:
+		e.typ, e.attrs["text"] = "args", string(inst.JSON)
+	case RESULT_DATA:
+		e.typ, e.attrs["text"] = "data", inst.Str
+	case SET_META:
+		e.typ, e.attrs["key"], e.attrs["value"] = "meta", inst.Key, inst.Str
+	case EXT_DATA:
+		e.typ, e.attrs["key"], e.attrs["value"] = "ext", inst.Key, string(inst.JSON)
+		if inst.NS != "" {
+			e.attrs["ns"] = string(inst.NS)
+		}
+	case SET_MODEL, SET_STOP:
+		e.typ, e.attrs["value"] = "config", inst.Str
+	case SET_TEMP, SET_TOPP:
+		e.typ, e.attrs["value"] = "config", strconv.FormatFloat(inst.Num, 'g', -1, 64)
+	case SET_MAX:
+		e.typ, e.attrs["value"] = "config", strconv.Itoa(int(inst.Int))
+	case SET_STREAM:
+		e.typ, e.attrs["value"] = "config", "true"
+	case SET_THINK, SET_FMT:
+		e.typ, e.attrs["value"] = "config", string(inst.JSON)
+	default:
+		if stringArgOps[inst.Op] {
+			e.attrs["text"] = inst.Str
+		} else if jsonArgOps[inst.Op] {
+			e.attrs["text"] = string(inst.JSON)
+		}
+	}
+	return e
+}
+
+// buildSelTree builds the element tree of p under a synthetic root.
+func buildSelTree(p *Program) *selElem {
+	root := &selElem{typ: "#root", start: 0, end: len(p.Code) - 1, attrs: map[string]string{}}
+	for i := 0; i < len(p.Code); i++ {
+		switch p.Code[i].Op {
+		case MSG_START:
+			end := blockEnd(p, i, MSG_START, MSG_END)
+			root.kids = append(root.kids, selMessage(p, i, end))
+			i = end
+		case DEF_START:
+			end := blockEnd(p, i, DEF_START, DEF_END)
+			root.kids = append(root.kids, selDefs(p, i)...)
+			i = end
+		default:
+			root.kids = append(root.kids, selLeaf(p, i))
+		}
+	}
+	return root
+}
+
+func selMessage(p *Program, start, end int) *selElem {
+	msg := &selElem{typ: "msg", start: start, end: end, attrs: map[string]string{"op": "MSG_START"}}
+	var text strings.Builder
+	for j := start + 1; j < end; j++ {
+		inst := p.Code[j]
+		switch inst.Op {
+		case ROLE_SYS, ROLE_USR, ROLE_AST, ROLE_TOOL:
+			msg.attrs["role"] = selRoleNames[inst.Op]
+		case THINK_START:
+			e := blockEnd(p, j, THINK_START, THINK_END)
+			think := &selElem{typ: "think", start: j, end: e, attrs: map[string]string{"op": "THINK_START"}}
+			var tt strings.Builder
+			for k := j + 1; k < e; k++ {
+				if p.Code[k].Op == THINK_CHUNK {
+					tt.WriteString(p.Code[k].Str)
+				}
+			}
+			think.attrs["text"] = tt.String()
+			msg.kids = append(msg.kids, think)
+			j = e
+		case CALL_START:
+			e := blockEnd(p, j, CALL_START, CALL_END)
+			call := &selElem{typ: "call", start: j, end: e, attrs: map[string]string{"op": "CALL_START", "id": inst.Str}}
+			for k := j + 1; k < e; k++ {
+				kid := selLeaf(p, k)
+				switch p.Code[k].Op {
+				case CALL_NAME:
+					call.attrs["name"] = p.Code[k].Str
+				case CALL_ARGS:
+					call.attrs["args"] = string(p.Code[k].JSON)
+				}
+				call.kids = append(call.kids, kid)
+			}
+			msg.kids = append(msg.kids, call)
+			j = e
+		case RESULT_START:
+			e := blockEnd(p, j, RESULT_START, RESULT_END)
+			res := &selElem{typ: "result", start: j, end: e, attrs: map[string]string{"op": "RESULT_START", "id": inst.Str}}
+			var rt strings.Builder
+			for k := j + 1; k < e; k++ {
+				if p.Code[k].Op == RESULT_DATA {
+					rt.WriteString(p.Code[k].Str)
+				}
+				res.kids = append(res.kids, selLeaf(p, k))
+			}
+			res.attrs["text"] = rt.String()
+			msg.kids = append(msg.kids, res)
+			j = e
+		default:
+			if inst.Op == TXT_CHUNK {
+				text.WriteString(inst.Str)
+			}
+			msg.kids = append(msg.kids, selLeaf(p, j))
+		}
+	}
+	msg.attrs["text"] = text.String()
+	return msg
+}
+
+// selDefs returns one def element per tool in the DEF block at start.
+func selDefs(p *Program, start int) []*selElem {
+	var defs []*selElem
+	for _, d := range p.ToolDefs() {
+		if d.BlockStart != start {
+			continue
+		}
+		def := &selElem{typ: "def", start: d.Start, end: d.End, attrs: map[string]string{"op": "DEF_START", "name": d.Name}}
+		for j := d.Start; j <= d.End; j++ {
+			switch p.Code[j].Op {
+			case DEF_START, DEF_END:
+				continue
+			case DEF_DESC:
+				def.attrs["desc"] = p.Code[j].Str
+			case DEF_SCHEMA:
+				def.attrs["schema"] = string(p.Code[j].JSON)
+			}
+			def.kids = append(def.kids, selLeaf(p, j))
+		}
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+// ─── Parser ──────────────────────────────────────────────────────────────────
+
+type selParser struct {
+	src string
+	pos int
+}
+
+func (sp *selParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at %d: %s", sp.pos, fmt.Sprintf(format, args...))
+}
+
+func (sp *selParser) peek() byte {
+	if sp.pos < len(sp.src) {
+		return sp.src[sp.pos]
+	}
+	return 0
+}
+
+// skipSpace skips whitespace and reports whether any was skipped.
+func (sp *selParser) skipSpace() bool {
+	start := sp.pos
+	for sp.pos < len(sp.src) && unicode.IsSpace(rune(sp.src[sp.pos])) {
+		sp.pos++
+	}
+	return sp.pos > start
+}
+
+func isSelIdent(c byte) bool {
+	return c == '_' || c == '-' || c == '*' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (sp *selParser) ident() string {
+	start := sp.pos
+	for sp.pos < len(sp.src) && isSelIdent(sp.src[sp.pos]) {
+		sp.pos++
+	}
+	return sp.src[start:sp.pos]
+}
+
+func (sp *selParser) parse() ([][]selStep, error) {
+	var alts [][]selStep
+	for {
+		sp.skipSpace()
+		var steps []selStep
+		child := false
+		for {
+			step, err := sp.compound()
+			if err != nil {
+				return nil, err
+			}
+			step.child = child
+			steps = append(steps, step)
+
+			spaced := sp.skipSpace()
+			switch c := sp.peek(); {
+			case c == '>':
+				sp.pos++
+				sp.skipSpace()
+				child = true
+				continue
+			case c == ',' || c == 0:
+			case spaced:
+				child = false
+				continue
+			default:
+				return nil, sp.errorf("unexpected %q", c)
+			}
+			break
+		}
+		alts = append(alts, steps)
+		if sp.peek() == 0 {
+			return alts, nil
+		}
+		sp.pos++ // ','
+	}
+}
+
+func (sp *selParser) compound() (selStep, error) {
+	var st selStep
+	st.typ = strings.ToLower(sp.ident())
+	for {
+		switch sp.peek() {
+		case '[':
+			sp.pos++
+			a, err := sp.attr()
+			if err != nil {
+				return st, err
+			}
+			st.attrs = append(st.attrs, a)
+		case ':':
+			sp.pos++
+			ps, err := sp.pseudo()
+			if err != nil {
+				return st, err
+			}
+			st.pseudo = append(st.pseudo, ps)
+		default:
+			if st.typ == "" && len(st.attrs) == 0 && len(st.pseudo) == 0 {
+				return st, sp.errorf("expected element type, attribute or pseudo-class")
+			}
+			return st, nil
+		}
+	}
+}
+
+func (sp *selParser) attr() (selAttr, error) {
+	sp.skipSpace()
+	a := selAttr{name: sp.ident()}
+	if a.name == "" {
+		return a, sp.errorf("expected attribute name")
+	}
+	sp.skipSpace()
+	rest := sp.src[sp.pos:]
+	for _, op := range []string{"=~", "!~", "!=", "="} {
+		if strings.HasPrefix(rest, op) {
+			a.op = op
+			sp.pos += len(op)
+			break
+		}
+	}
+	if a.op != "" {
+		sp.skipSpace()
+		v, err := sp.value()
+		if err != nil {
+			return a, err
+		}
+		a.val = v
+		if a.op == "=~" || a.op == "!~" {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return a, sp.errorf("bad regexp: %v", err)
+			}
+			a.re = re
+		}
+		sp.skipSpace()
+	}
+	if sp.peek() != ']' {
+		return a, sp.errorf("expected ']'")
+	}
+	sp.pos++
+	return a, nil
+}
+
+func (sp *selParser) value() (string, error) {
+	if sp.peek() == '"' {
+		end := sp.pos + 1
+		for end < len(sp.src) && sp.src[end] != '"' {
+			if sp.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(sp.src) {
+			return "", sp.errorf("unterminated string")
+		}
+		v, err := strconv.Unquote(sp.src[sp.pos : end+1])
+		if err != nil {
+			return "", sp.errorf("bad string: %v", err)
+		}
+		sp.pos = end + 1
+		return v, nil
+	}
+	start := sp.pos
+	for sp.pos < len(sp.src) && sp.src[sp.pos] != ']' && !unicode.IsSpace(rune(sp.src[sp.pos])) {
+		sp.pos++
+	}
+	return sp.src[start:sp.pos], nil
+}
+
+func (sp *selParser) pseudo() (selPseudo, error) {
+	name := sp.ident()
+	switch name {
+	case "first", "last":
+		return selPseudo{kind: name}, nil
+	case "nth":
+		if sp.peek() != '(' {
+			return selPseudo{}, sp.errorf("expected '(' after :nth")
+		}
+		sp.pos++
+		end := strings.IndexByte(sp.src[sp.pos:], ')')
+		if end < 0 {
+			return selPseudo{}, sp.errorf("unterminated :nth(")
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(sp.src[sp.pos : sp.pos+end]))
+		if err != nil || n == 0 {
+			return selPseudo{}, sp.errorf("bad :nth index %q", sp.src[sp.pos:sp.pos+end])
+		}
+		sp.pos += end + 1
+		return selPseudo{kind: "nth", n: n}, nil
+	}
+	return selPseudo{}, sp.errorf("unknown pseudo-class :%s", name)
+}
@@ -0,0 +1,106 @@
+package ail
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func selectorProgram() *Program {
+	return Build().
+		Model("gpt-4o").
+		Tools(
+			Func("search", "Search the web", json.RawMessage(`{"type":"object"}`)),
+			Func("db_query", "Query the DB", nil),
+		).
+		System("sys").
+		User(Text("first question")).
+		Assistant(
+			ToolCall("c1", "db_query", map[string]string{"sql": "select 1"}),
+			ToolCall("c2", "search", map[string]string{"q": "go"}),
+		).
+		Tool(Result("c1", "1"), Result("c2", "results")).
+		User(Text("second "), Text("question"), Image([]byte("png"), "image/png")).
+		MustProgram()
+}
+
+func selectOps(t *testing.T, p *Program, sel string) []Match {
+	t.Helper()
+	m, err := p.Select(sel)
+	if err != nil {
+		t.Fatalf("Select(%q): %v", sel, err)
+	}
+	return m
+}
+
+func TestSelectLastUserText(t *testing.T) {
+	p := selectorProgram()
+	m := selectOps(t, p, "msg[role=user]:last > txt")
+	if len(m) != 2 || p.Code[m[0].Start].Str != "second " || p.Code[m[1].Start].Str != "question" {
+		t.Fatalf("matches = %+v", m)
+	}
+	if m[0].Type != "txt" || m[0].Start != m[0].End {
+		t.Errorf("match = %+v", m[0])
+	}
+}
+
+func TestSelectCallsByRegexp(t *testing.T) {
+	p := selectorProgram()
+	m := selectOps(t, p, `call[name=~"^db_"]`)
+	if len(m) != 1 || p.Code[m[0].Start].Op != CALL_START || p.Code[m[0].Start].Str != "c1" || p.Code[m[0].End].Op != CALL_END {
+		t.Fatalf("matches = %+v", m)
+	}
+	if m := selectOps(t, p, `call[name!~"^db_"] args`); len(m) != 1 || p.Code[m[0].Start].Op != CALL_ARGS {
+		t.Errorf("negated matches = %+v", m)
+	}
+}
+
+func TestSelectToolSchema(t *testing.T) {
+	p := selectorProgram()
+	m := selectOps(t, p, "def[name=search] schema")
+	if len(m) != 1 || p.Code[m[0].Start].Op != DEF_SCHEMA || string(p.Code[m[0].Start].JSON) != `{"type":"object"}` {
+		t.Fatalf("matches = %+v", m)
+	}
+	if m := selectOps(t, p, "def"); len(m) != 2 || p.Code[m[1].Start+1].Str != "db_query" {
+		t.Errorf("defs = %+v", m)
+	}
+}
+
+func TestSelectPseudoAndAlternatives(t *testing.T) {
+	p := selectorProgram()
+	if m := selectOps(t, p, "msg:first"); len(m) != 1 || p.Code[m[0].Start+1].Op != ROLE_SYS {
+		t.Errorf(":first = %+v", m)
+	}
+	if m := selectOps(t, p, "msg:nth(-2)"); len(m) != 1 || p.Code[m[0].Start+1].Op != ROLE_TOOL {
+		t.Errorf(":nth(-2) = %+v", m)
+	}
+	if m := selectOps(t, p, "msg:nth(9)"); len(m) != 0 {
+		t.Errorf(":nth out of range = %+v", m)
+	}
+	// Pseudo-classes apply per parent: the first result of each message.
+	if m := selectOps(t, p, "msg result:first"); len(m) != 1 || p.Code[m[0].Start].Str != "c1" {
+		t.Errorf("result:first = %+v", m)
+	}
+	m := selectOps(t, p, "img[media_type=image/png], config[op=SET_MODEL], set_model")
+	if len(m) != 2 || m[0].Type != "config" || m[1].Type != "img" {
+		t.Errorf("alternatives = %+v", m)
+	}
+	if m := selectOps(t, p, `msg[role!=system][text=~"question$"]`); len(m) != 2 {
+		t.Errorf("compound attrs = %+v", m)
+	}
+}
+
+func TestSelectorErrors(t *testing.T) {
+	for _, sel := range []string{
+		"",
+		"msg[role=user",
+		`call[name=~"("]`,
+		"msg:bogus",
+		"msg:nth(0)",
+		"msg >",
+		`msg[text="open]`,
+	} {
+		if _, err := CompileSelector(sel); err == nil {
+			t.Errorf("CompileSelector(%q): expected error", sel)
+		}
+	}
+}
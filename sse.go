@@ -0,0 +1,244 @@
+package ail
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ─── Server-Sent Events ──────────────────────────────────────────────────────
+
+// SSEEvent is one dispatched Server-Sent Event.
+type SSEEvent struct {
+	Event string // "event:" field; empty for the default "message" type
+	ID    string // "id:" field
+	Data  []byte // "data:" lines joined with "\n"
+}
+
+// SSEReader parses a text/event-stream. It follows the WHATWG rules: lines
+// end in LF, CRLF or CR; lines starting with ":" are comments; a single
+// space after the field colon is dropped; multiple "data:" lines are joined
+// with "\n"; a blank line dispatches the event; events without data are not
+// dispatched.
+type SSEReader struct {
+	r       *bufio.Reader
+	pending bool // previous line ended in a bare CR
+}
+
+// NewSSEReader creates a reader over an event stream.
+func NewSSEReader(r io.Reader) *SSEReader {
+	return &SSEReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next event, or io.EOF when the stream ends. An event
+// still being built when the stream ends without a blank line is
+// dispatched.
+func (s *SSEReader) Next() (SSEEvent, error) {
+	var ev SSEEvent
+	var data bytes.Buffer
+	hasData := false
+	for {
+		line, err := s.readLine()
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF && hasData {
+				ev.Data = data.Bytes()
+				return ev, nil
+			}
+			return SSEEvent{}, err
+		}
+		if line == "" {
+			if hasData {
+				ev.Data = data.Bytes()
+				return ev, nil
+			}
+			ev = SSEEvent{}
+			continue
+		}
+		if line[0] == ':' {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "event":
+			ev.Event = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				ev.ID = value
+			}
+		}
+		if err == io.EOF {
+			continue // dispatch on the next iteration
+		}
+	}
+}
+
+// readLine reads one line without its terminator.
+func (s *SSEReader) readLine() (string, error) {
+	var b strings.Builder
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return b.String(), err
+		}
+		if s.pending {
+			s.pending = false
+			if c == '\n' {
+				continue // LF of a CRLF pair
+			}
+		}
+		switch c {
+		case '\n':
+			return b.String(), nil
+		case '\r':
+			s.pending = true
+			return b.String(), nil
+		}
+		b.WriteByte(c)
+	}
+}
+
+// SSEWriter writes Server-Sent Events. If the underlying writer has a
+// Flush method (http.Flusher or bufio.Writer) it is called after every
+// event.
+type SSEWriter struct {
+	w io.Writer
+}
+
+// NewSSEWriter creates an event-stream writer.
+func NewSSEWriter(w io.Writer) *SSEWriter {
+	return &SSEWriter{w: w}
+}
+
+// WriteEvent writes ev followed by a blank line. Data containing newlines
+// is split over several "data:" lines.
+func (s *SSEWriter) WriteEvent(ev SSEEvent) error {
+	var b bytes.Buffer
+	if ev.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", ev.Event)
+	}
+	if ev.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", ev.ID)
+	}
+	for _, line := range bytes.Split(ev.Data, []byte("\n")) {
+		b.WriteString("data: ")
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	if _, err := s.w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// WriteComment writes a comment line (useful as a keep-alive).
+func (s *SSEWriter) WriteComment(text string) error {
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *SSEWriter) flush() error {
+	switch f := s.w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return nil
+}
+
+// ─── Chunk readers ───────────────────────────────────────────────────────────
+
+// sseDone is the OpenAI end-of-stream sentinel.
+const sseDone = "[DONE]"
+
+// ChunkReader yields the JSON payloads of a provider stream one at a time.
+type ChunkReader interface {
+	// ReadChunk returns the next payload, or io.EOF at the end of the
+	// stream (including after an OpenAI "[DONE]" sentinel).
+	ReadChunk() ([]byte, error)
+}
+
+// NewChunkReader detects the framing of r and returns a reader for it:
+// a JSON array of chunks (Google GenAI without alt=sse) if the first
+// non-space byte is "[", otherwise Server-Sent Events.
+func NewChunkReader(r io.Reader) ChunkReader {
+	br := bufio.NewReader(r)
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			break
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			continue
+		}
+		br.UnreadByte()
+		if c == '[' {
+			return &jsonArrayChunkReader{dec: json.NewDecoder(br)}
+		}
+		break
+	}
+	return &sseChunkReader{r: NewSSEReader(br)}
+}
+
+type sseChunkReader struct {
+	r    *SSEReader
+	done bool
+}
+
+func (c *sseChunkReader) ReadChunk() ([]byte, error) {
+	for !c.done {
+		ev, err := c.r.Next()
+		if err != nil {
+			return nil, err
+		}
+		data := bytes.TrimSpace(ev.Data)
+		if string(data) == sseDone {
+			c.done = true
+			break
+		}
+		if len(data) == 0 {
+			continue
+		}
+		return data, nil
+	}
+	return nil, io.EOF
+}
+
+type jsonArrayChunkReader struct {
+	dec     *json.Decoder
+	started bool
+}
+
+func (c *jsonArrayChunkReader) ReadChunk() ([]byte, error) {
+	if !c.started {
+		if _, err := c.dec.Token(); err != nil { // "["
+			return nil, err
+		}
+		c.started = true
+	}
+	if !c.dec.More() {
+		return nil, io.EOF
+	}
+	var raw json.RawMessage
+	if err := c.dec.Decode(&raw); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return raw, nil
+}
@@ -0,0 +1,421 @@
+package ail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSSEReader(t *testing.T) {
+	stream := ": keep-alive\r\n" +
+		"event: first\r\nid: 7\r\ndata: line1\r\ndata:line2\r\n\r\n" +
+		"event: ignored\n\n" + // no data: not dispatched
+		"data: {\"a\":1}\r" + "\r" + // bare CR line endings
+		"data: tail" // unterminated final event
+	r := NewSSEReader(strings.NewReader(stream))
+
+	want := []SSEEvent{
+		{Event: "first", ID: "7", Data: []byte("line1\nline2")},
+		{Data: []byte(`{"a":1}`)},
+		{Data: []byte("tail")},
+	}
+	for i, w := range want {
+		ev, err := r.Next()
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if ev.Event != w.Event || ev.ID != w.ID || string(ev.Data) != string(w.Data) {
+			t.Errorf("event %d = %+v (%q), want %+v (%q)", i, ev, ev.Data, w, w.Data)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestSSEWriter(t *testing.T) {
+	var b bytes.Buffer
+	w := NewSSEWriter(&b)
+	w.WriteEvent(SSEEvent{Event: "message_stop", Data: []byte("a\nb")})
+	w.WriteComment("ping")
+	if got, want := b.String(), "event: message_stop\ndata: a\ndata: b\n\n: ping\n\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestChunkReaderJSONArray(t *testing.T) {
+	r := NewChunkReader(strings.NewReader("  [{\"a\":1},\r\n{\"b\":[2]}\n]"))
+	var got []string
+	for {
+		c, err := r.ReadChunk()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(c))
+	}
+	if strings.Join(got, " ") != `{"a":1} {"b":[2]}` {
+		t.Errorf("chunks = %v", got)
+	}
+}
+
+func TestStreamPipeAnthropicToChat(t *testing.T) {
+	in := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude"}}` + "\n\n" +
+		"event: ping\ndata: {\"type\":\"ping\"}\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":1}}` + "\n\n" +
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+
+	pipe, err := NewStreamPipe(StyleAnthropic, StyleChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := pipe.Run(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+	if strings.Contains(text, "event:") || !strings.HasSuffix(text, "data: [DONE]\n\n") {
+		t.Errorf("bad chat framing:\n%s", text)
+	}
+	if !strings.Contains(text, `"content":"Hi"`) || !strings.Contains(text, `"finish_reason":"stop"`) {
+		t.Errorf("missing content:\n%s", text)
+	}
+}
+
+func TestStreamPipeChatToAnthropic(t *testing.T) {
+	in := `data: {"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant"}}]}` + "\n\n" +
+		`data: {"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hi"}}]}` + "\n\n" +
+		`data: {"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n" +
+		"data: [DONE]\n\n" +
+		`data: {"id":"ignored after DONE"}` + "\n\n"
+
+	pipe, err := NewStreamPipe(StyleChatCompletions, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := pipe.Run(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewSSEReader(&out)
+	var names []string
+	for {
+		ev, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct{ Type string }
+		json.Unmarshal(ev.Data, &body)
+		if ev.Event != body.Type {
+			t.Errorf("event name %q does not match type %q", ev.Event, body.Type)
+		}
+		names = append(names, ev.Event)
+	}
+	if got := strings.Join(names, " "); got != "message_start content_block_start content_block_delta content_block_stop message_delta message_stop" {
+		t.Errorf("events = %s", got)
+	}
+}
+
+func TestStreamPipeGeminiArray(t *testing.T) {
+	in := `[{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"modelVersion":"gemini"},
+{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":"STOP"}]}]`
+
+	pipe, err := NewStreamPipe(StyleGoogleGenAI, StyleGoogleGenAI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipe.JSONArray = true
+	var out bytes.Buffer
+	if err := pipe.Run(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	var chunks []json.RawMessage
+	if err := json.Unmarshal(out.Bytes(), &chunks); err != nil || len(chunks) < 2 {
+		t.Fatalf("output is not a JSON array of chunks: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(string(chunks[0]), `"Hel"`) || !strings.Contains(string(chunks[1]), `"lo"`) {
+		t.Errorf("chunks = %s", out.String())
+	}
+}
+
+// deadlineCtx is a context whose deadline the test triggers by hand.
+type deadlineCtx struct {
+	context.Context
+	done chan struct{}
+}
+
+func (c deadlineCtx) Done() <-chan struct{} { return c.done }
+
+func (c deadlineCtx) Err() error {
+	select {
+	case <-c.done:
+		return context.DeadlineExceeded
+	default:
+		return nil
+	}
+}
+
+// notifyBuffer is a concurrency-safe output that signals every write.
+type notifyBuffer struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	wrote chan struct{}
+}
+
+func (b *notifyBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, err := b.buf.Write(p)
+	select {
+	case b.wrote <- struct{}{}:
+	default:
+	}
+	return n, err
+}
+
+func (b *notifyBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor blocks until the output contains s.
+func (b *notifyBuffer) waitFor(s string) {
+	for !strings.Contains(b.String(), s) {
+		<-b.wrote
+	}
+}
+
+// pipeUpstream returns a reader that yields chunks and then blocks, like
+// an upstream that stalls mid-stream.
+func pipeUpstream(chunks ...string) io.Reader {
+	r, w := io.Pipe()
+	go func() {
+		for _, c := range chunks {
+			if _, err := io.WriteString(w, "data: "+c+"\n\n"); err != nil {
+				return
+			}
+		}
+	}()
+	return r
+}
+
+func TestStreamPipeRunContextDeadline(t *testing.T) {
+	pipe, err := NewStreamPipe(StyleChatCompletions, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := pipeUpstream(
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+	)
+	ctx := deadlineCtx{context.Background(), make(chan struct{})}
+	out := &notifyBuffer{wrote: make(chan struct{}, 1)}
+	go func() {
+		out.waitFor("text_delta")
+		close(ctx.done)
+	}()
+
+	progress, err := pipe.RunContext(ctx, upstream, out)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if progress.ChunksIn != 2 || progress.Completed || progress.Finish != FinishInterrupted {
+		t.Errorf("progress = %+v", progress)
+	}
+
+	r := NewSSEReader(strings.NewReader(out.String()))
+	var names []string
+	for {
+		ev, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, ev.Event)
+		if ev.Event == "message_delta" && !strings.Contains(string(ev.Data), `"stop_reason":"max_tokens"`) {
+			t.Errorf("message_delta = %s", ev.Data)
+		}
+	}
+	if got := strings.Join(names, " "); got != "message_start content_block_start content_block_delta content_block_stop message_delta message_stop" {
+		t.Errorf("events = %s", got)
+	}
+	if progress.ChunksOut != len(names) {
+		t.Errorf("ChunksOut = %d, want %d", progress.ChunksOut, len(names))
+	}
+}
+
+func TestStreamPipeRunContextReachesPasses(t *testing.T) {
+	// Stream passes see the caller's context, including when buffered
+	// calls are delivered after the deadline.
+	type ctxKey struct{}
+	pipe, err := NewStreamPipe(StyleChatCompletions, StyleGoogleGenAI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := deadlineCtx{context.WithValue(context.Background(), ctxKey{}, "req-1"), make(chan struct{})}
+	var seen []string
+	pipe.Converter().SetPipeline(NewPipeline(PassFunc("ctx", KindStreamChunk, func(pctx context.Context, _ ProgramKind, p *Program) (*Program, error) {
+		v, _ := pctx.Value(ctxKey{}).(string)
+		seen = append(seen, v)
+		if len(seen) == 1 {
+			close(ctx.done) // the deadline passes once the call is buffered
+		}
+		return p, nil
+	})))
+	upstream := pipeUpstream(
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}}]}}]}`,
+	)
+	var out bytes.Buffer
+	if _, err := pipe.RunContext(ctx, upstream, &out); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if len(seen) < 2 || slices.ContainsFunc(seen, func(v string) bool { return v != "req-1" }) {
+		t.Errorf("context values seen by the pass: %q", seen)
+	}
+	if !strings.Contains(out.String(), `"functionCall"`) {
+		t.Errorf("buffered call not delivered:\n%s", out.String())
+	}
+}
+
+func TestStreamPipeRunContextCancel(t *testing.T) {
+	pipe, err := NewStreamPipe(StyleAnthropic, StyleChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := pipeUpstream(
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":12}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &notifyBuffer{wrote: make(chan struct{}, 1)}
+	go func() {
+		out.waitFor(`"Hi"`)
+		cancel()
+	}()
+
+	progress, err := pipe.RunContext(ctx, upstream, out)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want canceled", err)
+	}
+	if progress.ChunksIn != 2 || progress.Finish != "" || progress.Usage.PromptTokens != 12 {
+		t.Errorf("progress = %+v", progress)
+	}
+	if text := out.String(); strings.Contains(text, "finish_reason\":\"") || strings.Contains(text, "[DONE]") {
+		t.Errorf("wrote after cancellation:\n%s", text)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("client gone") }
+
+func TestStreamPipeRunWriteErrorStopsReader(t *testing.T) {
+	pipe, err := NewStreamPipe(StyleAnthropic, StyleChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := runtime.NumGoroutine()
+	upstream := pipeUpstream(
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+	)
+	if err := pipe.Run(upstream, failingWriter{}); err == nil {
+		t.Fatal("expected write error")
+	}
+	// The reader goroutine and the upstream writer both exit once the pipe
+	// closes the upstream.
+	for deadline := time.Now().Add(2 * time.Second); runtime.NumGoroutine() > before; {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines: %d before, %d after Run returned", before, runtime.NumGoroutine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := upstream.Read(make([]byte, 1)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("upstream not closed: read err = %v", err)
+	}
+}
+
+func TestStreamConverterInterrupt(t *testing.T) {
+	// Buffered Gemini tool calls are delivered before the interrupted finish.
+	conv, err := NewStreamConverter(StyleChatCompletions, StyleGoogleGenAI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conv.Push([]byte(`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":"}}]}}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	outs, err := conv.Interrupt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := string(bytes.Join(outs, []byte("\n")))
+	call, finish := strings.Index(all, `"functionCall"`), strings.Index(all, `"finishReason":"MAX_TOKENS"`)
+	if call < 0 || finish < call {
+		t.Errorf("Interrupt outputs:\n%s", all)
+	}
+
+	// A stream that already finished is not finished again.
+	conv, _ = NewStreamConverter(StyleChatCompletions, StyleChatCompletions)
+	conv.Push([]byte(`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`))
+	if outs, err := conv.Interrupt(); err != nil || strings.Contains(string(bytes.Join(outs, nil)), "finish_reason") {
+		t.Errorf("Interrupt after finish = %s, %v", bytes.Join(outs, nil), err)
+	}
+}
+
+func TestStreamConverterInterruptPipesBufferedCalls(t *testing.T) {
+	// A call that arrives after the finish is still buffered when Interrupt
+	// runs; like Flush, Interrupt sends it through the pipeline.
+	var calls int
+	conv, err := NewStreamConverter(StyleChatCompletions, StyleGoogleGenAI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.SetPipeline(NewPipeline(PassFunc("count", KindStreamChunk, func(_ context.Context, _ ProgramKind, p *Program) (*Program, error) {
+		for _, inst := range p.Code {
+			if inst.Op == STREAM_TOOL_DELTA {
+				calls++
+			}
+		}
+		return p, nil
+	})))
+	for _, chunk := range []string{
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}}]}`,
+	} {
+		if _, err := conv.Push([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outs, err := conv.Interrupt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outs) != 1 || !strings.Contains(string(outs[0]), `"functionCall"`) {
+		t.Errorf("Interrupt outputs: %s", bytes.Join(outs, []byte("\n")))
+	}
+	// Once for the fragment, once for the assembled call.
+	if calls != 2 {
+		t.Errorf("pipeline saw %d tool deltas, want 2", calls)
+	}
+}
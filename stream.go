@@ -1,8 +1,10 @@
 package ail
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 )
@@ -21,6 +23,9 @@ import (
 //     every event while others (Anthropic) send it only once.
 //   - One source event may produce multiple output events (e.g., an OpenAI
 //     finish chunk becomes Anthropic's message_delta + message_stop).
+//   - Usage is accumulated across chunks, so every emitted usage object
+//     carries the totals so far (Anthropic reports input tokens in
+//     message_start and output tokens in message_delta).
 //
 // Usage in an HTTP streaming proxy:
 //
@@ -45,14 +50,34 @@ type StreamConverter struct {
 	sourceStyle Style
 	targetStyle Style
 
-	mu        sync.Mutex
-	respID    string
-	respModel string
+	mu          sync.Mutex
+	respID      string
+	respModel   string
+	calledTools bool         // a tool delta has been seen
+	usage       Usage        // usage reported so far
+	finish      FinishReason // last RESP_DONE seen
+	ended       bool         // STREAM_END seen
+
+	// IDs for tool calls that arrive without one (see trackToolIDs).
+	toolIDs   ToolIDFunc
+	toolCalls int         // calls numbered so far
+	toolIndex map[int]int // source index → stream-wide index
+
+	// Optional passes applied to every parsed chunk (see SetPipeline).
+	pipeline *Pipeline
+
+	// Content-block lifecycle for Anthropic targets (nil otherwise).
+	blocks *blockTracker
 
 	// Tool call buffering for targets needing complete function calls.
 	bufferTools  bool
 	pendingTools map[int]*pendingToolCall
 	toolOrder    []int
+
+	// Event numbering and replay (see ReplayFrom).
+	seq         uint64   // ID of the last emitted event
+	replayLimit int      // events kept for replay
+	history     [][]byte // the last emitted events; the final one has ID seq
 }
 
 // pendingToolCall accumulates tool-call fragments for buffered emission.
@@ -78,14 +103,37 @@ func NewStreamConverter(from, to Style) (*StreamConverter, error) {
 	// so buffer tool deltas until the call is ready.
 	bufferTools := (to == StyleGoogleGenAI)
 
-	return &StreamConverter{
+	c := &StreamConverter{
 		parser:       parser,
 		emitter:      emitter,
 		sourceStyle:  from,
 		targetStyle:  to,
 		bufferTools:  bufferTools,
 		pendingTools: make(map[int]*pendingToolCall),
-	}, nil
+		toolIDs:      DefaultToolIDs(to),
+		toolIndex:    make(map[int]int),
+	}
+	if to == StyleAnthropic {
+		c.blocks = newBlockTracker()
+	}
+	return c, nil
+}
+
+// SetPipeline installs a pipeline whose stream-safe passes (those that apply
+// to KindStreamChunk) run on every chunk after parsing and before emission.
+// A pass that returns a nil program drops the chunk. Pass nil to remove it.
+func (c *StreamConverter) SetPipeline(pl *Pipeline) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pipeline = pl
+}
+
+// SetToolIDs replaces the function naming tool calls that arrive without
+// an ID (Google GenAI sources). It is not part of a Snapshot.
+func (c *StreamConverter) SetToolIDs(fn ToolIDFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.toolIDs = fn
 }
 
 // Push processes a source streaming chunk and returns zero or more converted
@@ -95,6 +143,11 @@ func NewStreamConverter(from, to Style) (*StreamConverter, error) {
 // Returns zero chunks when the source event is purely structural or buffered.
 // Returns multiple chunks when a source event expands into several target events.
 func (c *StreamConverter) Push(sourceChunk []byte) ([][]byte, error) {
+	return c.PushContext(context.Background(), sourceChunk)
+}
+
+// PushContext is Push with ctx passed to the pipeline's passes.
+func (c *StreamConverter) PushContext(ctx context.Context, sourceChunk []byte) ([][]byte, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -103,7 +156,7 @@ func (c *StreamConverter) Push(sourceChunk []byte) ([][]byte, error) {
 		return nil, fmt.Errorf("ail: stream convert parse: %w", err)
 	}
 
-	return c.pushProgramLocked(parsed)
+	return c.pushProgramLocked(ctx, parsed)
 }
 
 // PushProgram processes an already-parsed AIL program through the converter.
@@ -115,30 +168,59 @@ func (c *StreamConverter) PushProgram(prog *Program) ([][]byte, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	return c.pushProgramLocked(prog)
+	return c.pushProgramLocked(context.Background(), prog)
 }
 
 // pushProgramLocked is the shared core of Push and PushProgram.
 // Caller must hold c.mu.
-func (c *StreamConverter) pushProgramLocked(parsed *Program) ([][]byte, error) {
+func (c *StreamConverter) pushProgramLocked(ctx context.Context, parsed *Program) ([][]byte, error) {
 	if parsed == nil || parsed.Len() == 0 {
 		return nil, nil
 	}
 
+	parsed, err := c.applyPipeline(ctx, parsed)
+	if err != nil || parsed == nil {
+		return nil, err
+	}
+
 	// Remember metadata for injection into future chunks.
 	c.trackMetadata(parsed)
+	c.trackToolIDs(parsed)
+	c.trackFinish(parsed)
+	c.trackUsage(parsed)
 
 	// Split into emittable sub-programs, handling buffering and
 	// multi-event targets.
 	units := c.processInstructions(parsed)
 
-	var outputs [][]byte
-	for _, unit := range units {
-		c.injectMetadata(unit)
-		out, err := c.emitter.EmitStreamChunk(unit)
+	return c.emitUnits(units)
+}
+
+// emitUnits emits each unit, wrapping content in blocks for targets that
+// track them, and numbers the emitted events. Caller must hold c.mu.
+func (c *StreamConverter) emitUnits(units []*Program) (outputs [][]byte, err error) {
+	defer func() { c.record(outputs) }()
+
+	var events []blockEvent
+	if c.blocks != nil {
+		events = c.blocks.track(units)
+	} else {
+		for _, unit := range units {
+			events = append(events, blockEvent{unit, -1})
+		}
+	}
+
+	for _, ev := range events {
+		c.injectMetadata(ev.prog)
+		out, err := c.emitter.EmitStreamChunk(ev.prog)
 		if err != nil {
 			return outputs, fmt.Errorf("ail: stream convert emit: %w", err)
 		}
+		if out != nil && ev.index >= 0 {
+			if out, err = stampBlockIndex(out, ev.index); err != nil {
+				return outputs, err
+			}
+		}
 		if out != nil {
 			outputs = append(outputs, out)
 		}
@@ -151,12 +233,17 @@ func (c *StreamConverter) pushProgramLocked(parsed *Program) ([][]byte, error) {
 // fragments). Call this when the upstream stream ends to ensure all data
 // is delivered. It is safe to call Flush multiple times.
 func (c *StreamConverter) Flush() ([][]byte, error) {
+	return c.FlushContext(context.Background())
+}
+
+// FlushContext is Flush with ctx passed to the pipeline's passes.
+func (c *StreamConverter) FlushContext(ctx context.Context) ([][]byte, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	toolProg := c.drainPendingTools()
-	if toolProg == nil {
-		return nil, nil
+	toolProg, err := c.applyPipeline(ctx, c.drainPendingTools())
+	if err != nil || toolProg == nil {
+		return nil, err
 	}
 
 	c.injectMetadata(toolProg)
@@ -167,11 +254,70 @@ func (c *StreamConverter) Flush() ([][]byte, error) {
 	if out == nil {
 		return nil, nil
 	}
+	c.record([][]byte{out})
 	return [][]byte{out}, nil
 }
 
+// Interrupt ends a stream that was cut short, e.g. by a deadline: it emits
+// any buffered tool calls, closes the open content block, and finishes the
+// message with RESP_DONE FinishInterrupted (carrying the usage so far) and
+// STREAM_END, so that the client sees a well-formed end of stream. Terminal
+// events the stream already carried are not repeated.
+func (c *StreamConverter) Interrupt() ([][]byte, error) {
+	return c.InterruptContext(context.Background())
+}
+
+// InterruptContext is Interrupt with ctx passed to the pipeline's passes.
+// Since a stream is usually interrupted because its context ended, pass
+// context.WithoutCancel of that context to keep its values.
+func (c *StreamConverter) InterruptContext(ctx context.Context) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Buffered calls go first; the RESP_DONE below would otherwise be
+	// the only thing draining them.
+	var outputs [][]byte
+	toolProg, err := c.applyPipeline(ctx, c.drainPendingTools())
+	if err != nil {
+		return nil, err
+	}
+	if toolProg != nil {
+		if outputs, err = c.emitUnits([]*Program{toolProg}); err != nil {
+			return outputs, err
+		}
+	}
+
+	prog := NewProgram()
+	if c.finish == "" {
+		prog.EmitString(RESP_DONE, string(FinishInterrupted))
+		if c.usage != (Usage{}) {
+			c.usage.emit(prog)
+		}
+	}
+	if !c.ended {
+		prog.Emit(STREAM_END)
+	}
+	more, err := c.pushProgramLocked(ctx, prog)
+	return append(outputs, more...), err
+}
+
+// progress returns the usage and finish reason seen so far.
+func (c *StreamConverter) progress() (Usage, FinishReason) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usage, c.finish
+}
+
 // ─── internal helpers ────────────────────────────────────────────────────────
 
+// applyPipeline runs the stream-safe passes of the installed pipeline.
+func (c *StreamConverter) applyPipeline(ctx context.Context, prog *Program) (*Program, error) {
+	if c.pipeline == nil || prog == nil {
+		return prog, nil
+	}
+	return c.pipeline.Run(ctx, KindStreamChunk, prog)
+}
+
 // trackMetadata remembers RESP_ID and RESP_MODEL for later injection.
 func (c *StreamConverter) trackMetadata(prog *Program) {
 	for _, inst := range prog.Code {
@@ -184,6 +330,75 @@ func (c *StreamConverter) trackMetadata(prog *Program) {
 	}
 }
 
+// trackToolIDs gives tool calls without an ID (Gemini sends whole calls,
+// each at index 0 of its own chunk) an ID and a stream-wide index, so that
+// targets keying calls by either keep them apart. Gemini targets need
+// neither.
+func (c *StreamConverter) trackToolIDs(prog *Program) {
+	if c.targetStyle == StyleGoogleGenAI {
+		return
+	}
+	for i, inst := range prog.Code {
+		if inst.Op != STREAM_TOOL_DELTA {
+			continue
+		}
+		var td map[string]any
+		if json.Unmarshal(inst.JSON, &td) != nil {
+			continue
+		}
+		if id, _ := td["id"].(string); id != "" {
+			continue
+		}
+		src := 0
+		if f, ok := td["index"].(float64); ok {
+			src = int(f)
+		}
+		if name, named := td["name"].(string); named {
+			n := c.toolCalls
+			c.toolCalls++
+			c.toolIndex[src] = n
+			args, _ := td["arguments"].(string)
+			td["id"] = c.toolIDs(ToolCallKey{Seed: c.respID, Index: n, Name: name, Args: args})
+			td["index"] = n
+		} else if n, ok := c.toolIndex[src]; ok {
+			td["index"] = n
+		} else {
+			continue
+		}
+		prog.Code[i].JSON, _ = json.Marshal(td)
+	}
+}
+
+// trackFinish records the end of the message, reporting tool_calls for a
+// turn that called tools but finished with a plain stop (Gemini sends STOP
+// after its function calls).
+func (c *StreamConverter) trackFinish(prog *Program) {
+	for i, inst := range prog.Code {
+		switch inst.Op {
+		case STREAM_TOOL_DELTA:
+			c.calledTools = true
+		case RESP_DONE:
+			if c.calledTools && inst.Str == string(FinishStop) {
+				prog.Code[i].Str = string(FinishToolCalls)
+			}
+			c.finish = FinishReason(prog.Code[i].Str)
+		case STREAM_END:
+			c.ended = true
+		}
+	}
+}
+
+// trackUsage merges each USAGE into the running totals and replaces it
+// with them.
+func (c *StreamConverter) trackUsage(prog *Program) {
+	for i, inst := range prog.Code {
+		if inst.Op == USAGE {
+			c.usage.merge(decodeUsage(inst.JSON))
+			prog.Code[i].JSON, _ = json.Marshal(c.usage)
+		}
+	}
+}
+
 // injectMetadata prepends RESP_ID and RESP_MODEL to a program if they are
 // missing but have been seen in a previous chunk.
 func (c *StreamConverter) injectMetadata(prog *Program) {
@@ -220,6 +435,16 @@ func (c *StreamConverter) processInstructions(prog *Program) []*Program {
 		return c.splitForTarget(prog)
 	}
 
+	// Only Anthropic has content blocks; other targets drop the markers,
+	// and Chat Completions has nowhere to put thinking signatures.
+	drop := []Opcode{STREAM_BLOCK_START, STREAM_BLOCK_END}
+	if c.targetStyle == StyleChatCompletions {
+		drop = append(drop, STREAM_THINK_SIG)
+	}
+	if prog = stripOps(prog, drop...); prog == nil {
+		return nil
+	}
+
 	if c.bufferTools {
 		return c.processWithBuffering(prog)
 	}
@@ -246,7 +471,8 @@ func (c *StreamConverter) splitForTarget(prog *Program) []*Program {
 		switch inst.Op {
 		case RESP_ID, RESP_MODEL:
 			meta = append(meta, inst)
-		case STREAM_START, STREAM_DELTA, STREAM_THINK_DELTA, STREAM_TOOL_DELTA, RESP_DONE, STREAM_END:
+		case STREAM_START, STREAM_DELTA, STREAM_THINK_DELTA, STREAM_THINK_SIG, STREAM_TOOL_DELTA,
+			STREAM_BLOCK_START, STREAM_BLOCK_END, STREAM_ERROR, RESP_DONE, STREAM_END:
 			events = append(events, []Instruction{inst})
 		case USAGE:
 			// Attach usage to the preceding RESP_DONE if exists.
@@ -293,6 +519,24 @@ func (c *StreamConverter) splitForTarget(prog *Program) []*Program {
 	return result
 }
 
+// stripOps removes the given opcodes from a program. It returns nil if
+// nothing else was in the program.
+func stripOps(prog *Program, ops ...Opcode) *Program {
+	out := &Program{Buffers: prog.Buffers}
+	for _, inst := range prog.Code {
+		if !slices.Contains(ops, inst.Op) {
+			out.Code = append(out.Code, inst)
+		}
+	}
+	switch len(out.Code) {
+	case 0:
+		return nil
+	case len(prog.Code):
+		return prog
+	}
+	return out
+}
+
 // processWithBuffering handles tool call buffering for targets that require
 // complete function calls (e.g., Google GenAI). Non-tool instructions are
 // forwarded immediately; tool deltas are buffered and flushed when a flush
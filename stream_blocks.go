@@ -0,0 +1,202 @@
+package ail
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ─── Content-block lifecycle ─────────────────────────────────────────────────
+
+// blockTracker maintains the Anthropic content-block lifecycle for a
+// StreamConverter. Anthropic clients expect every delta to sit inside a
+// block opened by content_block_start and closed by content_block_stop,
+// with indices increasing across the whole message. Sources without
+// blocks (OpenAI, Gemini) only send deltas, so the tracker opens and
+// closes blocks whenever the kind of content changes and assigns each
+// event the index of the block it belongs to.
+type blockTracker struct {
+	isOpen bool
+	kind   string      // "text", "thinking" or "tool_use"
+	index  int         // index of the open block
+	next   int         // index of the next block
+	tools  map[int]int // source tool index → block index
+}
+
+// blockEvent is one emittable unit and the block index to stamp on the
+// emitted event (-1 for message-level events).
+type blockEvent struct {
+	prog  *Program
+	index int
+}
+
+func newBlockTracker() *blockTracker {
+	return &blockTracker{tools: make(map[int]int)}
+}
+
+// track expands units (as produced by splitForTarget) into block events,
+// inserting STREAM_BLOCK_START and STREAM_BLOCK_END where needed.
+func (t *blockTracker) track(units []*Program) []blockEvent {
+	var out []blockEvent
+	for _, unit := range units {
+		inst, ok := blockEventInst(unit)
+		if !ok {
+			out = append(out, blockEvent{unit, -1})
+			continue
+		}
+		switch inst.Op {
+		case STREAM_DELTA:
+			out = t.ensure(out, "text")
+			out = append(out, blockEvent{unit, t.index})
+
+		case STREAM_THINK_DELTA, STREAM_THINK_SIG:
+			out = t.ensure(out, "thinking")
+			out = append(out, blockEvent{unit, t.index})
+
+		case STREAM_TOOL_DELTA:
+			out = t.toolDelta(out, unit, inst)
+
+		case STREAM_BLOCK_START:
+			// The source has blocks of its own: follow its boundaries
+			// but keep our own numbering.
+			var b struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(inst.JSON, &b)
+			out = t.close(out)
+			out = t.start(out, b.Type)
+
+		case STREAM_BLOCK_END:
+			out = t.close(out)
+
+		case RESP_DONE, STREAM_END:
+			out = t.close(out)
+			out = append(out, blockEvent{unit, -1})
+
+		default:
+			out = append(out, blockEvent{unit, -1})
+		}
+	}
+	return out
+}
+
+// toolDelta places a STREAM_TOOL_DELTA. A delta naming the tool opens a
+// new tool_use block; argument deltas go to the block of their tool. A
+// delta carrying both (Gemini sends whole calls) is split in two, since
+// content_block_start cannot carry partial input.
+func (t *blockTracker) toolDelta(out []blockEvent, unit *Program, inst Instruction) []blockEvent {
+	var td map[string]any
+	if json.Unmarshal(inst.JSON, &td) != nil {
+		return append(out, blockEvent{unit, t.index})
+	}
+	src := 0
+	if f, ok := td["index"].(float64); ok {
+		src = int(f)
+	}
+
+	if _, named := td["name"]; named {
+		out = t.close(out)
+		t.open("tool_use")
+		t.tools[src] = t.index
+
+		args, hasArgs := td["arguments"].(string)
+		if !hasArgs || args == "" {
+			return append(out, blockEvent{unit, t.index})
+		}
+		delete(td, "arguments")
+		header, _ := json.Marshal(td)
+		argsOnly, _ := json.Marshal(map[string]any{"index": src, "arguments": args})
+		out = append(out, blockEvent{replaceEventInst(unit, Instruction{Op: STREAM_TOOL_DELTA, JSON: header}), t.index})
+		return append(out, blockEvent{singleInst(Instruction{Op: STREAM_TOOL_DELTA, JSON: argsOnly}), t.index})
+	}
+
+	idx, ok := t.tools[src]
+	if !ok {
+		// Arguments for a call we never saw start (e.g. a Responses
+		// output index): attach them to the open tool block.
+		idx = t.index
+	}
+	return append(out, blockEvent{unit, idx})
+}
+
+// ensure makes sure a block of kind is open, closing a block of another
+// kind first.
+func (t *blockTracker) ensure(out []blockEvent, kind string) []blockEvent {
+	if t.isOpen && t.kind == kind {
+		return out
+	}
+	out = t.close(out)
+	return t.start(out, kind)
+}
+
+// start opens a block and emits its STREAM_BLOCK_START.
+func (t *blockTracker) start(out []blockEvent, kind string) []blockEvent {
+	t.open(kind)
+	j, _ := json.Marshal(map[string]any{"index": t.index, "type": kind})
+	return append(out, blockEvent{singleInst(Instruction{Op: STREAM_BLOCK_START, JSON: j}), t.index})
+}
+
+// open assigns the next index to a new block without emitting anything
+// (tool_use blocks are started by their named STREAM_TOOL_DELTA).
+func (t *blockTracker) open(kind string) {
+	t.isOpen, t.kind, t.index = true, kind, t.next
+	t.next++
+}
+
+// close emits STREAM_BLOCK_END for the open block, if any.
+func (t *blockTracker) close(out []blockEvent) []blockEvent {
+	if !t.isOpen {
+		return out
+	}
+	t.isOpen = false
+	j, _ := json.Marshal(map[string]any{"index": t.index})
+	return append(out, blockEvent{singleInst(Instruction{Op: STREAM_BLOCK_END, JSON: j}), t.index})
+}
+
+// isEventMeta reports whether op travels alongside a unit's event rather
+// than being the event itself.
+func isEventMeta(op Opcode) bool {
+	switch op {
+	case RESP_ID, RESP_MODEL, USAGE, EXT_DATA, SET_META:
+		return true
+	}
+	return false
+}
+
+// blockEventInst returns the event instruction of a unit.
+func blockEventInst(unit *Program) (Instruction, bool) {
+	for _, inst := range unit.Code {
+		if !isEventMeta(inst.Op) {
+			return inst, true
+		}
+	}
+	return Instruction{}, false
+}
+
+// replaceEventInst returns a copy of unit with its event instruction
+// replaced by inst; metadata is kept.
+func replaceEventInst(unit *Program, inst Instruction) *Program {
+	p := &Program{Buffers: unit.Buffers}
+	for _, old := range unit.Code {
+		if !isEventMeta(old.Op) {
+			old = inst
+		}
+		p.Code = append(p.Code, old)
+	}
+	return p
+}
+
+func singleInst(inst Instruction) *Program {
+	p := NewProgram()
+	p.Code = append(p.Code, inst)
+	return p
+}
+
+// stampBlockIndex sets the "index" field of an emitted Anthropic event.
+func stampBlockIndex(event []byte, index int) ([]byte, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(event, &m); err != nil {
+		return nil, fmt.Errorf("ail: stamp block index: %w", err)
+	}
+	m["index"], _ = json.Marshal(index)
+	return json.Marshal(m)
+}
@@ -0,0 +1,138 @@
+package ail
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// anthropicEvents pushes chunks through conv and renders each output as
+// "type" or "type:index".
+func anthropicEvents(t *testing.T, conv *StreamConverter, chunks ...string) []string {
+	t.Helper()
+	var events []string
+	for i, chunk := range chunks {
+		outputs, err := conv.Push([]byte(chunk))
+		if err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+		for _, out := range outputs {
+			var ev struct {
+				Type  string `json:"type"`
+				Index *int   `json:"index"`
+				Delta struct {
+					Type string `json:"type"`
+				} `json:"delta"`
+			}
+			if err := json.Unmarshal(out, &ev); err != nil {
+				t.Fatal(err)
+			}
+			s := ev.Type
+			if ev.Type == "content_block_delta" {
+				s = ev.Delta.Type
+			}
+			if ev.Index != nil {
+				s += fmt.Sprintf(":%d", *ev.Index)
+			}
+			events = append(events, s)
+		}
+	}
+	return events
+}
+
+func TestStreamBlocksFromChat(t *testing.T) {
+	conv, err := NewStreamConverter(StyleChatCompletions, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := func(delta string) string {
+		return `{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":` + delta + `}]}`
+	}
+	got := anthropicEvents(t, conv,
+		chunk(`{"role":"assistant"}`),
+		chunk(`{"reasoning_content":"Hmm"}`),
+		chunk(`{"reasoning_content":"."}`),
+		chunk(`{"content":"Let me check."}`),
+		chunk(`{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"a","arguments":""}}]}`),
+		chunk(`{"tool_calls":[{"index":0,"function":{"arguments":"{}"}}]}`),
+		chunk(`{"tool_calls":[{"index":1,"id":"call_2","function":{"name":"b","arguments":"{\"x\":1}"}}]}`),
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	)
+	want := "message_start " +
+		"content_block_start:0 thinking_delta:0 thinking_delta:0 content_block_stop:0 " +
+		"content_block_start:1 text_delta:1 content_block_stop:1 " +
+		"content_block_start:2 input_json_delta:2 content_block_stop:2 " +
+		"content_block_start:3 input_json_delta:3 content_block_stop:3 " +
+		"message_delta message_stop"
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("events:\n got %s\nwant %s", s, want)
+	}
+}
+
+func TestStreamBlocksFromGemini(t *testing.T) {
+	conv, err := NewStreamConverter(StyleGoogleGenAI, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := anthropicEvents(t, conv,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Sure."}]}}],"modelVersion":"gemini"}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"lookup","args":{"q":"x"}}}]},"finishReason":"STOP"}]}`,
+	)
+	want := "content_block_start:0 text_delta:0 content_block_stop:0 " +
+		"content_block_start:1 input_json_delta:1 content_block_stop:1 message_delta"
+	if s := strings.Join(got, " "); !strings.HasPrefix(s, want) {
+		t.Errorf("events:\n got %s\nwant prefix %s", s, want)
+	}
+}
+
+func TestStreamBlocksSignatureBeforeStop(t *testing.T) {
+	conv, err := NewStreamConverter(StyleAnthropic, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := NewProgram()
+	prog.EmitString(STREAM_THINK_DELTA, "Hmm")
+	prog.EmitString(STREAM_THINK_SIG, "sig")
+	prog.EmitString(STREAM_DELTA, "Hi")
+	outputs, err := conv.PushProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, out := range outputs {
+		var ev struct {
+			Type  string
+			Index int
+			Delta map[string]string
+		}
+		json.Unmarshal(out, &ev)
+		types = append(types, fmt.Sprintf("%s:%d", ev.Type, ev.Index))
+		if ev.Delta["type"] == "signature_delta" && ev.Delta["signature"] != "sig" {
+			t.Errorf("signature_delta = %s", out)
+		}
+	}
+	want := "content_block_start:0 content_block_delta:0 content_block_delta:0 content_block_stop:0 content_block_start:1 content_block_delta:1"
+	if s := strings.Join(types, " "); s != want {
+		t.Errorf("events:\n got %s\nwant %s", s, want)
+	}
+}
+
+func TestStreamBlocksDroppedForOtherTargets(t *testing.T) {
+	conv, err := NewStreamConverter(StyleAnthropic, StyleChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range []string{
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_stop","index":0}`,
+	} {
+		outputs, err := conv.Push([]byte(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outputs) != 0 {
+			t.Errorf("%s: got %d outputs", chunk, len(outputs))
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package ail
+
+// ─── Stream errors ───────────────────────────────────────────────────────────
+
+// StreamError is a failure reported by the provider in the middle of a
+// stream, carried by STREAM_ERROR. Emitters write it as the target's native
+// error event (see ProviderError for the translation).
+type StreamError = ProviderError
+
+// StreamError returns the first STREAM_ERROR of the program, or nil.
+func (p *Program) StreamError() *StreamError {
+	for _, inst := range p.Code {
+		if inst.Op == STREAM_ERROR {
+			return decodeProviderError(inst.JSON)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package ail
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStreamErrorConversion(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to Style
+		chunk    string
+		want     string
+	}{
+		{
+			"anthropic overloaded to chat", StyleAnthropic, StyleChatCompletions,
+			`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			`{"error":{"code":null,"message":"Overloaded","param":null,"type":"server_error"}}`,
+		},
+		{
+			"chat rate limit to anthropic", StyleChatCompletions, StyleAnthropic,
+			`{"error":{"message":"Slow down","type":"requests","code":"rate_limit_exceeded"}}`,
+			`{"error":{"message":"Slow down","type":"rate_limit_error"},"type":"error"}`,
+		},
+		{
+			"gemini unavailable to anthropic", StyleGoogleGenAI, StyleAnthropic,
+			`{"error":{"code":503,"message":"The model is overloaded.","status":"UNAVAILABLE"}}`,
+			`{"error":{"message":"The model is overloaded.","type":"overloaded_error"},"type":"error"}`,
+		},
+		{
+			"anthropic overloaded to gemini", StyleAnthropic, StyleGoogleGenAI,
+			`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			`{"error":{"code":503,"message":"Overloaded","status":"UNAVAILABLE"}}`,
+		},
+		{
+			"responses failure to chat", StyleResponses, StyleChatCompletions,
+			`{"type":"response.failed","response":{"error":{"code":"server_error","message":"Boom"}}}`,
+			`{"error":{"code":"server_error","message":"Boom","param":null,"type":"server_error"}}`,
+		},
+		{
+			"same style keeps the type", StyleAnthropic, StyleAnthropic,
+			`{"type":"error","error":{"type":"api_error","message":"Internal"}}`,
+			`{"error":{"message":"Internal","type":"api_error"},"type":"error"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conv, err := NewStreamConverter(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputs, err := conv.Push([]byte(tt.chunk))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(outputs) != 1 || string(outputs[0]) != tt.want {
+				t.Errorf("got %q\nwant %s", outputs, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamErrorAccumulate(t *testing.T) {
+	acc := NewAccumulator()
+	for _, chunk := range []string{
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Par"}}`,
+		`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	} {
+		p, err := (&AnthropicParser{}).ParseStreamChunk([]byte(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		acc.Add(p)
+	}
+	var se *StreamError
+	if !errors.As(acc.Err(), &se) || se.Status != 529 || se.Type != "overloaded_error" {
+		t.Fatalf("Err() = %v", acc.Err())
+	}
+	if acc.Done() || !strings.Contains(acc.Program().Disasm(), "Par") {
+		t.Errorf("partial response lost:\n%s", acc.Program().Disasm())
+	}
+}
+
+func TestStreamErrorPipe(t *testing.T) {
+	in := `data: {"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hi"}}]}` + "\n\n" +
+		`data: {"error":{"message":"Internal error","type":"server_error","code":null}}` + "\n\n"
+	pipe, err := NewStreamPipe(StyleChatCompletions, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := pipe.Run(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "event: error\ndata: {\"error\":{\"message\":\"Internal error\",\"type\":\"api_error\"},\"type\":\"error\"}") {
+		t.Errorf("output:\n%s", out.String())
+	}
+}
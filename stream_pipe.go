@@ -0,0 +1,280 @@
+package ail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ─── Stream pipe ─────────────────────────────────────────────────────────────
+
+// StreamPipe connects an upstream provider stream to a downstream writer
+// through a StreamConverter, handling framing on both sides:
+//
+//   - Input may be Server-Sent Events (multi-line data, comments, event
+//     names, the OpenAI "[DONE]" sentinel) or a JSON array of chunks
+//     (Google GenAI without alt=sse); the framing is detected.
+//   - Output is Server-Sent Events in the target's conventions: Anthropic
+//     events carry "event:" names matching their type, OpenAI streams end
+//     with "data: [DONE]". Set JSONArray to write a JSON array instead
+//     (Google GenAI without alt=sse).
+//
+// Usage in an HTTP proxy:
+//
+//	pipe, _ := ail.NewStreamPipe(ail.StyleAnthropic, ail.StyleChatCompletions)
+//	w.Header().Set("Content-Type", "text/event-stream")
+//	err := pipe.Run(upstream.Body, w) // flushes w after every event
+//
+// RunContext additionally stops when a context ends (see there).
+type StreamPipe struct {
+	// JSONArray writes the output as a JSON array of chunks instead of
+	// Server-Sent Events.
+	JSONArray bool
+
+	// EventIDs writes an "id:" line with each event's converter event ID,
+	// so that a client reconnecting with Last-Event-ID can be served from
+	// StreamConverter.ReplayFrom. Ignored with JSONArray.
+	EventIDs bool
+
+	conv *StreamConverter
+	to   Style
+}
+
+// NewStreamPipe creates a pipe converting streams from one style to another.
+func NewStreamPipe(from, to Style) (*StreamPipe, error) {
+	conv, err := NewStreamConverter(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamPipe{conv: conv, to: to}, nil
+}
+
+// Converter returns the underlying converter, e.g. to install a pipeline.
+func (sp *StreamPipe) Converter() *StreamConverter { return sp.conv }
+
+// StreamProgress reports how far a stream got through a StreamPipe.
+type StreamProgress struct {
+	ChunksIn  int          // upstream chunks read
+	ChunksOut int          // converted chunks written
+	Finish    FinishReason // last finish reason written, FinishInterrupted after a deadline
+	Usage     Usage        // usage reported so far
+	Completed bool         // the upstream stream reached its end
+}
+
+// Run reads the upstream stream from r until it ends and writes the
+// converted stream to w. A pipe handles a single stream.
+func (sp *StreamPipe) Run(r io.Reader, w io.Writer) error {
+	_, err := sp.RunContext(context.Background(), r, w)
+	return err
+}
+
+// RunContext is Run bounded by ctx. When ctx ends before the upstream
+// stream does, the pipe stops reading and the error wraps ctx.Err():
+//
+//   - On cancellation (the client went away) nothing more is written.
+//   - On a deadline the stream is ended for the client with the target's
+//     terminal events and an interrupted finish (see
+//     StreamConverter.Interrupt), e.g. an Anthropic message_delta with
+//     stop_reason "max_tokens" followed by message_stop.
+//
+// If r is an io.Closer it is closed when ctx ends or the pipe fails before
+// the upstream stream ends, to unblock the pending read and release the
+// upstream connection. The returned progress is valid whether or not there
+// is an error. Stream passes installed on the converter receive ctx; the
+// final interrupted events are converted with its values but without its
+// deadline.
+func (sp *StreamPipe) RunContext(ctx context.Context, r io.Reader, w io.Writer) (progress StreamProgress, err error) {
+	out := sp.newWriter(w)
+	defer func() {
+		progress.ChunksOut = out.n
+		progress.Usage, progress.Finish = sp.conv.progress()
+	}()
+
+	// Cancelling on return stops the reader goroutine however the pipe
+	// ends; Run passes a context that is never done.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := readChunks(ctx, r)
+	for {
+		var rc readResult
+		select {
+		case <-ctx.Done():
+			return progress, sp.interrupt(ctx, r, out)
+		case rc = <-chunks:
+		}
+		if rc.err == io.EOF {
+			break
+		}
+		if rc.err != nil {
+			closeReader(r)
+			return progress, fmt.Errorf("ail: stream pipe: read chunk %d: %w", progress.ChunksIn, rc.err)
+		}
+		n := progress.ChunksIn
+		progress.ChunksIn++
+		outputs, err := sp.conv.PushContext(ctx, rc.chunk)
+		if err != nil {
+			closeReader(r)
+			return progress, fmt.Errorf("ail: stream pipe: chunk %d: %w", n, err)
+		}
+		if err := out.write(outputs); err != nil {
+			closeReader(r)
+			return progress, err
+		}
+	}
+	progress.Completed = true
+	final, err := sp.conv.FlushContext(ctx)
+	if err != nil {
+		return progress, err
+	}
+	if err := out.write(final); err != nil {
+		return progress, err
+	}
+	return progress, out.close()
+}
+
+// interrupt stops a pipe whose context ended, finishing the client's
+// stream when the context hit its deadline.
+func (sp *StreamPipe) interrupt(ctx context.Context, r io.Reader, out *chunkWriter) error {
+	closeReader(r)
+	err := fmt.Errorf("ail: stream pipe: %w", ctx.Err())
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	// The passes still see ctx's values, but not its expired deadline.
+	final, ierr := sp.conv.InterruptContext(context.WithoutCancel(ctx))
+	if ierr == nil {
+		ierr = out.write(final)
+	}
+	if ierr == nil {
+		ierr = out.close()
+	}
+	return errors.Join(err, ierr)
+}
+
+// closeReader closes r if it is an io.Closer.
+func closeReader(r io.Reader) {
+	if c, ok := r.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+type readResult struct {
+	chunk []byte
+	err   error
+}
+
+// readChunks reads r on its own goroutine so that a blocked read does not
+// delay reacting to ctx. The goroutine exits after the first error or once
+// ctx ends; a read blocked at that point returns when r is closed.
+func readChunks(ctx context.Context, r io.Reader) <-chan readResult {
+	ch := make(chan readResult)
+	go func() {
+		in := NewChunkReader(r)
+		for {
+			chunk, err := in.ReadChunk()
+			select {
+			case ch <- readResult{chunk, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// chunkWriter frames emitted chunks for one target.
+type chunkWriter struct {
+	w     io.Writer
+	sse   *SSEWriter
+	to    Style
+	array bool
+	n     int
+	ids   *StreamConverter // numbers events when EventIDs is set
+}
+
+func (sp *StreamPipe) newWriter(w io.Writer) *chunkWriter {
+	cw := &chunkWriter{w: w, sse: NewSSEWriter(w), to: sp.to, array: sp.JSONArray}
+	if sp.EventIDs {
+		cw.ids = sp.conv
+	}
+	return cw
+}
+
+// write writes the outputs of one converter call, which were the last
+// events the converter emitted.
+func (cw *chunkWriter) write(chunks [][]byte) error {
+	var id uint64
+	if cw.ids != nil {
+		id = cw.ids.lastSeq() - uint64(len(chunks))
+	}
+	for _, c := range chunks {
+		var eventID string
+		if cw.ids != nil {
+			id++
+			eventID = strconv.FormatUint(id, 10)
+		}
+		if err := cw.writeOne(c, eventID); err != nil {
+			return fmt.Errorf("ail: stream pipe: write: %w", err)
+		}
+	}
+	return nil
+}
+
+func (cw *chunkWriter) writeOne(chunk []byte, id string) error {
+	defer func() { cw.n++ }()
+	if cw.array {
+		sep := ",\n"
+		if cw.n == 0 {
+			sep = "["
+		}
+		if _, err := io.WriteString(cw.w, sep); err != nil {
+			return err
+		}
+		_, err := cw.w.Write(chunk)
+		if err == nil {
+			err = cw.sse.flush()
+		}
+		return err
+	}
+	return cw.sse.WriteEvent(SSEEvent{Event: sseEventName(cw.to, chunk), ID: id, Data: chunk})
+}
+
+// close writes the target's end-of-stream framing.
+func (cw *chunkWriter) close() error {
+	var err error
+	switch {
+	case cw.array && cw.n == 0:
+		_, err = io.WriteString(cw.w, "[]")
+	case cw.array:
+		_, err = io.WriteString(cw.w, "]")
+	case cw.to == StyleChatCompletions:
+		err = cw.sse.WriteEvent(SSEEvent{Data: []byte(sseDone)})
+	}
+	if err == nil {
+		err = cw.sse.flush()
+	}
+	if err != nil {
+		return fmt.Errorf("ail: stream pipe: close: %w", err)
+	}
+	return nil
+}
+
+// sseEventName returns the "event:" name for a chunk: the chunk's "type"
+// for targets with typed events (Anthropic, Responses), otherwise "".
+func sseEventName(to Style, chunk []byte) string {
+	if to != StyleAnthropic && to != StyleResponses {
+		return ""
+	}
+	var ev struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(chunk, &ev)
+	return ev.Type
+}
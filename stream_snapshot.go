@@ -0,0 +1,228 @@
+package ail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ─── Event IDs and replay ────────────────────────────────────────────────────
+
+// ErrReplayUnavailable is returned by ReplayFrom when the events after the
+// requested ID are no longer (or were never) kept.
+var ErrReplayUnavailable = errors.New("ail: events not available for replay")
+
+// record numbers emitted events and keeps the last replayLimit of them.
+// Caller must hold c.mu.
+func (c *StreamConverter) record(outputs [][]byte) {
+	c.seq += uint64(len(outputs))
+	if c.replayLimit <= 0 {
+		return
+	}
+	c.history = append(c.history, outputs...)
+	if over := len(c.history) - c.replayLimit; over > 0 {
+		c.history = append(c.history[:0:0], c.history[over:]...)
+	}
+}
+
+// LastEventID returns the ID of the last emitted event, or "" before the
+// first one. Events are numbered "1", "2", … in emission order across
+// Push, PushProgram, Flush and Interrupt, so the n outputs of one call have
+// the n consecutive IDs ending at LastEventID.
+func (c *StreamConverter) LastEventID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seq == 0 {
+		return ""
+	}
+	return strconv.FormatUint(c.seq, 10)
+}
+
+// lastSeq returns the number of the last emitted event.
+func (c *StreamConverter) lastSeq() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
+
+// SetReplayLimit keeps the last n emitted events so that ReplayFrom can
+// resend them to a client that reconnects. The default, 0, keeps none.
+func (c *StreamConverter) SetReplayLimit(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replayLimit = n
+	switch {
+	case n <= 0:
+		c.history = nil
+	case len(c.history) > n:
+		c.history = append(c.history[:0:0], c.history[len(c.history)-n:]...)
+	}
+}
+
+// ReplayFrom returns the events emitted after the event with the given ID
+// (the client's Last-Event-ID), ready to be written with an SSEWriter. An
+// empty ID replays from the start of the stream. ErrReplayUnavailable is
+// returned when some of those events are no longer kept (see
+// SetReplayLimit) or the ID was never issued.
+func (c *StreamConverter) ReplayFrom(lastEventID string) ([]SSEEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var after uint64
+	if lastEventID != "" {
+		n, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil || n > c.seq {
+			return nil, fmt.Errorf("%w: unknown event ID %q", ErrReplayUnavailable, lastEventID)
+		}
+		after = n
+	}
+	first := c.seq - uint64(len(c.history)) + 1
+	if after+1 < first {
+		return nil, fmt.Errorf("%w: events %d to %d were not kept", ErrReplayUnavailable, after+1, first-1)
+	}
+
+	var events []SSEEvent
+	for seq := after + 1; seq <= c.seq; seq++ {
+		data := c.history[seq-first]
+		events = append(events, SSEEvent{
+			Event: sseEventName(c.targetStyle, data),
+			ID:    strconv.FormatUint(seq, 10),
+			Data:  data,
+		})
+	}
+	return events, nil
+}
+
+// ─── Snapshot and restore ────────────────────────────────────────────────────
+
+// converterSnapshot is the serialized state of a StreamConverter.
+type converterSnapshot struct {
+	Version     int               `json:"version"`
+	From        Style             `json:"from"`
+	To          Style             `json:"to"`
+	RespID      string            `json:"resp_id,omitempty"`
+	RespModel   string            `json:"resp_model,omitempty"`
+	CalledTools bool              `json:"called_tools,omitempty"`
+	Usage       Usage             `json:"usage"`
+	Finish      FinishReason      `json:"finish,omitempty"`
+	Ended       bool              `json:"ended,omitempty"`
+	ToolCalls   int               `json:"tool_calls,omitempty"`
+	ToolIndex   map[int]int       `json:"tool_index,omitempty"`
+	Tools       []snapshotTool    `json:"pending_tools,omitempty"`
+	Blocks      *snapshotBlocks   `json:"blocks,omitempty"`
+	Seq         uint64            `json:"seq"`
+	ReplayLimit int               `json:"replay_limit,omitempty"`
+	History     []json.RawMessage `json:"history,omitempty"`
+}
+
+// snapshotTool is a buffered tool call, in arrival order.
+type snapshotTool struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Args  string `json:"args,omitempty"`
+}
+
+// snapshotBlocks is the Anthropic content-block state.
+type snapshotBlocks struct {
+	Open  bool        `json:"open"`
+	Kind  string      `json:"kind,omitempty"`
+	Index int         `json:"index"`
+	Next  int         `json:"next"`
+	Tools map[int]int `json:"tools,omitempty"`
+}
+
+const snapshotVersion = 1
+
+// Snapshot serializes the converter's state as JSON: response metadata,
+// usage and finish so far, buffered tool calls, the open content block, the
+// event counter and the events kept for replay. RestoreStreamConverter
+// rebuilds a converter from it, e.g. on another instance after the client
+// reconnects. The pipeline installed with SetPipeline and the function set
+// with SetToolIDs are not included.
+func (c *StreamConverter) Snapshot() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := converterSnapshot{
+		Version:     snapshotVersion,
+		From:        c.sourceStyle,
+		To:          c.targetStyle,
+		RespID:      c.respID,
+		RespModel:   c.respModel,
+		CalledTools: c.calledTools,
+		Usage:       c.usage,
+		Finish:      c.finish,
+		Ended:       c.ended,
+		ToolCalls:   c.toolCalls,
+		ToolIndex:   c.toolIndex,
+		Seq:         c.seq,
+		ReplayLimit: c.replayLimit,
+	}
+	for _, idx := range c.toolOrder {
+		tc := c.pendingTools[idx]
+		s.Tools = append(s.Tools, snapshotTool{Index: idx, ID: tc.ID, Name: tc.Name, Args: tc.Args.String()})
+	}
+	if b := c.blocks; b != nil {
+		s.Blocks = &snapshotBlocks{Open: b.isOpen, Kind: b.kind, Index: b.index, Next: b.next, Tools: b.tools}
+	}
+	for _, ev := range c.history {
+		s.History = append(s.History, ev)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("ail: stream converter snapshot: %w", err)
+	}
+	return data, nil
+}
+
+// RestoreStreamConverter creates a converter from a Snapshot. Pushing the
+// rest of the upstream stream to it continues the conversion exactly where
+// the original converter stopped, including event IDs.
+func RestoreStreamConverter(data []byte) (*StreamConverter, error) {
+	var s converterSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("ail: restore stream converter: %w", err)
+	}
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("ail: restore stream converter: unsupported snapshot version %d", s.Version)
+	}
+	c, err := NewStreamConverter(s.From, s.To)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.History) > s.ReplayLimit {
+		return nil, fmt.Errorf("ail: restore stream converter: %d events kept with replay limit %d", len(s.History), s.ReplayLimit)
+	}
+	if uint64(len(s.History)) > s.Seq {
+		return nil, fmt.Errorf("ail: restore stream converter: %d events kept but only %d emitted", len(s.History), s.Seq)
+	}
+
+	c.respID, c.respModel = s.RespID, s.RespModel
+	c.calledTools, c.usage = s.CalledTools, s.Usage
+	c.finish, c.ended = s.Finish, s.Ended
+	c.toolCalls = s.ToolCalls
+	for src, idx := range s.ToolIndex {
+		c.toolIndex[src] = idx
+	}
+	c.seq, c.replayLimit = s.Seq, s.ReplayLimit
+	for _, ev := range s.History {
+		c.history = append(c.history, []byte(ev))
+	}
+	for _, t := range s.Tools {
+		tc := &pendingToolCall{ID: t.ID, Name: t.Name}
+		tc.Args.WriteString(t.Args)
+		if _, dup := c.pendingTools[t.Index]; !dup {
+			c.toolOrder = append(c.toolOrder, t.Index)
+		}
+		c.pendingTools[t.Index] = tc
+	}
+	if b := s.Blocks; b != nil && c.blocks != nil {
+		c.blocks.isOpen, c.blocks.kind, c.blocks.index, c.blocks.next = b.Open, b.Kind, b.Index, b.Next
+		for src, idx := range b.Tools {
+			c.blocks.tools[src] = idx
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,168 @@
+package ail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStreamConverterSnapshotResume(t *testing.T) {
+	chunks := []string{
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Let me "}}]}`,
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"check."}}]}`,
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"ci"}}]}}]}`,
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ty\":\"Paris\"}"}}]}}]}`,
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":9,"completion_tokens":7,"total_tokens":16}}`,
+	}
+	for _, to := range []Style{StyleAnthropic, StyleGoogleGenAI, StyleChatCompletions} {
+		t.Run(string(to), func(t *testing.T) {
+			run := func(conv *StreamConverter, chunks []string) []string {
+				var out []string
+				for _, c := range chunks {
+					outs, err := conv.Push([]byte(c))
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, o := range outs {
+						out = append(out, string(o))
+					}
+				}
+				final, err := conv.Flush()
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, o := range final {
+					out = append(out, string(o))
+				}
+				return out
+			}
+
+			whole, _ := NewStreamConverter(StyleChatCompletions, to)
+			want := run(whole, chunks)
+
+			// Stop after the first argument fragment: a text block has been
+			// closed and a tool call is open (or buffered, for Gemini).
+			first, _ := NewStreamConverter(StyleChatCompletions, to)
+			var got []string
+			for _, c := range chunks[:3] {
+				outs, err := first.Push([]byte(c))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, o := range outs {
+					got = append(got, string(o))
+				}
+			}
+			snap, err := first.Snapshot()
+			if err != nil {
+				t.Fatal(err)
+			}
+			resumed, err := RestoreStreamConverter(snap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resumed.LastEventID() != first.LastEventID() {
+				t.Errorf("LastEventID = %q, want %q", resumed.LastEventID(), first.LastEventID())
+			}
+			got = append(got, run(resumed, chunks[3:])...)
+
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("resumed stream:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+			if resumed.LastEventID() != whole.LastEventID() {
+				t.Errorf("LastEventID after resume = %q, want %q", resumed.LastEventID(), whole.LastEventID())
+			}
+		})
+	}
+
+	if _, err := RestoreStreamConverter([]byte(`{"version":99,"from":"anthropic-messages","to":"google-genai"}`)); err == nil {
+		t.Error("expected error for unknown snapshot version")
+	}
+}
+
+func TestStreamConverterReplayFrom(t *testing.T) {
+	conv, err := NewStreamConverter(StyleChatCompletions, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.SetReplayLimit(3)
+	var emitted [][]byte
+	for _, c := range []string{
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	} {
+		outs, err := conv.Push([]byte(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		emitted = append(emitted, outs...)
+	}
+	// message_start, content_block_start, content_block_delta,
+	// content_block_stop, message_delta, message_stop
+	if len(emitted) != 6 || conv.LastEventID() != "6" {
+		t.Fatalf("emitted %d events, last ID %q", len(emitted), conv.LastEventID())
+	}
+
+	// Replay survives a snapshot.
+	snap, err := conv.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conv, err = RestoreStreamConverter(snap); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := conv.ReplayFrom("4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ID != "5" || events[1].ID != "6" ||
+		events[0].Event != "message_delta" || events[1].Event != "message_stop" ||
+		!bytes.Equal(events[0].Data, emitted[4]) {
+		t.Errorf("ReplayFrom(4) = %+v", events)
+	}
+	if events, err := conv.ReplayFrom("3"); err != nil || len(events) != 3 {
+		t.Errorf("ReplayFrom(3) = %v, %v", events, err)
+	}
+	if events, err := conv.ReplayFrom("6"); err != nil || len(events) != 0 {
+		t.Errorf("ReplayFrom(6) = %v, %v", events, err)
+	}
+	for _, id := range []string{"", "2", "7", "x"} {
+		if _, err := conv.ReplayFrom(id); !errors.Is(err, ErrReplayUnavailable) {
+			t.Errorf("ReplayFrom(%q) err = %v", id, err)
+		}
+	}
+}
+
+func TestStreamPipeEventIDs(t *testing.T) {
+	in := `data: {"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hi"}}]}` + "\n\n" +
+		`data: {"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+	pipe, err := NewStreamPipe(StyleChatCompletions, StyleChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipe.EventIDs = true
+	var out bytes.Buffer
+	if err := pipe.Run(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	r := NewSSEReader(&out)
+	var ids []string
+	for {
+		ev, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, ev.ID)
+	}
+	if got := strings.Join(ids, ","); got != "1,2," {
+		t.Errorf("event IDs = %q, want 1,2 and none on [DONE]", got)
+	}
+}
@@ -25,28 +25,30 @@ func TestStreamConverter_TextDelta_OpenAIToAnthropic(t *testing.T) {
 	}
 	assertJSONField(t, outputs[0], "type", "message_start")
 
-	// OpenAI text delta → Anthropic content_block_delta
+	// OpenAI text delta → Anthropic content_block_start + content_block_delta
 	delta := `{"id":"chatcmpl-x","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`
 	outputs, err = conv.Push([]byte(delta))
 	if err != nil {
 		t.Fatalf("push delta: %v", err)
 	}
-	if len(outputs) != 1 {
-		t.Fatalf("delta: want 1 output, got %d", len(outputs))
+	if len(outputs) != 2 {
+		t.Fatalf("delta: want 2 outputs, got %d", len(outputs))
 	}
-	assertJSONField(t, outputs[0], "type", "content_block_delta")
+	assertJSONField(t, outputs[0], "type", "content_block_start")
+	assertJSONField(t, outputs[1], "type", "content_block_delta")
 
-	// OpenAI finish → Anthropic message_delta + message_stop (2 events)
+	// OpenAI finish → Anthropic content_block_stop + message_delta + message_stop
 	finish := `{"id":"chatcmpl-x","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`
 	outputs, err = conv.Push([]byte(finish))
 	if err != nil {
 		t.Fatalf("push finish: %v", err)
 	}
-	if len(outputs) != 2 {
-		t.Fatalf("finish: want 2 outputs (message_delta + message_stop), got %d", len(outputs))
+	if len(outputs) != 3 {
+		t.Fatalf("finish: want 3 outputs (content_block_stop + message_delta + message_stop), got %d", len(outputs))
 	}
-	assertJSONField(t, outputs[0], "type", "message_delta")
-	assertJSONField(t, outputs[1], "type", "message_stop")
+	assertJSONField(t, outputs[0], "type", "content_block_stop")
+	assertJSONField(t, outputs[1], "type", "message_delta")
+	assertJSONField(t, outputs[2], "type", "message_stop")
 }
 
 func TestStreamConverter_TextDelta_AnthropicToOpenAI(t *testing.T) {
@@ -196,11 +198,12 @@ func TestStreamConverter_ToolCall_OpenAIToAnthropic(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(outputs) != 2 {
-		t.Fatalf("finish: want 2 outputs, got %d", len(outputs))
+	if len(outputs) != 3 {
+		t.Fatalf("finish: want 3 outputs, got %d", len(outputs))
 	}
-	assertJSONField(t, outputs[0], "type", "message_delta")
-	assertJSONField(t, outputs[1], "type", "message_stop")
+	assertJSONField(t, outputs[0], "type", "content_block_stop")
+	assertJSONField(t, outputs[1], "type", "message_delta")
+	assertJSONField(t, outputs[2], "type", "message_stop")
 }
 
 // ─── Tool call: Anthropic → OpenAI (1:1, no buffering) ─────────────────────
@@ -377,7 +380,9 @@ func TestStreamConverter_AnthropicToAnthropic(t *testing.T) {
 
 	chunks := []string{
 		`{"type":"message_start","message":{"id":"msg_rr","model":"claude-3-haiku"}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
 		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"content_block_stop","index":0}`,
 		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":1}}`,
 		`{"type":"message_stop"}`,
 	}
@@ -391,12 +396,12 @@ func TestStreamConverter_AnthropicToAnthropic(t *testing.T) {
 		allOutputs = append(allOutputs, outputs...)
 	}
 
-	if len(allOutputs) != 4 {
-		t.Fatalf("want 4 outputs, got %d", len(allOutputs))
+	if len(allOutputs) != 6 {
+		t.Fatalf("want 6 outputs, got %d", len(allOutputs))
 	}
 
 	// Verify event types preserved
-	expectedTypes := []string{"message_start", "content_block_delta", "message_delta", "message_stop"}
+	expectedTypes := []string{"message_start", "content_block_start", "content_block_delta", "content_block_stop", "message_delta", "message_stop"}
 	for i, expected := range expectedTypes {
 		var m map[string]any
 		json.Unmarshal(allOutputs[i], &m)
@@ -582,3 +587,54 @@ func assertJSONField(t *testing.T, data []byte, field, expected string) {
 		t.Errorf("assertJSONField: %s=%v, want %s", field, got, expected)
 	}
 }
+
+// ─── Thinking signatures ────────────────────────────────────────────────────
+
+func TestStreamConverter_GeminiSignatureToAnthropic(t *testing.T) {
+	conv, err := NewStreamConverter(StyleGoogleGenAI, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs, err := conv.Push([]byte(`{"candidates":[{"content":{"role":"model","parts":[` +
+		`{"text":"Plan.","thought":true},{"functionCall":{"name":"a","args":{}},"thoughtSignature":"c2ln"}]}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, out := range outputs {
+		var ev struct {
+			Type  string
+			Delta map[string]string
+		}
+		json.Unmarshal(out, &ev)
+		got = append(got, ev.Type+"/"+ev.Delta["type"])
+	}
+	want := "content_block_start/ content_block_delta/thinking_delta content_block_delta/signature_delta content_block_stop/ " +
+		"content_block_start/ content_block_delta/input_json_delta"
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("events:\n got %s\nwant %s", s, want)
+	}
+}
+
+func TestStreamConverter_AnthropicSignatureToGemini(t *testing.T) {
+	conv, err := NewStreamConverter(StyleAnthropic, StyleGoogleGenAI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.Push([]byte(`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Hm"}}`))
+	outputs, err := conv.Push([]byte(`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"c2ln"}}`))
+	if err != nil || len(outputs) != 1 {
+		t.Fatalf("outputs = %d (%v)", len(outputs), err)
+	}
+	if !strings.Contains(string(outputs[0]), `"thoughtSignature":"c2ln"`) {
+		t.Errorf("chunk = %s", outputs[0])
+	}
+
+	chat, err := NewStreamConverter(StyleAnthropic, StyleChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs, _ := chat.Push([]byte(`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"c2ln"}}`)); len(outputs) != 0 {
+		t.Errorf("chat target: got %d outputs", len(outputs))
+	}
+}
@@ -0,0 +1,175 @@
+package ail
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// ─── Stream synthesis ────────────────────────────────────────────────────────
+
+// DefaultSynthesizeChunkSize is the number of runes per text or thinking
+// delta when SynthesizeOptions.ChunkSize is zero.
+const DefaultSynthesizeChunkSize = 32
+
+// SynthesizeOptions controls how SynthesizeStream splits a response.
+type SynthesizeOptions struct {
+	// ChunkSize is the maximum number of runes per STREAM_DELTA or
+	// STREAM_THINK_DELTA. Zero means DefaultSynthesizeChunkSize; a negative
+	// value sends each text run in a single delta.
+	ChunkSize int
+
+	// ArgsChunkSize is the maximum number of bytes (rounded to whole runes)
+	// per tool-argument delta. Zero sends the arguments in one delta.
+	ArgsChunkSize int
+
+	// WholeToolCalls sends each tool call as a single STREAM_TOOL_DELTA
+	// carrying id, name and complete arguments, as Google GenAI expects.
+	// Otherwise a call is a header delta (index, id, name) followed by
+	// argument deltas, as Anthropic expects. A StreamConverter targeting
+	// Google GenAI reassembles split calls on its own.
+	WholeToolCalls bool
+}
+
+// SynthesizeStream turns a complete response program into the sequence of
+// stream programs a provider would have sent for it:
+//
+//	STREAM_START
+//	STREAM_THINK_DELTA… STREAM_THINK_SIG / STREAM_DELTA… / STREAM_TOOL_DELTA…   (content order)
+//	RESP_DONE + USAGE
+//	STREAM_END
+//
+// Every program carries RESP_ID and RESP_MODEL and holds exactly one event,
+// so each renders to one chunk with any StreamChunkEmitter, and Anthropic
+// output follows message_start → deltas → message_delta → message_stop.
+// Tool deltas are indexed by the call's position among the tool calls.
+//
+// Use it to serve streaming clients from a cached or non-streaming upstream
+// response.
+func SynthesizeStream(resp *Program, opts SynthesizeOptions) ([]*Program, error) {
+	conv, err := resp.Decompile()
+	if err != nil {
+		return nil, err
+	}
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = DefaultSynthesizeChunkSize
+	}
+
+	var meta []Instruction
+	if conv.ResponseID != "" {
+		meta = append(meta, Instruction{Op: RESP_ID, Str: conv.ResponseID})
+	}
+	if conv.ResponseModel != "" {
+		meta = append(meta, Instruction{Op: RESP_MODEL, Str: conv.ResponseModel})
+	}
+	var out []*Program
+	event := func(insts ...Instruction) {
+		p := NewProgram()
+		p.Code = append(append(p.Code, meta...), insts...)
+		out = append(out, p)
+	}
+
+	event(Instruction{Op: STREAM_START})
+	finish, native := conv.FinishReason, conv.FinishNative
+	tools := 0
+	for _, m := range conv.Messages {
+		if m.FinishReason != "" {
+			finish, native = m.FinishReason, m.FinishNative
+		}
+		for _, part := range m.Parts {
+			switch part.Type {
+			case PartText:
+				for _, s := range splitRunes(part.Text, opts.ChunkSize) {
+					event(Instruction{Op: STREAM_DELTA, Str: s})
+				}
+			case PartThinking:
+				for _, s := range splitRunes(part.Text, opts.ChunkSize) {
+					event(Instruction{Op: STREAM_THINK_DELTA, Str: s})
+				}
+				if len(part.Data) > 0 {
+					event(Instruction{Op: STREAM_THINK_SIG, Str: string(part.Data)})
+				}
+			case PartToolCall:
+				args := string(part.Args)
+				if args == "" {
+					args = "{}"
+				}
+				if opts.WholeToolCalls {
+					event(toolDelta(map[string]any{"index": tools, "id": part.CallID, "name": part.Name, "arguments": args}))
+				} else {
+					event(toolDelta(map[string]any{"index": tools, "id": part.CallID, "name": part.Name}))
+					size := opts.ArgsChunkSize
+					if size <= 0 {
+						size = len(args)
+					}
+					for _, s := range splitBytes(args, size) {
+						event(toolDelta(map[string]any{"index": tools, "arguments": s}))
+					}
+				}
+				tools++
+			}
+		}
+	}
+
+	if finish == "" {
+		finish = "stop"
+		if tools > 0 {
+			finish = "tool_calls"
+		}
+	}
+	done := []Instruction{{Op: RESP_DONE, Str: finish, Key: native.Value, NS: native.NS}}
+	if len(conv.Usage) > 0 {
+		done = append(done, Instruction{Op: USAGE, JSON: cloneRaw(conv.Usage)})
+	}
+	event(done...)
+	event(Instruction{Op: STREAM_END})
+	return out, nil
+}
+
+func toolDelta(td map[string]any) Instruction {
+	j, _ := json.Marshal(td)
+	return Instruction{Op: STREAM_TOOL_DELTA, JSON: j}
+}
+
+// splitRunes splits s into pieces of at most n runes; n < 0 means no split.
+// An empty string yields no pieces.
+func splitRunes(s string, n int) []string {
+	if s == "" {
+		return nil
+	}
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return []string{s}
+	}
+	var out []string
+	for len(s) > 0 {
+		i, count := 0, 0
+		for i < len(s) && count < n {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+			count++
+		}
+		out = append(out, s[:i])
+		s = s[i:]
+	}
+	return out
+}
+
+// splitBytes splits s into pieces of at most n bytes without breaking runes
+// (a piece may exceed n only to hold a single wide rune).
+func splitBytes(s string, n int) []string {
+	var out []string
+	for len(s) > n {
+		i := n
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		if i == 0 {
+			_, i = utf8.DecodeRuneInString(s)
+		}
+		out = append(out, s[:i])
+		s = s[i:]
+	}
+	if s != "" {
+		out = append(out, s)
+	}
+	return out
+}
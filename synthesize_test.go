@@ -0,0 +1,146 @@
+package ail
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func synthResponse() *Program {
+	return Build().ResponseID("msg_1").ResponseModel("m").
+		Usage(map[string]int{"prompt_tokens": 5, "completion_tokens": 9, "total_tokens": 14}).
+		Assistant(
+			Thinking("Let me think about this carefully.", "c2ln"),
+			Text("Héllo wörld, this is a longer answer."),
+			ToolCall("call_1", "lookup", map[string]string{"q": "ünïcode"}),
+		).
+		Done("tool_calls").
+		MustProgram()
+}
+
+func TestSynthesizeRoundTrip(t *testing.T) {
+	resp := synthResponse()
+	progs, err := SynthesizeStream(resp, SynthesizeOptions{ChunkSize: 5, ArgsChunkSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progs[0].Code[len(progs[0].Code)-1].Op != STREAM_START {
+		t.Errorf("first program:\n%s", progs[0].Disasm())
+	}
+	acc := NewAccumulator()
+	for _, p := range progs {
+		if p.FindAll(RESP_ID) == nil {
+			t.Errorf("program without RESP_ID:\n%s", p.Disasm())
+		}
+		if err := acc.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !acc.Done() {
+		t.Error("no STREAM_END")
+	}
+	if d := Diff(resp, acc.Program()); !d.Equal() {
+		t.Errorf("round trip differs:\n%s", d)
+	}
+
+	var deltas int
+	for _, p := range progs {
+		if p.HasOpcode(STREAM_DELTA) {
+			deltas++
+			if n := len([]rune(p.Code[p.FindAll(STREAM_DELTA)[0]].Str)); n > 5 {
+				t.Errorf("delta of %d runes", n)
+			}
+		}
+	}
+	if deltas != 8 {
+		t.Errorf("expected 8 text deltas, got %d", deltas)
+	}
+}
+
+func TestSynthesizeAnthropicOrdering(t *testing.T) {
+	progs, err := SynthesizeStream(synthResponse(), SynthesizeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, err := NewStreamConverter(StyleAnthropic, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outputs [][]byte
+	for _, p := range progs {
+		out, err := conv.PushProgram(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, out...)
+	}
+	var types []string
+	for _, out := range outputs {
+		var ev struct {
+			Type  string         `json:"type"`
+			Usage map[string]int `json:"usage"`
+		}
+		if err := json.Unmarshal(out, &ev); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, ev.Type)
+		if ev.Type == "message_delta" && ev.Usage == nil {
+			t.Error("usage missing from message_delta")
+		}
+	}
+	want := "message_start " +
+		"content_block_start content_block_delta content_block_delta content_block_delta content_block_stop " +
+		"content_block_start content_block_delta content_block_delta content_block_stop " +
+		"content_block_start content_block_delta content_block_stop message_delta message_stop"
+	if got := strings.Join(types, " "); got != want {
+		t.Errorf("events:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestSynthesizeWholeToolCalls(t *testing.T) {
+	progs, err := SynthesizeStream(synthResponse(), SynthesizeOptions{ChunkSize: -1, WholeToolCalls: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progs) != 7 { // start, think, signature, text, tool, done, end
+		t.Fatalf("got %d programs", len(progs))
+	}
+	out, err := (&GoogleGenAIEmitter{}).EmitStreamChunk(progs[4])
+	if err != nil || !strings.Contains(string(out), `"functionCall":{"args":{"q":"ünïcode"},"name":"lookup"}`) {
+		t.Errorf("gemini tool chunk = %s (%v)", out, err)
+	}
+
+	if _, err := SynthesizeStream(progs[1], SynthesizeOptions{}); err == nil {
+		t.Error("expected error for a stream program")
+	}
+}
+
+func TestSynthesizeResponsesReasoning(t *testing.T) {
+	body, err := os.ReadFile("fixtures/responses/response/reasoning.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&ResponsesParser{}).ParseResponse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	progs, err := SynthesizeStream(resp, SynthesizeOptions{ChunkSize: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, p := range progs {
+		ops = append(ops, p.Code[len(p.Code)-1].Op.String())
+	}
+	want := "STREAM_START STREAM_THINK_DELTA STREAM_DELTA USAGE STREAM_END"
+	if got := strings.Join(ops, " "); got != want {
+		t.Fatalf("events:\n got %s\nwant %s", got, want)
+	}
+	if got := progs[1].Code[len(progs[1].Code)-1].Str; got != "The user asks for 6 times 7." {
+		t.Errorf("thinking delta = %q", got)
+	}
+	if got := progs[2].Code[len(progs[2].Code)-1].Str; got != "6 × 7 = 42." {
+		t.Errorf("text delta = %q", got)
+	}
+}
@@ -0,0 +1,417 @@
+package ail
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ─── Tokenizers ──────────────────────────────────────────────────────────────
+
+// Tokenizer counts the tokens a model would see for a piece of text.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// TokenizerFunc adapts a function to the Tokenizer interface.
+type TokenizerFunc func(text string) int
+
+// CountTokens calls f(text).
+func (f TokenizerFunc) CountTokens(text string) int { return f(text) }
+
+// CharTokenizer approximates tokens as characters divided by CharsPerToken
+// (rounded up). About 4 characters per token holds for English text on
+// current OpenAI and Anthropic vocabularies.
+type CharTokenizer struct {
+	CharsPerToken float64 // <= 0 means 4
+}
+
+// CountTokens implements Tokenizer.
+func (t CharTokenizer) CountTokens(text string) int {
+	ratio := t.CharsPerToken
+	if ratio <= 0 {
+		ratio = 4
+	}
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / ratio))
+}
+
+// WordTokenizer approximates tokens from word and punctuation counts
+// (TokensPerWord per word, one per punctuation rune). It is more stable
+// than CharTokenizer for code and text with long words.
+type WordTokenizer struct {
+	TokensPerWord float64 // <= 0 means 4/3
+}
+
+// CountTokens implements Tokenizer.
+func (t WordTokenizer) CountTokens(text string) int {
+	per := t.TokensPerWord
+	if per <= 0 {
+		per = 4.0 / 3.0
+	}
+	words, punct := 0, 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				words++
+				inWord = true
+			}
+		case unicode.IsSpace(r):
+			inWord = false
+		default:
+			punct++
+			inWord = false
+		}
+	}
+	return int(math.Ceil(float64(words)*per)) + punct
+}
+
+// DefaultTokenizer is used by EstimateTokens and by FitToBudget when the
+// policy does not name a tokenizer.
+var DefaultTokenizer Tokenizer = CharTokenizer{}
+
+// ─── BPE ─────────────────────────────────────────────────────────────────────
+
+// bpePattern approximates the cl100k/o200k pre-tokenizer without the
+// lookahead Go's regexp does not support.
+var bpePattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// BPETokenizer is a byte-level BPE tokenizer using a tiktoken-format
+// vocabulary: one "<base64 token> <rank>" pair per line, as in the
+// cl100k_base.tiktoken and o200k_base.tiktoken files.
+type BPETokenizer struct {
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// NewBPETokenizer reads a tiktoken-format vocabulary from r.
+func NewBPETokenizer(r io.Reader) (*BPETokenizer, error) {
+	t := &BPETokenizer{ranks: make(map[string]int), pattern: bpePattern}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		tok, rankStr, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("ail: bpe vocab line %d: expected \"<token> <rank>\"", lineNo)
+		}
+		b, err := base64.StdEncoding.DecodeString(tok)
+		if err != nil {
+			return nil, fmt.Errorf("ail: bpe vocab line %d: %w", lineNo, err)
+		}
+		rank, err := strconv.Atoi(strings.TrimSpace(rankStr))
+		if err != nil {
+			return nil, fmt.Errorf("ail: bpe vocab line %d: %w", lineNo, err)
+		}
+		t.ranks[string(b)] = rank
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("ail: read bpe vocab: %w", err)
+	}
+	if len(t.ranks) == 0 {
+		return nil, errors.New("ail: bpe vocab is empty")
+	}
+	return t, nil
+}
+
+// LoadBPETokenizer reads a tiktoken-format vocabulary file from disk.
+func LoadBPETokenizer(path string) (*BPETokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ail: open bpe vocab: %w", err)
+	}
+	defer f.Close()
+	return NewBPETokenizer(f)
+}
+
+// WithPattern returns a copy of t that splits text with the given
+// pre-tokenizer pattern instead of the built-in approximation.
+func (t *BPETokenizer) WithPattern(re *regexp.Regexp) *BPETokenizer {
+	return &BPETokenizer{ranks: t.ranks, pattern: re}
+}
+
+// CountTokens implements Tokenizer.
+func (t *BPETokenizer) CountTokens(text string) int {
+	n := 0
+	for _, piece := range t.pattern.FindAllString(text, -1) {
+		if _, ok := t.ranks[piece]; ok {
+			n++
+			continue
+		}
+		n += len(t.merge([]byte(piece)))
+	}
+	return n
+}
+
+// merge applies byte-pair merges to piece, lowest rank first, and returns
+// the resulting parts. Bytes missing from the vocabulary stay single parts.
+func (t *BPETokenizer) merge(piece []byte) [][]byte {
+	parts := make([][]byte, len(piece))
+	for i := range piece {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i < len(parts)-1; i++ {
+			joined := piece[offset(piece, parts[i]) : offset(piece, parts[i+1])+len(parts[i+1])]
+			if r, ok := t.ranks[string(joined)]; ok && r < bestRank {
+				best, bestRank = i, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		start := offset(piece, parts[best])
+		parts[best] = piece[start : offset(piece, parts[best+1])+len(parts[best+1])]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return parts
+}
+
+// offset returns the index of sub within piece; sub must be a subslice.
+func offset(piece, sub []byte) int {
+	return cap(piece) - cap(sub)
+}
+
+// ─── Estimation ──────────────────────────────────────────────────────────────
+
+// Fixed per-element costs used by EstimateTokens. They approximate provider
+// framing overhead and are intentionally conservative.
+const (
+	TokensPerMessage = 4   // role and delimiters
+	TokensPerTool    = 8   // tool-definition framing
+	TokensPerImage   = 765 // a 1024×1024 image at high detail (OpenAI)
+	TokensPerAudio   = 250 // a short audio clip
+)
+
+// EstimateTokens estimates the prompt size of the program with
+// DefaultTokenizer.
+func (p *Program) EstimateTokens() int {
+	return p.EstimateTokensWith(DefaultTokenizer)
+}
+
+// EstimateTokensWith estimates the prompt size of the program: the text of
+// messages, thinking, tool calls, results and definitions counted by tok,
+// plus the fixed per-element costs above.
+func (p *Program) EstimateTokensWith(tok Tokenizer) int {
+	return p.rangeTokens(tok, 0, len(p.Code)-1)
+}
+
+// rangeTokens estimates the tokens of instructions [start, end].
+func (p *Program) rangeTokens(tok Tokenizer, start, end int) int {
+	n := 0
+	for i := start; i <= end && i < len(p.Code); i++ {
+		inst := p.Code[i]
+		switch inst.Op {
+		case MSG_START:
+			n += TokensPerMessage
+		case DEF_NAME:
+			n += TokensPerTool + tok.CountTokens(inst.Str)
+		case TXT_CHUNK, THINK_CHUNK, RESULT_DATA, DEF_DESC, CALL_NAME:
+			n += tok.CountTokens(inst.Str)
+		case DEF_SCHEMA, CALL_ARGS:
+			n += tok.CountTokens(string(inst.JSON))
+		case TXT_REF:
+			if int(inst.Ref) < len(p.Buffers) {
+				n += tok.CountTokens(string(p.Buffers[inst.Ref]))
+			}
+		case IMG_REF:
+			n += TokensPerImage
+		case AUD_REF:
+			n += TokensPerAudio
+		}
+	}
+	return n
+}
+
+// ─── Context-window fitting ──────────────────────────────────────────────────
+
+// ErrOverBudget is returned (wrapped) by FitToBudget when the program cannot
+// be brought under budget without dropping content it must keep.
+var ErrOverBudget = errors.New("ail: program exceeds token budget")
+
+// Summarizer condenses dropped conversation turns into text. The program
+// passed to Summarize contains only the dropped messages (buffers shared).
+type Summarizer interface {
+	Summarize(dropped *Program) (string, error)
+}
+
+// SummarizerFunc adapts a function to the Summarizer interface.
+type SummarizerFunc func(dropped *Program) (string, error)
+
+// Summarize calls f(dropped).
+func (f SummarizerFunc) Summarize(dropped *Program) (string, error) { return f(dropped) }
+
+// FitPolicy configures FitToBudget.
+type FitPolicy struct {
+	// Tokenizer counts text; nil means DefaultTokenizer.
+	Tokenizer Tokenizer
+
+	// Summarizer, if set, replaces dropped turns with a system message
+	// holding its summary, placed after the leading system prompts.
+	// Otherwise dropped turns are simply removed.
+	Summarizer Summarizer
+}
+
+// turn is an atomic unit for FitToBudget: one message, or an assistant
+// message with tool calls together with the messages carrying its results.
+type turn struct {
+	start, end int // inclusive instruction range
+	tokens     int
+}
+
+// FitToBudget returns a new program whose EstimateTokensWith(policy
+// tokenizer) is at most budget, dropping the oldest turns first.
+//
+// System messages, tool definitions and configuration are always kept, as
+// is the final turn. A tool call is never separated from its results: an
+// assistant message with calls and the following messages that carry the
+// matching results are dropped together. If the program still exceeds the
+// budget after every droppable turn is gone, the trimmed program is returned
+// along with an error wrapping ErrOverBudget.
+func (p *Program) FitToBudget(budget int, policy FitPolicy) (*Program, error) {
+	tok := policy.Tokenizer
+	if tok == nil {
+		tok = DefaultTokenizer
+	}
+	total := p.EstimateTokensWith(tok)
+	if total <= budget {
+		return p.Clone(), nil
+	}
+
+	turns := p.turns(tok)
+	dropped := 0
+	build := func() (*Program, int, error) {
+		out := p.dropTurns(turns[:dropped])
+		if policy.Summarizer == nil || dropped == 0 {
+			return out, out.EstimateTokensWith(tok), nil
+		}
+		summary, err := policy.Summarizer.Summarize(p.turnsProgram(turns[:dropped]))
+		if err != nil {
+			return nil, 0, fmt.Errorf("ail: summarize dropped turns: %w", err)
+		}
+		out = out.insertAfterSystem(summary)
+		return out, out.EstimateTokensWith(tok), nil
+	}
+
+	remaining := total
+	for dropped = 1; dropped < len(turns); dropped++ {
+		remaining -= turns[dropped-1].tokens
+		last := dropped == len(turns)-1
+		if remaining > budget && !last {
+			continue // cheaply skip builds that cannot fit
+		}
+		out, n, err := build()
+		if err != nil {
+			return nil, err
+		}
+		if n <= budget {
+			return out, nil
+		}
+		if last {
+			return out, fmt.Errorf("%w: %d tokens after trimming, budget %d", ErrOverBudget, n, budget)
+		}
+	}
+	return p.Clone(), fmt.Errorf("%w: %d tokens, nothing left to drop, budget %d", ErrOverBudget, total, budget)
+}
+
+// turns groups non-system messages into atomic turns.
+func (p *Program) turns(tok Tokenizer) []turn {
+	var out []turn
+	pending := map[string]bool{} // call IDs of the last turn awaiting results
+	for _, m := range p.Messages() {
+		if m.Role == ROLE_SYS {
+			continue
+		}
+		calls, results := map[string]bool{}, false
+		for i := m.Start; i <= m.End; i++ {
+			switch p.Code[i].Op {
+			case CALL_START:
+				calls[p.Code[i].Str] = true
+			case RESULT_START:
+				if pending[p.Code[i].Str] || len(pending) > 0 && p.Code[i].Str == "" {
+					results = true
+				}
+			}
+		}
+		t := turn{start: m.Start, end: m.End, tokens: p.rangeTokens(tok, m.Start, m.End)}
+		if results && len(out) > 0 {
+			last := &out[len(out)-1]
+			last.end = m.End
+			last.tokens += t.tokens
+		} else {
+			out = append(out, t)
+			pending = map[string]bool{}
+		}
+		for id := range calls {
+			pending[id] = true
+		}
+	}
+	return out
+}
+
+// dropTurns returns a copy of p without the message instructions of turns.
+// Non-message instructions inside a turn's range (there are none in
+// well-formed programs) are kept.
+func (p *Program) dropTurns(turns []turn) *Program {
+	drop := make(map[int]bool)
+	for _, m := range p.Messages() {
+		for _, t := range turns {
+			if m.Start >= t.start && m.End <= t.end && m.Role != ROLE_SYS {
+				for i := m.Start; i <= m.End; i++ {
+					drop[i] = true
+				}
+			}
+		}
+	}
+	result := NewProgram()
+	for i, inst := range p.Code {
+		if !drop[i] {
+			result.Code = append(result.Code, cloneInstruction(inst))
+		}
+	}
+	result.Buffers = cloneBuffers(p.Buffers)
+	return result
+}
+
+// turnsProgram returns the messages of turns as a standalone program.
+func (p *Program) turnsProgram(turns []turn) *Program {
+	result := NewProgram()
+	for _, t := range turns {
+		for i := t.start; i <= t.end; i++ {
+			result.Code = append(result.Code, cloneInstruction(p.Code[i]))
+		}
+	}
+	result.Buffers = cloneBuffers(p.Buffers)
+	return result
+}
+
+// insertAfterSystem inserts a system message with text after the leading
+// system messages (or before the first message).
+func (p *Program) insertAfterSystem(text string) *Program {
+	msg := []Instruction{{Op: MSG_START}, {Op: ROLE_SYS}, {Op: TXT_CHUNK, Str: text}, {Op: MSG_END}}
+	if sys := p.SystemPrompts(); len(sys) > 0 {
+		return p.InsertAfter(sys[len(sys)-1].End, msg...)
+	}
+	if msgs := p.Messages(); len(msgs) > 0 {
+		return p.InsertBefore(msgs[0].Start, msg...)
+	}
+	result := p.Clone()
+	result.Code = append(result.Code, msg...)
+	return result
+}
@@ -0,0 +1,156 @@
+package ail
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApproxTokenizers(t *testing.T) {
+	if got := (CharTokenizer{}).CountTokens("abcdefgh"); got != 2 {
+		t.Errorf("char tokens = %d, want 2", got)
+	}
+	if got := (CharTokenizer{CharsPerToken: 2}).CountTokens("abcde"); got != 3 {
+		t.Errorf("char tokens (ratio 2) = %d, want 3", got)
+	}
+	if got := (WordTokenizer{TokensPerWord: 1}).CountTokens("hello, big world!"); got != 5 {
+		t.Errorf("word tokens = %d, want 5", got)
+	}
+}
+
+func TestBPETokenizer(t *testing.T) {
+	var vocab strings.Builder
+	for rank, tok := range []string{" ", "a", "b", "c", "ab", "abc"} {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), rank)
+	}
+	path := filepath.Join(t.TempDir(), "tiny.tiktoken")
+	if err := os.WriteFile(path, []byte(vocab.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, err := LoadBPETokenizer(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// "abc" is a whole token; " abc" merges to " " + "abc"; "cab" to "c" + "ab".
+	cases := map[string]int{"abc": 1, "abc abc": 3, "cab": 2, "": 0, "zz": 2}
+	for in, want := range cases {
+		if got := tok.CountTokens(in); got != want {
+			t.Errorf("CountTokens(%q) = %d, want %d", in, got, want)
+		}
+	}
+
+	if _, err := NewBPETokenizer(strings.NewReader("not-base64! 1\n")); err == nil {
+		t.Error("expected error for malformed vocab")
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	p := Build().
+		Tools(Func("f", "", nil)).
+		User(Text("abcdefgh"), Image([]byte("x"), "image/png")).
+		MustProgram()
+	// 8 (tool) + 1 ("f") + 4 (message) + 2 (text) + TokensPerImage
+	if got, want := p.EstimateTokens(), 8+1+4+2+TokensPerImage; got != want {
+		t.Errorf("EstimateTokens = %d, want %d", got, want)
+	}
+}
+
+// longTurns builds: system, then n user/assistant exchanges, with a tool
+// call in the middle that must stay with its result.
+func longTurns() *Program {
+	filler := strings.Repeat("x", 400) // 100 tokens
+	return Build().
+		Tools(Func("lookup", "Look up", nil)).
+		System("sys").
+		User(Text("u0 " + filler)).
+		Assistant(Text("a0 " + filler)).
+		User(Text("u1 " + filler)).
+		Assistant(ToolCall("c1", "lookup", map[string]string{"q": filler})).
+		Tool(Result("c1", filler)).
+		Assistant(Text("a1 " + filler)).
+		User(Text("u2 " + filler)).
+		MustProgram()
+}
+
+func TestFitToBudgetKeepsPairs(t *testing.T) {
+	p := longTurns()
+	total := p.EstimateTokens()
+
+	for budget := total; budget > 0; budget -= 50 {
+		out, err := p.FitToBudget(budget, FitPolicy{})
+		if err != nil {
+			if !errors.Is(err, ErrOverBudget) {
+				t.Fatalf("budget %d: %v", budget, err)
+			}
+		} else if n := out.EstimateTokens(); n > budget {
+			t.Fatalf("budget %d: result has %d tokens", budget, n)
+		}
+		calls, results := len(out.ToolCalls()), len(out.ToolResults())
+		if calls != results {
+			t.Fatalf("budget %d: %d calls but %d results", budget, calls, results)
+		}
+		if out.SystemPrompt() != "sys" || len(out.ToolDefs()) != 1 {
+			t.Fatalf("budget %d: system prompt or tools dropped", budget)
+		}
+		msgs := out.Messages()
+		if last := msgs[len(msgs)-1]; !strings.HasPrefix(out.MessageText(last), "u2") {
+			t.Fatalf("budget %d: final turn dropped", budget)
+		}
+	}
+}
+
+func TestFitToBudgetSummarizes(t *testing.T) {
+	p := longTurns()
+	var summarized int
+	out, err := p.FitToBudget(400, FitPolicy{
+		Summarizer: SummarizerFunc(func(dropped *Program) (string, error) {
+			summarized = dropped.CountMessages()
+			return "summary", nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("fit: %v", err)
+	}
+	if summarized == 0 {
+		t.Fatal("summarizer not called")
+	}
+	sys := out.MessagesByRole(ROLE_SYS)
+	if len(sys) != 2 || out.MessageText(sys[1]) != "summary" {
+		t.Fatalf("summary message missing:\n%s", out.Disasm())
+	}
+	if out.CountMessages() != p.CountMessages()-summarized+1 {
+		t.Errorf("message count = %d", out.CountMessages())
+	}
+}
+
+func TestFitToBudgetCopiesBuffers(t *testing.T) {
+	p := longTurns().Append(Build().User(Image([]byte("aW1n"), "image/png")).MustProgram())
+	var dropped *Program
+	out, err := p.FitToBudget(400+TokensPerImage, FitPolicy{
+		Summarizer: SummarizerFunc(func(d *Program) (string, error) {
+			dropped = d
+			return "summary", nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("fit: %v", err)
+	}
+	out.Buffers[0][0] = 'X'
+	dropped.Buffers[0][1] = 'X'
+	if string(p.Buffers[0]) != "aW1n" {
+		t.Errorf("FitToBudget shares buffers with its input: %q", p.Buffers[0])
+	}
+}
+
+func TestFitToBudgetUnderBudget(t *testing.T) {
+	p := longTurns()
+	out, err := p.FitToBudget(1<<20, FitPolicy{})
+	if err != nil || out.CountMessages() != p.CountMessages() {
+		t.Fatalf("unexpected trim: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package ail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// ─── Tool call IDs ───────────────────────────────────────────────────────────
+
+// ToolCallKey describes a tool call that arrived without an ID (Google
+// GenAI functionCall parts have none).
+type ToolCallKey struct {
+	Seed  string // response ID when known, else ""
+	Index int    // position among the calls of the program or stream
+	Name  string // tool name
+	Args  string // arguments as JSON, if known when the ID is needed
+}
+
+// ToolIDFunc returns the ID for a tool call without one. It must be
+// deterministic, so that the same conversation history gets the same IDs on
+// every turn (which also keeps provider prompt caches warm).
+type ToolIDFunc func(key ToolCallKey) string
+
+// HashToolIDs returns a ToolIDFunc producing prefix followed by 24 hex
+// digits of a hash of the key, e.g. HashToolIDs("call_") for OpenAI-style
+// IDs.
+func HashToolIDs(prefix string) ToolIDFunc {
+	return func(key ToolCallKey) string {
+		h := sha256.New()
+		for _, s := range []string{key.Seed, strconv.Itoa(key.Index), key.Name, key.Args} {
+			h.Write([]byte(s))
+			h.Write([]byte{0})
+		}
+		return prefix + hex.EncodeToString(h.Sum(nil))[:24]
+	}
+}
+
+// DefaultToolIDs returns the ToolIDFunc used for a target style: IDs in
+// the shape the provider issues itself ("toolu_…" for Anthropic, "call_…"
+// otherwise).
+func DefaultToolIDs(style Style) ToolIDFunc {
+	if style == StyleAnthropic {
+		return HashToolIDs("toolu_")
+	}
+	return HashToolIDs("call_")
+}
+
+// AssignToolIDs gives every tool call without an ID one from fn and points
+// the tool results that refer to no known call ID (Google GenAI
+// functionResponse parts name the function instead) at the matching calls.
+// Such a result is matched to the earliest unanswered call of that name, or
+// to the earliest unanswered call when it names none. Results already
+// carrying a known call ID are left alone. The program is returned unchanged
+// when every call has an ID and every result refers to one; otherwise a
+// modified copy is returned. Emitters for targets that need IDs apply this
+// themselves.
+func (p *Program) AssignToolIDs(fn ToolIDFunc) *Program {
+	type call struct {
+		id, name string
+		answered bool
+	}
+	ids := make(map[string]bool)
+	missing := false
+	for _, inst := range p.Code {
+		switch inst.Op {
+		case CALL_START:
+			ids[inst.Str] = true
+			missing = missing || inst.Str == ""
+		case RESULT_START:
+			missing = missing || !ids[inst.Str]
+		}
+	}
+	if !missing {
+		return p
+	}
+
+	out := p.Clone()
+	var (
+		calls []*call
+		byID  = make(map[string]*call)
+		seed  string
+	)
+
+	for i, inst := range out.Code {
+		switch inst.Op {
+		case RESP_ID:
+			seed = inst.Str
+		case CALL_START:
+			c := &call{id: inst.Str}
+			args := ""
+		body:
+			for _, next := range out.Code[i+1:] {
+				switch next.Op {
+				case CALL_NAME:
+					c.name = next.Str
+				case CALL_ARGS:
+					args = string(next.JSON)
+				case CALL_END, CALL_START:
+					break body
+				}
+			}
+			if c.id == "" {
+				c.id = fn(ToolCallKey{Seed: seed, Index: len(calls), Name: c.name, Args: args})
+				out.Code[i].Str = c.id
+			}
+			calls = append(calls, c)
+			byID[c.id] = c
+		case RESULT_START:
+			if c, ok := byID[inst.Str]; ok {
+				c.answered = true
+				continue
+			}
+			for _, c := range calls {
+				if !c.answered && (inst.Str == "" || c.name == inst.Str) {
+					c.answered = true
+					out.Code[i].Str = c.id
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+// toolCallNames maps the IDs of the program's tool calls to their names,
+// for targets that refer to calls by name (Google GenAI).
+func toolCallNames(p *Program) map[string]string {
+	names := make(map[string]string)
+	id := ""
+	for _, inst := range p.Code {
+		switch inst.Op {
+		case CALL_START:
+			id = inst.Str
+		case CALL_NAME:
+			if id != "" {
+				names[id] = inst.Str
+			}
+		}
+	}
+	return names
+}
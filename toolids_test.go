@@ -0,0 +1,284 @@
+package ail
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const geminiToolRequest = `{
+  "contents": [
+    {"role": "user", "parts": [{"text": "Weather in Paris and Rome, and the time?"}]},
+    {"role": "model", "parts": [
+      {"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}},
+      {"functionCall": {"name": "get_time", "args": {}}},
+      {"functionCall": {"name": "get_weather", "args": {"city": "Rome"}}}
+    ]},
+    {"role": "function", "parts": [
+      {"functionResponse": {"name": "get_time", "response": {"time": "12:00"}}},
+      {"functionResponse": {"name": "get_weather", "response": {"temp": 18}}},
+      {"functionResponse": {"name": "get_weather", "response": {"temp": 22}}}
+    ]}
+  ]
+}`
+
+func TestToolIDsGeminiToChat(t *testing.T) {
+	out, err := ConvertRequest([]byte(geminiToolRequest), StyleGoogleGenAI, StyleChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req struct {
+		Messages []struct {
+			Role      string `json:"role"`
+			ToolCalls []struct {
+				ID       string `json:"id"`
+				Function struct {
+					Name string `json:"name"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+			ToolCallID string `json:"tool_call_id"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(out, &req); err != nil {
+		t.Fatal(err)
+	}
+	var calls, results []string
+	for _, m := range req.Messages {
+		for _, tc := range m.ToolCalls {
+			if !strings.HasPrefix(tc.ID, "call_") {
+				t.Errorf("call ID %q lacks call_ prefix", tc.ID)
+			}
+			calls = append(calls, tc.ID)
+		}
+		if m.Role == "tool" {
+			results = append(results, m.ToolCallID)
+		}
+	}
+	if len(calls) != 3 || calls[0] == calls[2] {
+		t.Fatalf("calls = %v\n%s", calls, out)
+	}
+	// get_time answers the second call; the get_weather results go to the
+	// weather calls in order.
+	if want := []string{calls[1], calls[0], calls[2]}; strings.Join(results, ",") != strings.Join(want, ",") {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+
+	// The same history gets the same IDs on every turn.
+	again, _ := ConvertRequest([]byte(geminiToolRequest), StyleGoogleGenAI, StyleChatCompletions)
+	if string(again) != string(out) {
+		t.Errorf("IDs are not deterministic:\n%s\n%s", out, again)
+	}
+}
+
+func TestToolIDsAnthropicRoundTripThroughGemini(t *testing.T) {
+	prog, err := (&GoogleGenAIParser{}).ParseRequest([]byte(geminiToolRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := (&AnthropicEmitter{}).EmitRequest(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"id":"toolu_`) {
+		t.Errorf("Anthropic request lacks toolu_ IDs:\n%s", out)
+	}
+
+	// Back to Gemini: results refer to calls by name again.
+	back, err := ConvertRequest(out, StyleAnthropic, StyleGoogleGenAI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req struct {
+		Contents []struct {
+			Parts []struct {
+				FunctionResponse *struct {
+					Name string `json:"name"`
+				} `json:"functionResponse"`
+			} `json:"parts"`
+		} `json:"contents"`
+	}
+	if err := json.Unmarshal(back, &req); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range req.Contents {
+		for _, p := range c.Parts {
+			if p.FunctionResponse != nil {
+				names = append(names, p.FunctionResponse.Name)
+			}
+		}
+	}
+	if got := strings.Join(names, ","); got != "get_time,get_weather,get_weather" {
+		t.Errorf("functionResponse names = %s\n%s", got, back)
+	}
+}
+
+func TestToolIDsCustomFunc(t *testing.T) {
+	prog, err := (&GoogleGenAIParser{}).ParseRequest([]byte(geminiToolRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &ChatCompletionsEmitter{ToolIDs: func(k ToolCallKey) string {
+		return k.Name + "-" + string(rune('a'+k.Index))
+	}}
+	out, err := e.EmitRequest(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"id":"get_weather-a"`, `"id":"get_time-b"`, `"tool_call_id":"get_weather-c"`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("missing %s in:\n%s", want, out)
+		}
+	}
+	// The parsed program itself is left unchanged.
+	for _, i := range prog.FindAll(CALL_START) {
+		if prog.Code[i].Str != "" {
+			t.Errorf("AssignToolIDs modified its input")
+		}
+	}
+}
+
+func TestToolIDsGeminiResponse(t *testing.T) {
+	body := `{"responseId":"r1","candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},"finishReason":"STOP"}]}`
+	out, err := ConvertResponse([]byte(body), StyleGoogleGenAI, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"id":"toolu_`) {
+		t.Errorf("tool_use without ID:\n%s", out)
+	}
+}
+
+func TestToolIDsGeminiStream(t *testing.T) {
+	conv, err := NewStreamConverter(StyleGoogleGenAI, StyleChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type call struct {
+		Index int    `json:"index"`
+		ID    string `json:"id"`
+	}
+	var calls []call
+	for _, chunk := range []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Rome"}}},{"functionCall":{"name":"get_time","args":{}}}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"STOP"}]}`,
+	} {
+		outs, err := conv.Push([]byte(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, out := range outs {
+			var c struct {
+				Choices []struct {
+					Delta struct {
+						ToolCalls []call `json:"tool_calls"`
+					} `json:"delta"`
+				} `json:"choices"`
+			}
+			json.Unmarshal(out, &c)
+			for _, ch := range c.Choices {
+				calls = append(calls, ch.Delta.ToolCalls...)
+			}
+		}
+	}
+	if len(calls) != 3 {
+		t.Fatalf("calls = %+v", calls)
+	}
+	seen := map[string]bool{}
+	for i, c := range calls {
+		if c.Index != i || !strings.HasPrefix(c.ID, "call_") || seen[c.ID] {
+			t.Errorf("call %d = %+v", i, c)
+		}
+		seen[c.ID] = true
+	}
+}
+
+// Current Gemini clients send function results in a "user" turn.
+const geminiUserResultsRequest = `{
+  "contents": [
+    {"role": "user", "parts": [{"text": "Check twice."}]},
+    {"role": "model", "parts": [
+      {"functionCall": {"name": "check", "args": {"n": 1}}},
+      {"functionCall": {"name": "check", "args": {"n": 2}}}
+    ]},
+    {"role": "user", "parts": [
+      {"functionResponse": {"name": "check", "response": {"ok": 1}}},
+      {"functionResponse": {"name": "check", "response": {"ok": 2}}}
+    ]}
+  ]
+}`
+
+func TestToolIDsGeminiUserRoleResults(t *testing.T) {
+	out, err := ConvertRequest([]byte(geminiUserResultsRequest), StyleGoogleGenAI, StyleChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chat struct {
+		Messages []struct {
+			Role      string `json:"role"`
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				ID string `json:"id"`
+			} `json:"tool_calls"`
+			ToolCallID string `json:"tool_call_id"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(out, &chat); err != nil {
+		t.Fatal(err)
+	}
+	if len(chat.Messages) != 4 || len(chat.Messages[1].ToolCalls) != 2 {
+		t.Fatalf("messages:\n%s", out)
+	}
+	for i, m := range chat.Messages[2:] {
+		if m.Role != "tool" || m.ToolCallID != chat.Messages[1].ToolCalls[i].ID {
+			t.Errorf("result %d = %+v\n%s", i, m, out)
+		}
+	}
+
+	out, err = ConvertRequest([]byte(geminiUserResultsRequest), StyleGoogleGenAI, StyleAnthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(out), `"type":"tool_result"`); n != 2 {
+		t.Errorf("%d tool_result blocks:\n%s", n, out)
+	}
+
+	// Gemini to Gemini keeps the "user" role.
+	out, err = ConvertRequest([]byte(geminiUserResultsRequest), StyleGoogleGenAI, StyleGoogleGenAI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, []byte(geminiUserResultsRequest), out)
+}
+
+func TestToolIDsResultsWithoutCallIDs(t *testing.T) {
+	// The calls carry IDs, the results only name the function.
+	body := `{
+  "contents": [
+    {"role": "user", "parts": [{"text": "Look at this"}, {"inlineData": {"mimeType": "image/png", "data": "aW1n"}}]},
+    {"role": "model", "parts": [{"functionCall": {"id": "fc_1", "name": "check", "args": {}}}]},
+    {"role": "user", "parts": [{"functionResponse": {"name": "check", "response": {"ok": 1}}}]}
+  ]
+}`
+	prog, err := (&GoogleGenAIParser{}).ParseRequest([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := prog.AssignToolIDs(DefaultToolIDs(StyleChatCompletions))
+	if got := out.ToolResults(); len(got) != 1 || got[0].CallID != "fc_1" {
+		t.Fatalf("results = %+v", got)
+	}
+	out.Buffers[0][0] = 'X'
+	if string(prog.Buffers[0]) != "aW1n" {
+		t.Error("AssignToolIDs shares buffers with its input")
+	}
+
+	chat, err := (&ChatCompletionsEmitter{}).EmitRequest(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(chat), `"tool_call_id":"fc_1"`) {
+		t.Errorf("chat result not matched to its call:\n%s", chat)
+	}
+}
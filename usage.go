@@ -0,0 +1,270 @@
+package ail
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// ─── Usage ───────────────────────────────────────────────────────────────────
+
+// Usage is the provider-neutral token accounting carried by USAGE as JSON.
+//
+// Totals follow OpenAI's convention: PromptTokens includes cached and
+// cache-write tokens, and CompletionTokens includes reasoning tokens. The
+// breakdown fields are subsets of those totals. Parsers convert from each
+// provider's convention (Anthropic reports cache tokens next to
+// input_tokens, Gemini reports thoughts next to candidates) and emitters
+// convert back. Zero fields are omitted, so a stream chunk that only knows
+// part of the usage carries only that part.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+	TotalTokens      int `json:"total_tokens,omitempty"`
+
+	CachedTokens        int `json:"cached_tokens,omitempty"`          // prompt tokens read from a cache
+	CacheWriteTokens    int `json:"cache_write_tokens,omitempty"`     // prompt tokens written to a cache
+	ToolUsePromptTokens int `json:"tool_use_prompt_tokens,omitempty"` // prompt tokens of tool-use results
+	ReasoningTokens     int `json:"reasoning_tokens,omitempty"`       // completion tokens spent thinking
+	AudioInputTokens    int `json:"audio_input_tokens,omitempty"`     // prompt tokens from audio
+	AudioOutputTokens   int `json:"audio_output_tokens,omitempty"`    // completion tokens of audio
+}
+
+// Total returns TotalTokens, or the sum of prompt and completion tokens
+// when the provider did not report a total.
+func (u Usage) Total() int {
+	if u.TotalTokens != 0 {
+		return u.TotalTokens
+	}
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Usage returns the decoded USAGE of the program, merging several USAGE
+// instructions the way a stream reports them, or nil if there is none.
+func (p *Program) Usage() *Usage {
+	var u *Usage
+	for _, inst := range p.Code {
+		if inst.Op != USAGE {
+			continue
+		}
+		var next Usage
+		if json.Unmarshal(inst.JSON, &next) != nil {
+			continue
+		}
+		if u == nil {
+			u = &Usage{}
+		}
+		u.merge(next)
+	}
+	return u
+}
+
+// merge applies a later partial report: every field it reports replaces
+// the current value.
+func (u *Usage) merge(o Usage) {
+	for _, f := range []struct {
+		dst *int
+		src int
+	}{
+		{&u.PromptTokens, o.PromptTokens},
+		{&u.CompletionTokens, o.CompletionTokens},
+		{&u.TotalTokens, o.TotalTokens},
+		{&u.CachedTokens, o.CachedTokens},
+		{&u.CacheWriteTokens, o.CacheWriteTokens},
+		{&u.ToolUsePromptTokens, o.ToolUsePromptTokens},
+		{&u.ReasoningTokens, o.ReasoningTokens},
+		{&u.AudioInputTokens, o.AudioInputTokens},
+		{&u.AudioOutputTokens, o.AudioOutputTokens},
+	} {
+		if f.src != 0 {
+			*f.dst = f.src
+		}
+	}
+}
+
+// emit appends u to prog as USAGE.
+func (u Usage) emit(prog *Program) {
+	j, _ := json.Marshal(u)
+	prog.EmitJSON(USAGE, j)
+}
+
+func decodeUsage(j json.RawMessage) Usage {
+	var u Usage
+	json.Unmarshal(j, &u)
+	return u
+}
+
+// ─── Provider usage shapes ───────────────────────────────────────────────────
+
+// unmarshalUsage decodes a provider usage object. Streams send "usage": null
+// on chunks without usage, which is reported as absent.
+func unmarshalUsage(raw json.RawMessage, v any) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) > 0 && raw[0] == '{' && json.Unmarshal(raw, v) == nil
+}
+
+// anthropicUsage is Anthropic's usage object. input_tokens excludes cache
+// reads and writes.
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+}
+
+func parseAnthropicUsage(raw json.RawMessage) (Usage, bool) {
+	var a anthropicUsage
+	if !unmarshalUsage(raw, &a) {
+		return Usage{}, false
+	}
+	return Usage{
+		PromptTokens:     a.InputTokens + a.CacheReadInputTokens + a.CacheCreationInputTokens,
+		CompletionTokens: a.OutputTokens,
+		CachedTokens:     a.CacheReadInputTokens,
+		CacheWriteTokens: a.CacheCreationInputTokens,
+	}, true
+}
+
+func (u Usage) anthropic() anthropicUsage {
+	return anthropicUsage{
+		InputTokens:              max(u.PromptTokens-u.CachedTokens-u.CacheWriteTokens, 0),
+		OutputTokens:             u.CompletionTokens,
+		CacheReadInputTokens:     u.CachedTokens,
+		CacheCreationInputTokens: u.CacheWriteTokens,
+	}
+}
+
+// openAIUsage is the Chat Completions usage object; Responses uses the
+// input/output names and is handled by parseResponsesUsage.
+type openAIUsage struct {
+	PromptTokens            int                 `json:"prompt_tokens"`
+	CompletionTokens        int                 `json:"completion_tokens"`
+	TotalTokens             int                 `json:"total_tokens"`
+	PromptTokensDetails     *openAITokenDetails `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *openAITokenDetails `json:"completion_tokens_details,omitempty"`
+}
+
+type openAITokenDetails struct {
+	CachedTokens    int `json:"cached_tokens,omitempty"`
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+	AudioTokens     int `json:"audio_tokens,omitempty"`
+}
+
+func parseOpenAIUsage(raw json.RawMessage) (Usage, bool) {
+	var o openAIUsage
+	if !unmarshalUsage(raw, &o) {
+		return Usage{}, false
+	}
+	u := Usage{
+		PromptTokens:     o.PromptTokens,
+		CompletionTokens: o.CompletionTokens,
+		TotalTokens:      o.TotalTokens,
+	}
+	if d := o.PromptTokensDetails; d != nil {
+		u.CachedTokens, u.AudioInputTokens = d.CachedTokens, d.AudioTokens
+	}
+	if d := o.CompletionTokensDetails; d != nil {
+		u.ReasoningTokens, u.AudioOutputTokens = d.ReasoningTokens, d.AudioTokens
+	}
+	return u, true
+}
+
+func (u Usage) openAI() openAIUsage {
+	o := openAIUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.Total(),
+	}
+	if u.CachedTokens != 0 || u.AudioInputTokens != 0 {
+		o.PromptTokensDetails = &openAITokenDetails{CachedTokens: u.CachedTokens, AudioTokens: u.AudioInputTokens}
+	}
+	if u.ReasoningTokens != 0 || u.AudioOutputTokens != 0 {
+		o.CompletionTokensDetails = &openAITokenDetails{ReasoningTokens: u.ReasoningTokens, AudioTokens: u.AudioOutputTokens}
+	}
+	return o
+}
+
+func parseResponsesUsage(raw json.RawMessage) (Usage, bool) {
+	var r struct {
+		InputTokens        int `json:"input_tokens"`
+		OutputTokens       int `json:"output_tokens"`
+		TotalTokens        int `json:"total_tokens"`
+		InputTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
+		OutputTokensDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"output_tokens_details"`
+	}
+	if !unmarshalUsage(raw, &r) {
+		return Usage{}, false
+	}
+	return Usage{
+		PromptTokens:     r.InputTokens,
+		CompletionTokens: r.OutputTokens,
+		TotalTokens:      r.TotalTokens,
+		CachedTokens:     r.InputTokensDetails.CachedTokens,
+		ReasoningTokens:  r.OutputTokensDetails.ReasoningTokens,
+	}, true
+}
+
+// geminiUsage is Gemini's usageMetadata. candidatesTokenCount excludes
+// thoughts, and promptTokenCount excludes tool-use prompt tokens.
+type geminiUsage struct {
+	PromptTokenCount        int                   `json:"promptTokenCount"`
+	CandidatesTokenCount    int                   `json:"candidatesTokenCount"`
+	TotalTokenCount         int                   `json:"totalTokenCount"`
+	ThoughtsTokenCount      int                   `json:"thoughtsTokenCount,omitempty"`
+	CachedContentTokenCount int                   `json:"cachedContentTokenCount,omitempty"`
+	ToolUsePromptTokenCount int                   `json:"toolUsePromptTokenCount,omitempty"`
+	PromptTokensDetails     []geminiModalityCount `json:"promptTokensDetails,omitempty"`
+	CandidatesTokensDetails []geminiModalityCount `json:"candidatesTokensDetails,omitempty"`
+}
+
+type geminiModalityCount struct {
+	Modality   string `json:"modality"`
+	TokenCount int    `json:"tokenCount"`
+}
+
+func parseGeminiUsage(raw json.RawMessage) (Usage, bool) {
+	var g geminiUsage
+	if !unmarshalUsage(raw, &g) {
+		return Usage{}, false
+	}
+	return Usage{
+		PromptTokens:        g.PromptTokenCount + g.ToolUsePromptTokenCount,
+		CompletionTokens:    g.CandidatesTokenCount + g.ThoughtsTokenCount,
+		TotalTokens:         g.TotalTokenCount,
+		CachedTokens:        g.CachedContentTokenCount,
+		ToolUsePromptTokens: g.ToolUsePromptTokenCount,
+		ReasoningTokens:     g.ThoughtsTokenCount,
+		AudioInputTokens:    geminiAudioTokens(g.PromptTokensDetails),
+		AudioOutputTokens:   geminiAudioTokens(g.CandidatesTokensDetails),
+	}, true
+}
+
+func geminiAudioTokens(details []geminiModalityCount) int {
+	for _, d := range details {
+		if d.Modality == "AUDIO" {
+			return d.TokenCount
+		}
+	}
+	return 0
+}
+
+func (u Usage) gemini() geminiUsage {
+	g := geminiUsage{
+		PromptTokenCount:        max(u.PromptTokens-u.ToolUsePromptTokens, 0),
+		CandidatesTokenCount:    max(u.CompletionTokens-u.ReasoningTokens, 0),
+		TotalTokenCount:         u.Total(),
+		ThoughtsTokenCount:      u.ReasoningTokens,
+		CachedContentTokenCount: u.CachedTokens,
+		ToolUsePromptTokenCount: u.ToolUsePromptTokens,
+	}
+	if u.AudioInputTokens != 0 {
+		g.PromptTokensDetails = []geminiModalityCount{{"AUDIO", u.AudioInputTokens}}
+	}
+	if u.AudioOutputTokens != 0 {
+		g.CandidatesTokensDetails = []geminiModalityCount{{"AUDIO", u.AudioOutputTokens}}
+	}
+	return g
+}
@@ -0,0 +1,132 @@
+package ail
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUsageConversion(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to Style
+		body     string
+		key      string
+		want     string
+	}{
+		{
+			"anthropic cache to chat", StyleAnthropic, StyleChatCompletions,
+			`{"id":"m","type":"message","role":"assistant","model":"claude","content":[],"stop_reason":"end_turn",
+			  "usage":{"input_tokens":20,"output_tokens":8,"cache_read_input_tokens":100,"cache_creation_input_tokens":30}}`,
+			"usage", `{"prompt_tokens":150,"completion_tokens":8,"total_tokens":158,"prompt_tokens_details":{"cached_tokens":100}}`,
+		},
+		{
+			"chat details to anthropic", StyleChatCompletions, StyleAnthropic,
+			`{"id":"c","model":"gpt-4o","choices":[],"usage":{"prompt_tokens":120,"completion_tokens":40,"total_tokens":160,
+			  "prompt_tokens_details":{"cached_tokens":100,"audio_tokens":0},"completion_tokens_details":{"reasoning_tokens":32}}}`,
+			"usage", `{"input_tokens":20,"output_tokens":40,"cache_read_input_tokens":100}`,
+		},
+		{
+			"chat reasoning to gemini", StyleChatCompletions, StyleGoogleGenAI,
+			`{"id":"c","model":"o3","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":50,"total_tokens":60,
+			  "completion_tokens_details":{"reasoning_tokens":45}}}`,
+			"usageMetadata", `{"promptTokenCount":10,"candidatesTokenCount":5,"totalTokenCount":60,"thoughtsTokenCount":45}`,
+		},
+		{
+			"gemini thoughts and cache to chat", StyleGoogleGenAI, StyleChatCompletions,
+			`{"candidates":[],"usageMetadata":{"promptTokenCount":300,"candidatesTokenCount":20,"thoughtsTokenCount":80,
+			  "cachedContentTokenCount":256,"totalTokenCount":400}}`,
+			"usage", `{"prompt_tokens":300,"completion_tokens":100,"total_tokens":400,"prompt_tokens_details":{"cached_tokens":256},"completion_tokens_details":{"reasoning_tokens":80}}`,
+		},
+		{
+			"gemini tool-use prompt round trip", StyleGoogleGenAI, StyleGoogleGenAI,
+			`{"candidates":[],"usageMetadata":{"promptTokenCount":120,"candidatesTokenCount":30,"totalTokenCount":190,
+			  "toolUsePromptTokenCount":40}}`,
+			"usageMetadata", `{"promptTokenCount":120,"candidatesTokenCount":30,"totalTokenCount":190,"toolUsePromptTokenCount":40}`,
+		},
+		{
+			"gemini tool-use prompt to chat", StyleGoogleGenAI, StyleChatCompletions,
+			`{"candidates":[],"usageMetadata":{"promptTokenCount":120,"candidatesTokenCount":30,"totalTokenCount":190,
+			  "toolUsePromptTokenCount":40}}`,
+			"usage", `{"prompt_tokens":160,"completion_tokens":30,"total_tokens":190}`,
+		},
+		{
+			"gemini audio to chat", StyleGoogleGenAI, StyleChatCompletions,
+			`{"candidates":[],"usageMetadata":{"promptTokenCount":40,"candidatesTokenCount":10,"totalTokenCount":50,
+			  "promptTokensDetails":[{"modality":"TEXT","tokenCount":15},{"modality":"AUDIO","tokenCount":25}]}}`,
+			"usage", `{"prompt_tokens":40,"completion_tokens":10,"total_tokens":50,"prompt_tokens_details":{"audio_tokens":25}}`,
+		},
+		{
+			"responses to anthropic", StyleResponses, StyleAnthropic,
+			`{"id":"r","model":"gpt-4.1","output":[],"usage":{"input_tokens":90,"output_tokens":12,"total_tokens":102,
+			  "input_tokens_details":{"cached_tokens":64},"output_tokens_details":{"reasoning_tokens":0}}}`,
+			"usage", `{"input_tokens":26,"output_tokens":12,"cache_read_input_tokens":64}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ConvertResponse([]byte(tt.body), tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]json.RawMessage
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatal(err)
+			}
+			if string(got[tt.key]) != tt.want {
+				t.Errorf("%s = %s\nwant %s", tt.key, got[tt.key], tt.want)
+			}
+		})
+	}
+}
+
+func TestUsageStreamAccumulation(t *testing.T) {
+	conv, err := NewStreamConverter(StyleAnthropic, StyleChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last json.RawMessage
+	for _, chunk := range []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":25,"output_tokens":1,"cache_read_input_tokens":10}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":15}}`,
+	} {
+		outs, err := conv.Push([]byte(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, out := range outs {
+			var c struct {
+				Usage json.RawMessage `json:"usage"`
+			}
+			if json.Unmarshal(out, &c) == nil && len(c.Usage) > 0 {
+				last = c.Usage
+			}
+		}
+	}
+	want := `{"prompt_tokens":35,"completion_tokens":15,"total_tokens":50,"prompt_tokens_details":{"cached_tokens":10}}`
+	if string(last) != want {
+		t.Errorf("final usage = %s\nwant %s", last, want)
+	}
+
+	// The Accumulator and Program.Usage merge the same way.
+	acc := NewAccumulator()
+	prog := NewProgram()
+	for _, chunk := range []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":25,"output_tokens":1}}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":15}}`,
+	} {
+		p, err := (&AnthropicParser{}).ParseStreamChunk([]byte(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		acc.Add(p)
+		prog.Code = append(prog.Code, p.Code...)
+	}
+	wantUsage := Usage{PromptTokens: 25, CompletionTokens: 15}
+	if u := acc.Program().Usage(); u == nil || *u != wantUsage {
+		t.Errorf("Accumulator usage = %+v", u)
+	}
+	if u := prog.Usage(); u == nil || *u != wantUsage || u.Total() != 40 {
+		t.Errorf("Program.Usage() = %+v", u)
+	}
+}